@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"trustwallet/business/parser"
+)
+
+// The maintenance commands below work on the storage held in a snapshot file, since the storage backend lives in
+// the memory of the serving process: stop the server with --dump, run them, then serve again with --restore. They
+// log to stderr, keeping stdout for what they print.
+
+// stateFlag registers the flag naming the snapshot file a maintenance command works on.
+func stateFlag(flags *flag.FlagSet) *string {
+	return flags.String("state", "parser.ndjson.gz", "snapshot file holding the storage the command works on")
+}
+
+// openState loads the snapshot file into a new storage, which starts empty when the file does not exist yet.
+func openState(log *zap.SugaredLogger, path string) (parser.Storage, error) {
+	store := newStorage()
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		log.Infow("snapshot", "status", "missing, starting empty", "file", path)
+		return store, nil
+	}
+	return store, restoreSnapshot(log, store, path)
+}
+
+// commandContext is cancelled when the command is interrupted.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// backfillCmd stores the transactions found in a range of past blocks for addresses subscribed after these blocks
+// were processed.
+func backfillCmd(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	state := stateFlag(flags)
+	from := flags.Int("from", 1, "first block to backfill")
+	to := flags.Int("to", 0, "last block to backfill, the storage checkpoint when 0")
+	addresses := flags.String("address", "", "comma separated addresses to backfill, every subscribed address when empty")
+	log, err := load(flags, args, true, "stderr")
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	store, err := openState(log, *state)
+	if err != nil {
+		return err
+	}
+	if *to == 0 {
+		*to = store.Checkpoint()
+	}
+	var list []string
+	if *addresses != "" {
+		list = strings.Split(*addresses, ",")
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	stats, err := parser.NewIdleEthereumParser(store, cfg.RPC.URL, log).Backfill(ctx, *from, *to, list)
+	if err != nil {
+		return err
+	}
+	log.Infow("backfill", "status", "done", "from", *from, "to", *to, "stats", stats)
+
+	return dumpSnapshot(log, store, *state)
+}
+
+// reindexCmd drops what was stored from a block on and processes these blocks again, up to the confirmed head.
+func reindexCmd(args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	state := stateFlag(flags)
+	from := flags.Int("from", 0, "first block to process again, required")
+	log, err := load(flags, args, true, "stderr")
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	if *from < 1 {
+		return errors.New("--from must be a block number")
+	}
+	store, err := openState(log, *state)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	p := parser.NewIdleEthereumParser(store, cfg.RPC.URL, log)
+	p.SetConfirmations(cfg.RPC.Confirmations)
+	p.SetFinality(cfg.RPC.Finality)
+	if err = p.Reindex(ctx, *from); err != nil {
+		return err
+	}
+	log.Infow("reindex", "status", "done", "from", *from, "checkpoint", store.Checkpoint())
+
+	return dumpSnapshot(log, store, *state)
+}
+
+// subscriptionsCmd lists, adds or removes the subscriptions of a tenant.
+func subscriptionsCmd(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("expected list, add or remove")
+	}
+	action, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("subscriptions "+action, flag.ContinueOnError)
+	state := stateFlag(flags)
+	tenant := flags.String("tenant", parser.DefaultTenant, "tenant owning the subscriptions")
+	purge := flags.Bool("purge", false, "also delete the stored transactions of removed addresses no tenant follows anymore")
+	log, err := load(flags, args, false, "stderr")
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	store, err := openState(log, *state)
+	if err != nil {
+		return err
+	}
+	p := parser.NewIdleEthereumParser(store, cfg.RPC.URL, log)
+
+	switch action {
+	case "list":
+		for _, address := range p.Subscriptions(*tenant) {
+			fmt.Println(address)
+		}
+		return nil
+	case "add":
+		if flags.NArg() == 0 {
+			return errors.New("expected the addresses to subscribe to")
+		}
+		for _, address := range flags.Args() {
+			// Operators are not bound by the subscription limit of the tenants
+			created, _ := p.Subscribe(*tenant, address)
+			log.Infow("subscriptions", "status", "added", "tenant", *tenant, "address", address, "created", created)
+		}
+	case "remove":
+		if flags.NArg() == 0 {
+			return errors.New("expected the addresses to unsubscribe from")
+		}
+		for _, address := range flags.Args() {
+			removed := p.Unsubscribe(*tenant, address, *purge)
+			log.Infow("subscriptions", "status", "removed", "tenant", *tenant, "address", address, "removed", removed)
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected list, add or remove", action)
+	}
+
+	return dumpSnapshot(log, store, *state)
+}
+
+// inspectBlockCmd prints the transactions of a block the parser would store, given the subscriptions, without
+// storing them.
+func inspectBlockCmd(args []string) error {
+	flags := flag.NewFlagSet("inspect-block", flag.ContinueOnError)
+	state := stateFlag(flags)
+	log, err := load(flags, args, true, "stderr")
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	if flags.NArg() != 1 {
+		return errors.New("expected a block number, after the flags")
+	}
+	number, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || number < 0 {
+		return fmt.Errorf("invalid block number %q", flags.Arg(0))
+	}
+	store, err := openState(log, *state)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	inspection, err := parser.NewIdleEthereumParser(store, cfg.RPC.URL, log).InspectBlock(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(inspection)
+}
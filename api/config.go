@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"trustwallet/business/conf"
+	"trustwallet/business/logger"
+)
+
+// config is used to represent runtime configuration. Every setting can be given in the YAML file, as an
+// environment variable or as a flag, see --help.
+type config struct {
+	RPC struct {
+		URL           string        `yaml:"url" env:"ETHEREUM_GATEWAY_URL" usage:"JSON-RPC endpoint of the Ethereum node, required"`
+		PollInterval  time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" usage:"time between two polls of the node"`
+		Confirmations int           `yaml:"confirmations" env:"CONFIRMATIONS" usage:"blocks a block must be buried under before it is processed"`
+		Finality      int           `yaml:"finality" env:"FINALITY" usage:"confirmations after which a transaction is final, announced by confirmation events until then; 0 announces none"`
+	} `yaml:"rpc"`
+
+	HTTP struct {
+		Addr            string        `yaml:"addr" env:"HTTP_ADDR" usage:"listen address of the HTTP API"`
+		ReadTimeout     time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"time allowed to read a request"`
+		WriteTimeout    time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"time allowed to write a response, streams excepted"`
+		IdleTimeout     time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"time a keep-alive connection may stay idle"`
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"time given to outstanding requests on shutdown"`
+		ReadyMaxLag     int           `yaml:"ready_max_lag" env:"READY_MAX_LAG" usage:"blocks the parser may fall behind before /readyz fails, 0 ignores the lag"`
+		CORSOrigins     []string      `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"browser origins allowed to call the API, or *; CORS is disabled when empty"`
+		CORSMaxAge      time.Duration `yaml:"cors_max_age" env:"CORS_MAX_AGE" usage:"time browsers may cache a preflight response"`
+	} `yaml:"http"`
+
+	GRPC struct {
+		Addr string `yaml:"addr" env:"GRPC_ADDR" usage:"listen address of the gRPC API"`
+	} `yaml:"grpc"`
+
+	Storage struct {
+		Backend   string `yaml:"backend" env:"STORAGE_BACKEND" usage:"storage backend, only memory is available"`
+		CacheSize int    `yaml:"cache_size" env:"STORAGE_CACHE_SIZE" usage:"transactions kept in the read cache in total, 0 disables it"`
+	} `yaml:"storage"`
+
+	Retention struct {
+		MaxAge        time.Duration `yaml:"max_age" env:"RETENTION_MAX_AGE" usage:"age after which transactions are pruned, 0 is unlimited"`
+		MaxBlocks     int           `yaml:"max_blocks" env:"RETENTION_MAX_BLOCKS" usage:"blocks behind the checkpoint after which transactions are pruned, 0 is unlimited"`
+		MaxRecords    int           `yaml:"max_records" env:"RETENTION_MAX_RECORDS" usage:"transactions kept per address, 0 is unlimited"`
+		PruneInterval time.Duration `yaml:"prune_interval" env:"RETENTION_PRUNE_INTERVAL" usage:"time between two prunings"`
+	} `yaml:"retention"`
+
+	Log struct {
+		Level            string        `yaml:"level" env:"LOG_LEVEL" usage:"lowest level logged at startup: debug, info, warn or error"`
+		Encoding         string        `yaml:"encoding" env:"LOG_ENCODING" usage:"log encoding: json or console"`
+		SampleInitial    int           `yaml:"sample_initial" env:"LOG_SAMPLE_INITIAL" usage:"entries with the same level and message logged each second before sampling starts, 0 disables sampling"`
+		SampleThereafter int           `yaml:"sample_thereafter" env:"LOG_SAMPLE_THEREAFTER" usage:"one entry in this many is logged once sampling started"`
+		ErrorInterval    time.Duration `yaml:"error_interval" env:"LOG_ERROR_INTERVAL" usage:"time an error is not logged again for when it repeats, 0 logs every error"`
+	} `yaml:"log"`
+
+	Auth struct {
+		AdminKey string   `yaml:"admin_key" env:"ADMIN_API_KEY" usage:"key managing the API keys, which are required once it is set"`
+		APIKeys  []string `yaml:"api_keys" env:"API_KEYS" usage:"keys provisioned at startup, as tenant:key pairs"`
+	} `yaml:"auth"`
+
+	Limits struct {
+		IPRate           float64 `yaml:"ip_rps" env:"RATE_LIMIT_IP_RPS" usage:"requests per second of a client IP, 0 disables the limit"`
+		IPBurst          int     `yaml:"ip_burst" env:"RATE_LIMIT_IP_BURST" usage:"requests a client IP may burst to"`
+		KeyRate          float64 `yaml:"key_rps" env:"RATE_LIMIT_KEY_RPS" usage:"requests per second of an API key, 0 disables the limit"`
+		KeyBurst         int     `yaml:"key_burst" env:"RATE_LIMIT_KEY_BURST" usage:"requests an API key may burst to"`
+		MaxSubscriptions int     `yaml:"max_subscriptions" env:"MAX_SUBSCRIPTIONS_PER_TENANT" usage:"addresses each tenant can subscribe to, 0 is unlimited"`
+		MaxWebhooks      int     `yaml:"max_webhooks" env:"MAX_WEBHOOKS_PER_TENANT" usage:"webhooks each tenant can register"`
+	} `yaml:"limits"`
+
+	Events struct {
+		History int `yaml:"history" env:"EVENT_HISTORY_SIZE" usage:"recent events kept for streams resuming with Last-Event-ID"`
+	} `yaml:"events"`
+
+	Notify struct {
+		SMTPAddr      string `yaml:"smtp_addr" env:"SMTP_ADDR" usage:"SMTP server of the email notifications, which are disabled when empty"`
+		SMTPFrom      string `yaml:"smtp_from" env:"SMTP_FROM" usage:"sender of the email notifications"`
+		SMTPUsername  string `yaml:"smtp_username" env:"SMTP_USERNAME" usage:"SMTP username"`
+		SMTPPassword  string `yaml:"smtp_password" env:"SMTP_PASSWORD" usage:"SMTP password"`
+		PushEndpoint  string `yaml:"push_endpoint" env:"PUSH_ENDPOINT" usage:"gateway of the push notifications, which are disabled when empty"`
+		PushServerKey string `yaml:"push_server_key" env:"PUSH_SERVER_KEY" usage:"server key of the push gateway"`
+	} `yaml:"notify"`
+
+	Broker struct {
+		Kind       string   `yaml:"kind" env:"BROKER" usage:"message broker receiving the parser events: nats or kafka, none when empty"`
+		URLs       []string `yaml:"urls" env:"BROKER_URLS" usage:"addresses of the broker"`
+		Prefix     string   `yaml:"prefix" env:"BROKER_PREFIX" usage:"prefix of the subjects or topics"`
+		Stream     string   `yaml:"stream" env:"BROKER_STREAM" usage:"NATS JetStream stream storing the events, created on the prefixed subjects when missing"`
+		ReplayFrom int      `yaml:"replay_from" env:"BROKER_REPLAY_FROM" usage:"resend the events after this block on startup, -1 resumes after the last block the broker acknowledged"`
+	} `yaml:"broker"`
+
+	// The exporter reads the other standard OTEL_EXPORTER_OTLP_* variables itself, such as the headers and the
+	// TLS settings.
+	Tracing struct {
+		Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT,OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" usage:"OTLP/HTTP collector receiving the traces, tracing is disabled when empty"`
+		ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME" usage:"service name of the traces"`
+		SampleRatio float64 `yaml:"sample_ratio" env:"TRACE_SAMPLE_RATIO" usage:"share of the traces recorded, between 0 and 1"`
+	} `yaml:"tracing"`
+
+	Features struct {
+		GRPC          bool `yaml:"grpc" env:"FEATURE_GRPC" usage:"serve the gRPC API"`
+		GraphQL       bool `yaml:"graphql" env:"FEATURE_GRAPHQL" usage:"serve the GraphQL endpoint"`
+		Streams       bool `yaml:"streams" env:"FEATURE_STREAMS" usage:"serve the Server-Sent Events and WebSocket streams"`
+		Webhooks      bool `yaml:"webhooks" env:"FEATURE_WEBHOOKS" usage:"deliver events to webhooks"`
+		Notifications bool `yaml:"notifications" env:"FEATURE_NOTIFICATIONS" usage:"notify users by email, push or log"`
+		Metrics       bool `yaml:"metrics" env:"FEATURE_METRICS" usage:"expose the Prometheus metrics"`
+	} `yaml:"features"`
+}
+
+// cfg provides parsed runtime configuration as a convenient global variable.
+var cfg config
+
+// logLevel is the level of the application logger, which the admin API changes at runtime.
+var logLevel zap.AtomicLevel
+
+// defaultConfig returns the configuration used for the settings given nowhere.
+func defaultConfig() config {
+	var c config
+	c.RPC.PollInterval = 5 * time.Second
+	c.RPC.Finality = 12
+	c.HTTP.Addr = "0.0.0.0:8080"
+	c.HTTP.ReadTimeout = 5 * time.Second
+	c.HTTP.WriteTimeout = 10 * time.Second
+	c.HTTP.IdleTimeout = 120 * time.Second
+	c.HTTP.ShutdownTimeout = 20 * time.Second
+	c.HTTP.ReadyMaxLag = 50
+	c.HTTP.CORSMaxAge = 10 * time.Minute
+	c.GRPC.Addr = "0.0.0.0:9090"
+	c.Storage.Backend = "memory"
+	c.Retention.PruneInterval = time.Minute
+	c.Log.Level = "info"
+	c.Log.Encoding = "json"
+	c.Log.SampleInitial = 100
+	c.Log.SampleThereafter = 100
+	c.Log.ErrorInterval = time.Minute
+	c.Limits.IPRate = 20
+	c.Limits.IPBurst = 40
+	c.Limits.KeyRate = 10
+	c.Limits.KeyBurst = 20
+	c.Limits.MaxSubscriptions = 1000
+	c.Limits.MaxWebhooks = 100
+	c.Events.History = 10000
+	c.Broker.Prefix = "ethparser"
+	c.Broker.Stream = "ETHPARSER"
+	c.Broker.ReplayFrom = -1
+	c.Tracing.ServiceName = "eth-parser"
+	c.Tracing.SampleRatio = 1
+	c.Features.GRPC = true
+	c.Features.GraphQL = true
+	c.Features.Streams = true
+	c.Features.Webhooks = true
+	c.Features.Notifications = true
+	c.Features.Metrics = true
+	return c
+}
+
+// load reads the configuration of a command into cfg, registering its flags on flags, and constructs the
+// application logger at the configured level. Commands that talk to the Ethereum node require its URL.
+func load(flags *flag.FlagSet, args []string, node bool, outputPaths ...string) (*zap.SugaredLogger, error) {
+	cfg = defaultConfig()
+	if err := conf.Parse(flags, args, os.LookupEnv, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(node); err != nil {
+		return nil, err
+	}
+
+	level, _ := zapcore.ParseLevel(cfg.Log.Level)
+	logLevel = zap.NewAtomicLevelAt(level)
+	return logger.NewWith("API", logger.Config{
+		Level:            logLevel,
+		Encoding:         cfg.Log.Encoding,
+		SampleInitial:    cfg.Log.SampleInitial,
+		SampleThereafter: cfg.Log.SampleThereafter,
+		ErrorInterval:    cfg.Log.ErrorInterval,
+	}, outputPaths...)
+}
+
+// validate reports every invalid setting at once.
+func (c config) validate(node bool) error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if c.RPC.URL == "" {
+		check(!node, "rpc.url is required, set ETHEREUM_GATEWAY_URL or --rpc-url")
+	} else {
+		u, err := url.Parse(c.RPC.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "rpc.url must be an http or https URL")
+	}
+	check(c.RPC.PollInterval > 0, "rpc.poll_interval must be positive")
+	check(c.RPC.Confirmations >= 0, "rpc.confirmations must not be negative")
+	check(c.RPC.Finality >= 0, "rpc.finality must not be negative")
+
+	check(c.HTTP.Addr != "", "http.addr is required")
+	check(c.HTTP.ReadTimeout > 0, "http.read_timeout must be positive")
+	check(c.HTTP.WriteTimeout > 0, "http.write_timeout must be positive")
+	check(c.HTTP.IdleTimeout > 0, "http.idle_timeout must be positive")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive")
+	check(c.HTTP.ReadyMaxLag >= 0, "http.ready_max_lag must not be negative")
+	check(c.HTTP.CORSMaxAge >= 0, "http.cors_max_age must not be negative")
+	check(!c.Features.GRPC || c.GRPC.Addr != "", "grpc.addr is required")
+
+	check(c.Storage.Backend == "memory", "storage.backend %q is unknown, expected memory", c.Storage.Backend)
+	check(c.Storage.CacheSize >= 0, "storage.cache_size must not be negative")
+	check(c.Retention.MaxAge >= 0 && c.Retention.MaxBlocks >= 0 && c.Retention.MaxRecords >= 0, "retention limits must not be negative")
+	check(c.Retention.PruneInterval > 0, "retention.prune_interval must be positive")
+
+	_, err := zapcore.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level %q is unknown, expected debug, info, warn or error", c.Log.Level)
+	check(c.Log.Encoding == "json" || c.Log.Encoding == "console", "log.encoding %q is unknown, expected json or console", c.Log.Encoding)
+	check(c.Log.SampleInitial >= 0, "log.sample_initial must not be negative")
+	check(c.Log.SampleInitial == 0 || c.Log.SampleThereafter > 0, "log.sample_thereafter must be positive")
+	check(c.Log.ErrorInterval >= 0, "log.error_interval must not be negative")
+
+	for _, pair := range c.Auth.APIKeys {
+		tenant, secret, ok := strings.Cut(pair, ":")
+		check(ok && tenant != "" && secret != "", "auth.api_keys entries must be tenant:key pairs")
+	}
+
+	check(c.Limits.IPRate >= 0 && c.Limits.KeyRate >= 0, "limits rates must not be negative")
+	check(c.Limits.IPRate == 0 || c.Limits.IPBurst > 0, "limits.ip_burst must be positive")
+	check(c.Limits.KeyRate == 0 || c.Limits.KeyBurst > 0, "limits.key_burst must be positive")
+	check(c.Limits.MaxSubscriptions >= 0, "limits.max_subscriptions must not be negative")
+	check(c.Limits.MaxWebhooks > 0, "limits.max_webhooks must be positive")
+	check(c.Events.History >= 0, "events.history must not be negative")
+
+	switch c.Broker.Kind {
+	case "", "nats":
+		check(c.Broker.Kind == "" || c.Broker.Stream != "", "broker.stream is required by nats")
+	case "kafka":
+		check(len(c.Broker.URLs) > 0, "broker.urls is required by kafka")
+	default:
+		check(false, "broker.kind %q is unknown, expected nats or kafka", c.Broker.Kind)
+	}
+	check(c.Broker.ReplayFrom >= -1, "broker.replay_from must be a block number, or -1")
+
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+// Package gql serves the parser over GraphQL, next to the REST API of package server. Queries and mutations
+// are answered over HTTP POST, subscriptions over WebSocket with the graphql-transport-ws protocol.
+//
+// The schema lives in schema.graphql.
+package gql
+
+import (
+	_ "embed"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"go.uber.org/zap"
+	"net/http"
+	"trustwallet/api/server"
+	"trustwallet/business/events"
+	"trustwallet/business/parser"
+)
+
+// maxDepth caps the nesting of a query, so a client cannot make the server resolve arbitrarily deep selections.
+const maxDepth = 10
+
+//go:embed schema.graphql
+var schema string
+
+// Parser is the parser the resolvers read from: the one of the REST API, which can also fetch balances.
+type Parser interface {
+	server.Parser
+	GetBalance(address string) (string, error)
+	QueryTransfers(address string, nft bool, q parser.TransactionQuery) ([]parser.Transfer, string, error)
+}
+
+// Config contains all the mandatory systems required by the endpoint. Events is optional, subscriptions fail
+// without it.
+type Config struct {
+	Log    *zap.SugaredLogger
+	Parser Parser
+	Events *events.Bus
+
+	// CheckOrigin reports whether a browser origin may open subscriptions, only the origin of the server may
+	// when nil.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Handler serves the GraphQL endpoint.
+type Handler struct {
+	schema   *graphql.Schema
+	http     *relay.Handler
+	upgrader websocket.Upgrader
+	Log      *zap.SugaredLogger
+}
+
+// NewHandler parses the schema and binds it to the resolvers.
+func NewHandler(cfg Config) (*Handler, error) {
+	if cfg.Parser == nil {
+		return nil, errors.New("gql: parser is required")
+	}
+
+	s, err := graphql.ParseSchema(schema, &Resolver{parser: cfg.Parser, events: cfg.Events, log: cfg.Log}, graphql.MaxDepth(maxDepth))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{
+		schema: s,
+		http:   &relay.Handler{Schema: s},
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{Subprotocol},
+			CheckOrigin:     cfg.CheckOrigin,
+		},
+		Log: cfg.Log,
+	}, nil
+}
+
+// ServeHTTP answers queries and mutations posted as JSON, and upgrades WebSocket requests for subscriptions.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWS(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.http.ServeHTTP(w, r)
+}
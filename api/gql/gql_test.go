@@ -0,0 +1,272 @@
+package gql
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"trustwallet/business/events"
+	"trustwallet/business/parser"
+	"trustwallet/business/storage"
+)
+
+// newTestServer serves the endpoint over a parser whose node only knows balances.
+func newTestServer(t *testing.T) (*httptest.Server, *events.Bus) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Method == "eth_getBalance" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": "0x2a"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": -32601, "message": "not found"}})
+	}))
+	t.Cleanup(node.Close)
+
+	log := zap.NewNop().Sugar()
+	store := storage.NewMemoryStorage()
+	for i := int64(1); i <= 3; i++ {
+		store.AddTransaction("0x123", parser.Transaction{Hash: "0x" + strings.Repeat("a", int(i)), From: "0x123", To: "0x456", Value: "0x1", BlockNumber: big.NewInt(i)})
+	}
+	store.AddTransaction("0x123", parser.Transaction{Hash: "0xb", From: "0x999", To: "0xc0", Value: "0x0", BlockNumber: big.NewInt(4), Transfers: []parser.TokenTransfer{
+		{Token: "0xc0", Standard: parser.StandardERC20, From: "0x999", To: "0x123", Value: "0x5", LogIndex: 0},
+		{Token: "0xc1", Standard: parser.StandardERC721, From: "0x999", To: "0x123", Value: "0x1", TokenID: "0x7", LogIndex: 1},
+		{Token: "0xc0", Standard: parser.StandardERC20, From: "0x999", To: "0x456", Value: "0x6", LogIndex: 2},
+	}})
+	bus := events.NewBus(10)
+
+	h, err := NewHandler(Config{
+		Log:    log,
+		Parser: parser.NewEthereumParser(store, node.URL, time.Hour, log),
+		Events: bus,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler returned error: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	return srv, bus
+}
+
+// post runs an operation over HTTP and decodes its data.
+func post(t *testing.T, url, query string, vars map[string]interface{}, data interface{}) []interface{} {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("posting query: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []interface{}   `json:"errors"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if data != nil && len(out.Data) > 0 {
+		json.Unmarshal(out.Data, data)
+	}
+	return out.Errors
+}
+
+// Define a test of the queries and mutations
+func TestQuery(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	var sub struct{ Subscribe bool }
+	if errs := post(t, srv.URL, `mutation { subscribe(address: "0x123") }`, nil, &sub); len(errs) > 0 || !sub.Subscribe {
+		t.Fatalf("subscribe returned %v, %v, expected true", sub, errs)
+	}
+	if errs := post(t, srv.URL, `mutation { subscribe(address: "unknown") }`, nil, nil); len(errs) == 0 {
+		t.Errorf("subscribe accepted an invalid address")
+	}
+
+	const query = `query($after: String) {
+		currentBlock
+		address(address: "0x123") {
+			balance
+			transactions(first: 2, after: $after, direction: OUT) {
+				edges { cursor node { hash value block { number } } }
+				pageInfo { endCursor hasNextPage }
+			}
+		}
+	}`
+	var page struct {
+		Address struct {
+			Balance      string
+			Transactions struct {
+				Edges []struct {
+					Node struct {
+						Hash  string
+						Block struct{ Number int }
+					}
+				}
+				PageInfo struct {
+					EndCursor   string
+					HasNextPage bool
+				}
+			}
+		}
+	}
+	if errs := post(t, srv.URL, query, nil, &page); len(errs) > 0 {
+		t.Fatalf("query returned errors: %v", errs)
+	}
+	txs := page.Address.Transactions
+	if page.Address.Balance != "42" || len(txs.Edges) != 2 || txs.Edges[1].Node.Block.Number != 2 || !txs.PageInfo.HasNextPage {
+		t.Fatalf("query returned %+v, expected a balance of 42 and the first 2 transactions", page)
+	}
+
+	if errs := post(t, srv.URL, query, map[string]interface{}{"after": txs.PageInfo.EndCursor}, &page); len(errs) > 0 {
+		t.Fatalf("query returned errors: %v", errs)
+	}
+	txs = page.Address.Transactions
+	if len(txs.Edges) != 1 || txs.Edges[0].Node.Block.Number != 3 || txs.PageInfo.HasNextPage {
+		t.Fatalf("query returned %+v, expected the last transaction", page)
+	}
+
+	if errs := post(t, srv.URL, `{ address(address: "0x123") { transactions(first: 0) { pageInfo { hasNextPage } } } }`, nil, nil); len(errs) == 0 {
+		t.Errorf("query accepted an invalid page size")
+	}
+}
+
+// Define a test of the token and NFT transfers of an address
+func TestTransfers(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	const query = `{
+		address(address: "0x123") {
+			tokenTransfers { edges { node { token value tokenId transaction { hash } } } }
+			nftTransfers(direction: IN) { edges { node { standard tokenId } } }
+		}
+	}`
+	if errs := post(t, srv.URL, query, nil, nil); len(errs) == 0 {
+		t.Errorf("query returned the transfers of an address the caller is not subscribed to")
+	}
+	post(t, srv.URL, `mutation { subscribe(address: "0x123") }`, nil, nil)
+
+	type transfers struct {
+		Edges []struct {
+			Node struct {
+				Token       string
+				Standard    string
+				Value       string
+				TokenID     *string
+				Transaction struct{ Hash string }
+			}
+		}
+	}
+	var page struct {
+		Address struct {
+			TokenTransfers transfers
+			NftTransfers   transfers
+		}
+	}
+	if errs := post(t, srv.URL, query, nil, &page); len(errs) > 0 {
+		t.Fatalf("query returned errors: %v", errs)
+	}
+	tokens, nfts := page.Address.TokenTransfers.Edges, page.Address.NftTransfers.Edges
+	if len(tokens) != 1 || tokens[0].Node.Value != "0x5" || tokens[0].Node.TokenID != nil || tokens[0].Node.Transaction.Hash != "0xb" {
+		t.Errorf("tokenTransfers returned %+v, expected the ERC-20 transfer to the address", tokens)
+	}
+	if len(nfts) != 1 || nfts[0].Node.Standard != parser.StandardERC721 || nfts[0].Node.TokenID == nil || *nfts[0].Node.TokenID != "0x7" {
+		t.Errorf("nftTransfers returned %+v, expected the ERC-721 transfer to the address", nfts)
+	}
+}
+
+// Define a test of the subscriptions over WebSocket
+func TestSubscription(t *testing.T) {
+	srv, bus := newTestServer(t)
+
+	dialer := websocket.Dialer{Subprotocols: []string{Subprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg wsMessage
+	conn.WriteJSON(wsMessage{Type: msgConnectionInit})
+	if err = conn.ReadJSON(&msg); err != nil || msg.Type != msgConnectionAck {
+		t.Fatalf("received %v, %v, expected connection_ack", msg, err)
+	}
+
+	// Only subscribed addresses can be followed
+	payload, _ := json.Marshal(wsRequest{Query: `subscription { events(addresses: ["0x123"]) { type } }`})
+	conn.WriteJSON(wsMessage{ID: "0", Type: msgSubscribe, Payload: payload})
+	if err = conn.ReadJSON(&msg); err != nil || msg.Type != msgNext || !strings.Contains(string(msg.Payload), errNotSubscribed.Error()) {
+		t.Fatalf("received %v, %v, expected a not subscribed error", msg, err)
+	}
+	if err = conn.ReadJSON(&msg); err != nil || msg.Type != msgComplete {
+		t.Fatalf("received %v, %v, expected complete", msg, err)
+	}
+	post(t, srv.URL, `mutation { subscribe(address: "0x123") }`, nil, nil)
+
+	payload, _ = json.Marshal(wsRequest{Query: `subscription { events(addresses: ["0x123"], heads: true) { type address block { number } } }`})
+	conn.WriteJSON(wsMessage{ID: "1", Type: msgSubscribe, Payload: payload})
+
+	// The subscription is registered asynchronously, publish until its first event arrives
+	received := make(chan wsMessage, 1)
+	go func() {
+		var msg wsMessage
+		conn.ReadJSON(&msg)
+		received <- msg
+	}()
+	var next wsMessage
+	for next.Type == "" {
+		bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 9})
+		select {
+		case next = <-received:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	var resp struct {
+		Data struct {
+			Events struct {
+				Type    string
+				Address string
+				Block   struct{ Number int }
+			}
+		}
+	}
+	json.Unmarshal(next.Payload, &resp)
+	if next.ID != "1" || next.Type != msgNext || resp.Data.Events.Address != "0x123" || resp.Data.Events.Block.Number != 9 {
+		t.Fatalf("received %v, expected the event of block 9", string(next.Payload))
+	}
+
+	// The events of an address are dropped once the tenant unsubscribes from it, the heads still come
+	post(t, srv.URL, `mutation { unsubscribe(address: "0x123") }`, nil, nil)
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 10})
+	bus.Publish(parser.Event{Type: parser.EventNewHead, Block: 11})
+	for resp.Data.Events.Block.Number != 11 {
+		if err = conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading: %v", err)
+		}
+		json.Unmarshal(msg.Payload, &resp)
+		if resp.Data.Events.Block.Number == 10 {
+			t.Fatalf("received %v, expected no event after unsubscribing", string(msg.Payload))
+		}
+	}
+
+	conn.WriteJSON(wsMessage{Type: msgPing})
+	for {
+		if err = conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading: %v", err)
+		}
+		if msg.Type == msgPong {
+			break
+		}
+	}
+}
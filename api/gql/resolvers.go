@@ -0,0 +1,522 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+	"math/big"
+	"strconv"
+	"strings"
+	"trustwallet/business/auth"
+	"trustwallet/business/events"
+	"trustwallet/business/parser"
+)
+
+// eventsBuffer is the number of events a slow subscription may lag behind before it is completed.
+const eventsBuffer = 64
+
+// maxAddresses caps the addresses a single events subscription may follow.
+const maxAddresses = 100
+
+var (
+	errInvalidAddress = errors.New("address is invalid")
+	errNotSubscribed  = errors.New("address is not subscribed")
+	errNoEvents       = errors.New("event stream is disabled")
+)
+
+// Resolver is the root resolver, serving the Query, Mutation and Subscription types.
+type Resolver struct {
+	parser Parser
+	events *events.Bus
+	log    *zap.SugaredLogger
+}
+
+func (r *Resolver) CurrentBlock() int32 {
+	return int32(r.parser.GetCurrentBlock())
+}
+
+func (r *Resolver) Subscriptions(ctx context.Context) []string {
+	return r.parser.Subscriptions(auth.Tenant(ctx))
+}
+
+func (r *Resolver) Address(ctx context.Context, args struct{ Address string }) (*addressResolver, error) {
+	if err := validAddress(args.Address); err != nil {
+		return nil, err
+	}
+	return &addressResolver{address: args.Address, tenant: auth.Tenant(ctx), root: r}, nil
+}
+
+func (r *Resolver) Subscribe(ctx context.Context, args struct{ Address string }) (bool, error) {
+	if err := validAddress(args.Address); err != nil {
+		return false, err
+	}
+	return r.parser.Subscribe(auth.Tenant(ctx), args.Address)
+}
+
+func (r *Resolver) Unsubscribe(ctx context.Context, args struct {
+	Address string
+	Purge   bool
+}) (bool, error) {
+	if err := validAddress(args.Address); err != nil {
+		return false, err
+	}
+	return r.parser.Unsubscribe(auth.Tenant(ctx), args.Address, args.Purge), nil
+}
+
+// Events follows the bus until the client completes the subscription, or falls too far behind. Tenants can only
+// follow the addresses they are subscribed to, and stop receiving the events of those they unsubscribe from.
+func (r *Resolver) Events(ctx context.Context, args struct {
+	Addresses []string
+	Heads     bool
+}) (<-chan *eventResolver, error) {
+	if r.events == nil {
+		return nil, errNoEvents
+	}
+	if len(args.Addresses) > maxAddresses {
+		return nil, errors.New("too many addresses")
+	}
+	for _, address := range args.Addresses {
+		if err := validAddress(address); err != nil {
+			return nil, err
+		}
+		if !r.parser.IsSubscribed(auth.Tenant(ctx), address) {
+			return nil, errNotSubscribed
+		}
+	}
+
+	tenant := auth.Tenant(ctx)
+	sub, _ := r.events.Subscribe(0, eventsBuffer, args.Addresses...)
+	sub.FollowHeads(args.Heads)
+
+	out := make(chan *eventResolver)
+	go func() {
+		defer close(out)
+		defer r.events.Unsubscribe(sub)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if address := msg.Event.Address; address != "" && !r.parser.IsSubscribed(tenant, address) {
+					sub.Unfollow(address)
+					continue
+				}
+				select {
+				case out <- &eventResolver{msg: msg}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// validAddress rejects the addresses the REST handlers reject.
+func validAddress(address string) error {
+	if address == "" || address == "unknown" {
+		return errInvalidAddress
+	}
+	return nil
+}
+
+type addressResolver struct {
+	address string
+	tenant  string
+	root    *Resolver
+}
+
+func (a *addressResolver) Address() string {
+	return a.address
+}
+
+// Balance asks the node, a failure only nulls the field instead of the whole query.
+func (a *addressResolver) Balance() (*string, error) {
+	balance, err := a.root.parser.GetBalance(a.address)
+	if err != nil {
+		a.root.log.Errorw("graphql", "status", "getting balance", "address", a.address, "error", err)
+		return nil, errors.New("balance is unavailable")
+	}
+	return &balance, nil
+}
+
+type transactionsArgs struct {
+	First     *int32
+	After     *string
+	Direction string
+	FromBlock *int32
+	ToBlock   *int32
+	Since     *int32
+	Until     *int32
+	MinValue  *string
+	Status    *string
+}
+
+// Transactions pages through the stored transactions, fetching one extra to tell whether a next page exists.
+// Tenants can only read the addresses they are subscribed to, and the history they kept when unsubscribing.
+func (a *addressResolver) Transactions(args transactionsArgs) (*connectionResolver, error) {
+	until, ok := a.root.parser.History(a.tenant, a.address)
+	if !ok {
+		return nil, errNotSubscribed
+	}
+
+	q, err := transactionQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	q = q.UpTo(until)
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+
+	txs, _, err := a.root.parser.QueryTransactions(a.address, q)
+	if errors.Is(err, parser.ErrInvalidCursor) {
+		return nil, errors.New("after is invalid")
+	}
+	if err != nil {
+		a.root.log.Errorw("graphql", "status", "querying transactions", "address", a.address, "error", err)
+		return nil, errors.New("internal error")
+	}
+
+	conn := &connectionResolver{}
+	if limit > 0 && len(txs) > limit {
+		txs, conn.hasNext = txs[:limit], true
+	}
+	for i := range txs {
+		conn.edges = append(conn.edges, &edgeResolver{tx: &txs[i]})
+	}
+
+	return conn, nil
+}
+
+type transfersArgs struct {
+	First     *int32
+	After     *string
+	Direction string
+	FromBlock *int32
+	ToBlock   *int32
+	Since     *int32
+	Until     *int32
+	MinValue  *string
+}
+
+func (a *addressResolver) TokenTransfers(args transfersArgs) (*transferConnectionResolver, error) {
+	return a.transfers(false, args)
+}
+
+func (a *addressResolver) NftTransfers(args transfersArgs) (*transferConnectionResolver, error) {
+	return a.transfers(true, args)
+}
+
+// transfers pages through the token or NFT transfers of the stored transactions like Transactions does.
+func (a *addressResolver) transfers(nft bool, args transfersArgs) (*transferConnectionResolver, error) {
+	until, ok := a.root.parser.History(a.tenant, a.address)
+	if !ok {
+		return nil, errNotSubscribed
+	}
+
+	q, err := transactionQuery(transactionsArgs{
+		First:     args.First,
+		After:     args.After,
+		Direction: args.Direction,
+		FromBlock: args.FromBlock,
+		ToBlock:   args.ToBlock,
+		Since:     args.Since,
+		Until:     args.Until,
+		MinValue:  args.MinValue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	q = q.UpTo(until)
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+
+	transfers, _, err := a.root.parser.QueryTransfers(a.address, nft, q)
+	if errors.Is(err, parser.ErrInvalidCursor) {
+		return nil, errors.New("after is invalid")
+	}
+	if err != nil {
+		a.root.log.Errorw("graphql", "status", "querying transfers", "address", a.address, "error", err)
+		return nil, errors.New("internal error")
+	}
+
+	conn := &transferConnectionResolver{}
+	if limit > 0 && len(transfers) > limit {
+		transfers, conn.hasNext = transfers[:limit], true
+	}
+	for i := range transfers {
+		conn.edges = append(conn.edges, &transferEdgeResolver{transfer: &transfers[i]})
+	}
+
+	return conn, nil
+}
+
+// transactionQuery converts and validates the arguments of the transactions field.
+func transactionQuery(args transactionsArgs) (parser.TransactionQuery, error) {
+	var q parser.TransactionQuery
+
+	if args.First != nil {
+		if *args.First < 1 || *args.First > parser.MaxQueryLimit {
+			return q, errors.New("first is invalid")
+		}
+		q.Limit = int(*args.First)
+	}
+	if args.After != nil {
+		q.Cursor = *args.After
+	}
+	q.Direction = parser.Direction(strings.ToLower(args.Direction))
+	if args.Status != nil {
+		switch *args.Status {
+		case parser.TransactionSuccess, parser.TransactionFailed:
+			q.Status = *args.Status
+		default:
+			return q, errors.New("status is invalid")
+		}
+	}
+
+	ints := []struct {
+		name string
+		src  *int32
+		dst  *int64
+	}{
+		{"fromBlock", args.FromBlock, &q.FromBlock},
+		{"toBlock", args.ToBlock, &q.ToBlock},
+		{"since", args.Since, &q.Since},
+		{"until", args.Until, &q.Until},
+	}
+	for _, i := range ints {
+		if i.src == nil {
+			continue
+		}
+		if *i.src < 0 {
+			return q, errors.New(i.name + " is invalid")
+		}
+		*i.dst = int64(*i.src)
+	}
+
+	if args.MinValue != nil {
+		n, ok := new(big.Int).SetString(*args.MinValue, 0)
+		if !ok || n.Sign() < 0 {
+			return q, errors.New("minValue is invalid")
+		}
+		q.MinValue = n
+	}
+
+	return q, nil
+}
+
+type connectionResolver struct {
+	edges   []*edgeResolver
+	hasNext bool
+}
+
+func (c *connectionResolver) Edges() []*edgeResolver {
+	return c.edges
+}
+
+func (c *connectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNext: c.hasNext}
+	if len(c.edges) > 0 {
+		p.endCursor = c.edges[len(c.edges)-1].Cursor()
+	}
+	return p
+}
+
+type edgeResolver struct {
+	tx *parser.Transaction
+}
+
+func (e *edgeResolver) Cursor() string {
+	return parser.CursorOf(*e.tx)
+}
+
+func (e *edgeResolver) Node() *transactionResolver {
+	return &transactionResolver{tx: e.tx}
+}
+
+type transferConnectionResolver struct {
+	edges   []*transferEdgeResolver
+	hasNext bool
+}
+
+func (c *transferConnectionResolver) Edges() []*transferEdgeResolver {
+	return c.edges
+}
+
+func (c *transferConnectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNext: c.hasNext}
+	if len(c.edges) > 0 {
+		p.endCursor = c.edges[len(c.edges)-1].Cursor()
+	}
+	return p
+}
+
+type transferEdgeResolver struct {
+	transfer *parser.Transfer
+}
+
+func (e *transferEdgeResolver) Cursor() string {
+	return parser.CursorOfTransfer(*e.transfer)
+}
+
+func (e *transferEdgeResolver) Node() *transferResolver {
+	return &transferResolver{transfer: e.transfer.TokenTransfer, tx: &e.transfer.Transaction}
+}
+
+type pageInfoResolver struct {
+	endCursor string
+	hasNext   bool
+}
+
+func (p *pageInfoResolver) EndCursor() *string {
+	if p.endCursor == "" {
+		return nil
+	}
+	return &p.endCursor
+}
+
+func (p *pageInfoResolver) HasNextPage() bool {
+	return p.hasNext
+}
+
+type transactionResolver struct {
+	tx *parser.Transaction
+}
+
+func (t *transactionResolver) Hash() string     { return t.tx.Hash }
+func (t *transactionResolver) From() string     { return t.tx.From }
+func (t *transactionResolver) To() string       { return t.tx.To }
+func (t *transactionResolver) Value() string    { return t.tx.Value }
+func (t *transactionResolver) Status() string   { return t.tx.Status }
+func (t *transactionResolver) Gas() string      { return t.tx.Gas }
+func (t *transactionResolver) GasPrice() string { return t.tx.GasPrice }
+func (t *transactionResolver) Timestamp() int32 { return int32(t.tx.Timestamp) }
+
+func (t *transactionResolver) Block() *blockResolver {
+	if t.tx.BlockNumber == nil {
+		return nil
+	}
+	return &blockResolver{number: t.tx.BlockNumber.Int64(), hash: t.tx.BlockHash}
+}
+
+func (t *transactionResolver) Transfers() []*transferResolver {
+	transfers := make([]*transferResolver, 0, len(t.tx.Transfers))
+	for _, transfer := range t.tx.Transfers {
+		transfers = append(transfers, &transferResolver{transfer: transfer, tx: t.tx})
+	}
+	return transfers
+}
+
+type transferResolver struct {
+	transfer parser.TokenTransfer
+	tx       *parser.Transaction
+}
+
+func (t *transferResolver) Token() string    { return t.transfer.Token }
+func (t *transferResolver) Standard() string { return t.transfer.Standard }
+func (t *transferResolver) From() string     { return t.transfer.From }
+func (t *transferResolver) To() string       { return t.transfer.To }
+func (t *transferResolver) Value() string    { return t.transfer.Value }
+
+func (t *transferResolver) TokenID() *string {
+	if t.transfer.TokenID == "" {
+		return nil
+	}
+	return &t.transfer.TokenID
+}
+
+func (t *transferResolver) Transaction() *transactionResolver {
+	return &transactionResolver{tx: t.tx}
+}
+
+type blockResolver struct {
+	number int64
+	hash   string
+}
+
+func (b *blockResolver) Number() int32 {
+	return int32(b.number)
+}
+
+func (b *blockResolver) Hash() *string {
+	if b.hash == "" {
+		return nil
+	}
+	return &b.hash
+}
+
+type eventResolver struct {
+	msg events.Message
+}
+
+func (e *eventResolver) Seq() graphql.ID {
+	return graphql.ID(strconv.FormatUint(e.msg.Seq, 10))
+}
+
+func (e *eventResolver) ID() graphql.ID {
+	return graphql.ID(e.msg.Event.Key())
+}
+
+func (e *eventResolver) Type() string {
+	return string(e.msg.Event.Type)
+}
+
+func (e *eventResolver) Address() *string {
+	if e.msg.Event.Address == "" {
+		return nil
+	}
+	return &e.msg.Event.Address
+}
+
+func (e *eventResolver) Block() *blockResolver {
+	return &blockResolver{number: int64(e.msg.Event.Block), hash: e.msg.Event.BlockHash}
+}
+
+func (e *eventResolver) Confirmations() *int32 {
+	if e.msg.Event.Confirmations == 0 {
+		return nil
+	}
+	n := int32(e.msg.Event.Confirmations)
+	return &n
+}
+
+func (e *eventResolver) Status() *string {
+	if e.msg.Event.Status == "" {
+		return nil
+	}
+	return &e.msg.Event.Status
+}
+
+func (e *eventResolver) Transfer() *transferResolver {
+	if e.msg.Event.Transfer == nil || e.msg.Event.Transaction == nil {
+		return nil
+	}
+	return &transferResolver{transfer: *e.msg.Event.Transfer, tx: e.msg.Event.Transaction}
+}
+
+func (e *eventResolver) Fork() *int32 {
+	if e.msg.Event.Type != parser.EventReorg {
+		return nil
+	}
+	n := int32(e.msg.Event.Fork)
+	return &n
+}
+
+func (e *eventResolver) Transaction() *transactionResolver {
+	if e.msg.Event.Transaction == nil {
+		return nil
+	}
+	return &transactionResolver{tx: e.msg.Event.Transaction}
+}
@@ -0,0 +1,244 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Subprotocol is the WebSocket subprotocol spoken by the subscriptions endpoint.
+const Subprotocol = "graphql-transport-ws"
+
+// Limits of a subscriptions connection.
+const (
+	wsMaxMessage    = 64 * 1024        // size of a client message
+	wsMaxOperations = 16               // operations running at once on a connection
+	wsInitWait      = 10 * time.Second // time allowed to send connection_init
+	wsWriteWait     = 10 * time.Second // time allowed to write a message
+	wsPongWait      = 60 * time.Second // time allowed between two pongs
+	wsPingInterval  = wsPongWait / 2   // how often the server pings
+	wsOutBuffer     = 64               // messages waiting to be written
+)
+
+// Message types of the graphql-transport-ws protocol.
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// Close codes of the graphql-transport-ws protocol.
+const (
+	closeInvalidMessage     = 4400
+	closeInitTimeout        = 4408
+	closeSubscriberExists   = 4409
+	closeTooManyInitRequest = 4429
+)
+
+// wsMessage is a message of the graphql-transport-ws protocol, in either direction.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsRequest is the payload of a subscribe message.
+type wsRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// serveWS runs the operations of a client over the graphql-transport-ws protocol until the connection fails.
+// Every operation is executed as a subscription, so queries and mutations get a single next message.
+func (h *Handler) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an HTTP error
+		h.Log.Debugw("graphql", "status", "upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != Subprotocol {
+		wsClose(conn, websocket.CloseProtocolError, "subprotocol is not supported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	out := make(chan wsMessage, wsOutBuffer)
+	done := make(chan struct{})
+	closing := make(chan *websocket.CloseError, 1)
+
+	// Read client messages until the connection fails
+	go func() {
+		defer close(done)
+
+		var (
+			mu      sync.Mutex
+			ops     = map[string]context.CancelFunc{}
+			initted bool
+		)
+		stop := func(code int, text string) {
+			closing <- &websocket.CloseError{Code: code, Text: text}
+		}
+		send := func(msg wsMessage) bool {
+			select {
+			case out <- msg:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		conn.SetReadLimit(wsMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(wsInitWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+
+		for {
+			var msg wsMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				if !initted {
+					if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+						stop(closeInitTimeout, "connection initialisation timeout")
+					}
+				}
+				return
+			}
+
+			switch msg.Type {
+			case msgConnectionInit:
+				if initted {
+					stop(closeTooManyInitRequest, "too many initialisation requests")
+					return
+				}
+				initted = true
+				conn.SetReadDeadline(time.Now().Add(wsPongWait))
+				send(wsMessage{Type: msgConnectionAck})
+
+			case msgPing:
+				send(wsMessage{Type: msgPong})
+
+			case msgPong:
+
+			case msgSubscribe:
+				var req wsRequest
+				if !initted {
+					stop(websocket.ClosePolicyViolation, "unauthorized")
+					return
+				}
+				if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+					stop(closeInvalidMessage, "subscribe message is invalid")
+					return
+				}
+
+				mu.Lock()
+				if _, ok := ops[msg.ID]; ok {
+					mu.Unlock()
+					stop(closeSubscriberExists, "subscriber for "+msg.ID+" already exists")
+					return
+				}
+				if len(ops) >= wsMaxOperations {
+					mu.Unlock()
+					payload, _ := json.Marshal([]map[string]string{{"message": "too many operations"}})
+					send(wsMessage{ID: msg.ID, Type: msgError, Payload: payload})
+					continue
+				}
+				opCtx, opCancel := context.WithCancel(ctx)
+				ops[msg.ID] = opCancel
+				mu.Unlock()
+
+				responses, err := h.schema.Subscribe(opCtx, req.Query, req.OperationName, req.Variables)
+				if err != nil {
+					opCancel()
+					mu.Lock()
+					delete(ops, msg.ID)
+					mu.Unlock()
+					payload, _ := json.Marshal([]map[string]string{{"message": err.Error()}})
+					send(wsMessage{ID: msg.ID, Type: msgError, Payload: payload})
+					continue
+				}
+
+				go func(id string) {
+					defer func() {
+						mu.Lock()
+						cancel, ok := ops[id]
+						delete(ops, id)
+						mu.Unlock()
+						// An operation the client completed needs no complete message back
+						if ok {
+							cancel()
+							send(wsMessage{ID: id, Type: msgComplete})
+						}
+					}()
+
+					for resp := range responses {
+						payload, err := json.Marshal(resp)
+						if err != nil {
+							h.Log.Errorw("graphql", "status", "encoding response", "error", err)
+							continue
+						}
+						if !send(wsMessage{ID: id, Type: msgNext, Payload: payload}) {
+							return
+						}
+					}
+				}(msg.ID)
+
+			case msgComplete:
+				mu.Lock()
+				if cancel, ok := ops[msg.ID]; ok {
+					cancel()
+					delete(ops, msg.ID)
+				}
+				mu.Unlock()
+
+			default:
+				stop(closeInvalidMessage, "message type is invalid")
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			select {
+			case ce := <-closing:
+				wsClose(conn, ce.Code, ce.Text)
+			default:
+			}
+			return
+
+		case <-ping.C:
+			if err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+
+		case msg := <-out:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err = conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wsClose sends a close frame within the write deadline.
+func wsClose(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+}
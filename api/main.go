@@ -2,53 +2,149 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	"trustwallet/api/gql"
+	"trustwallet/api/rpc"
 	"trustwallet/api/server"
-	"trustwallet/business/logger"
+	"trustwallet/business/auth"
+	"trustwallet/business/broker"
+	"trustwallet/business/events"
+	"trustwallet/business/metrics"
+	"trustwallet/business/notify"
 	"trustwallet/business/parser"
+	"trustwallet/business/ratelimit"
 	"trustwallet/business/storage"
+	"trustwallet/business/tracing"
+	"trustwallet/business/webhook"
 )
 
-// config is used to represent runtime configuration.
-type config struct {
-	ethereumGatewayURL string
+// newNotifiers constructs the notifiers of the configured channels.
+func newNotifiers(log *zap.SugaredLogger) map[string]notify.Notifier {
+	notifiers := map[string]notify.Notifier{
+		notify.ChannelLog: notify.NewLogNotifier(log),
+	}
+
+	if cfg.Notify.SMTPAddr != "" {
+		var auth smtp.Auth
+		if cfg.Notify.SMTPUsername != "" {
+			host, _, _ := strings.Cut(cfg.Notify.SMTPAddr, ":")
+			auth = smtp.PlainAuth("", cfg.Notify.SMTPUsername, cfg.Notify.SMTPPassword, host)
+		}
+		notifiers[notify.ChannelEmail] = notify.NewSMTPNotifier(cfg.Notify.SMTPAddr, cfg.Notify.SMTPFrom, auth)
+	}
+
+	if cfg.Notify.PushEndpoint != "" {
+		notifiers[notify.ChannelPush] = notify.NewPushNotifier(cfg.Notify.PushEndpoint, cfg.Notify.PushServerKey, nil)
+	}
+
+	return notifiers
+}
+
+// newBroker connects to the configured message broker.
+func newBroker() (broker.Broker, error) {
+	switch cfg.Broker.Kind {
+	case "nats":
+		url := strings.Join(cfg.Broker.URLs, ",")
+		if url == "" {
+			url = nats.DefaultURL
+		}
+		return broker.NewNATS(url, cfg.Broker.Stream, []string{cfg.Broker.Prefix + ".>"})
+	case "kafka":
+		return broker.NewKafka(cfg.Broker.URLs), nil
+	}
+
+	return nil, fmt.Errorf("unknown broker %q", cfg.Broker.Kind)
 }
 
-// cfg provides parsed runtime configuration as a convenient global variable.
-var cfg config
+// newKeys constructs the API keys, nil when authentication is disabled.
+func newKeys() (*auth.Keys, error) {
+	if cfg.Auth.AdminKey == "" && len(cfg.Auth.APIKeys) == 0 {
+		return nil, nil
+	}
 
-func init() {
-	cfg.ethereumGatewayURL = os.Getenv("ETHEREUM_GATEWAY_URL")
-	if cfg.ethereumGatewayURL == "" {
-		// I created this project on Infura (https://app.infura.io/dashboard) to help speed up testing the service
-		cfg.ethereumGatewayURL = "https://mainnet.infura.io/v3/3b7ef887e2b244b9b0bd9b2a0c36cdf1"
+	// The pairs were checked by config.validate
+	keys := auth.NewKeys()
+	for _, pair := range cfg.Auth.APIKeys {
+		tenant, secret, _ := strings.Cut(pair, ":")
+		if _, err := keys.Add(tenant, secret); err != nil {
+			return nil, fmt.Errorf("API key of %s: %w", tenant, err)
+		}
 	}
+	return keys, nil
+}
+
+// newStorage constructs the storage backend used by every command.
+func newStorage() parser.Storage {
+	var store parser.Storage = storage.NewMemoryStorage()
+	if cfg.Storage.CacheSize > 0 {
+		store = storage.NewCachedStorage(store, cfg.Storage.CacheSize)
+	}
+	return store
 }
 
 func main() {
-	// Construct the application logger.
-	log, err := logger.New("API")
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// Pick the subcommand, serving the API when none is given.
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
-	defer log.Sync()
 
-	// Perform the startup and shutdown sequence.
-	if err = run(log); err != nil {
-		log.Errorw("startup", "ERROR", err)
-		log.Sync()
+	var err error
+	switch cmd {
+	case "serve":
+		// Perform the startup and shutdown sequence.
+		err = run(args)
+	case "export":
+		err = exportCmd(args)
+	case "import":
+		err = importCmd(args)
+	case "backfill":
+		err = backfillCmd(args)
+	case "reindex":
+		err = reindexCmd(args)
+	case "subscriptions":
+		err = subscriptionsCmd(args)
+	case "inspect-block":
+		err = inspectBlockCmd(args)
+	default:
+		err = fmt.Errorf("unknown command %q, expected serve, export, import, backfill, reindex, subscriptions or inspect-block", cmd)
+	}
+
+	// The flag set already printed the help, or why the flags are invalid
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
 		os.Exit(1)
 	}
 }
 
-func run(log *zap.SugaredLogger) error {
+func run(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	restore := flags.String("restore", "", "snapshot file to load into the storage before polling starts")
+	dump := flags.String("dump", "", "snapshot file to write the storage to on shutdown")
+
+	// Construct the application logger at the configured level.
+	log, err := load(flags, args, true)
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
 	// =========================================================================
 	// Start API Service
 
@@ -59,30 +155,175 @@ func run(log *zap.SugaredLogger) error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
+	// Background tasks stop once the service shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Export the traces of the requests and of the block processing, if configured
+	if cfg.Tracing.Endpoint != "" {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return fmt.Errorf("constructing trace exporter: %w", err)
+		}
+		provider := tracing.Setup(tracing.Config{ServiceName: cfg.Tracing.ServiceName, SampleRatio: cfg.Tracing.SampleRatio}, exporter)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			provider.Shutdown(ctx)
+		}()
+		log.Infow("startup", "status", "tracing enabled", "endpoint", cfg.Tracing.Endpoint, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
 	// Initialize Ethereum Parser
-	ethereumParser := parser.NewEthereumParser(storage.NewMemoryStorage(), cfg.ethereumGatewayURL, 5, log)
+	store := newStorage()
+	if cache, ok := store.(*storage.CachedStorage); ok {
+		registerCacheMetrics(cache)
+	}
+	store = storage.NewInstrumentedStorage(store)
+	metrics.GaugeFunc("subscribers", "Addresses at least one tenant is subscribed to.", func() float64 {
+		return float64(len(store.Subscribers()))
+	})
+	if *restore != "" {
+		if err := restoreSnapshot(log, store, *restore); err != nil {
+			return err
+		}
+	}
+	ethereumParser := parser.NewEthereumParser(store, cfg.RPC.URL, cfg.RPC.PollInterval, log)
+	ethereumParser.SetConfirmations(cfg.RPC.Confirmations)
+	ethereumParser.SetFinality(cfg.RPC.Finality)
+	ethereumParser.SetSubscriptionLimit(cfg.Limits.MaxSubscriptions)
+
+	// Fan the parser events out to the live streams, the GraphQL subscriptions and the gRPC streams
+	bus := events.NewBus(cfg.Events.History)
+	ethereumParser.AddPublisher(bus)
+
+	// Deliver the parser events to the registered webhooks
+	var dispatcher *webhook.Dispatcher
+	if cfg.Features.Webhooks {
+		dispatcher = webhook.NewDispatcher(webhook.Config{Subscriptions: ethereumParser, MaxWebhooks: cfg.Limits.MaxWebhooks}, log)
+		go dispatcher.Run(ctx)
+		ethereumParser.AddPublisher(dispatcher)
+	}
+
+	// Notify users about their addresses through the configured channels
+	var notifications *notify.Service
+	if cfg.Features.Notifications {
+		notifications = notify.NewService(newNotifiers(log), 1000, ethereumParser, log)
+		go notifications.Run(ctx)
+		ethereumParser.AddPublisher(notifications)
+	}
+
+	// Relay the parser events to the message broker, if any
+	if cfg.Broker.Kind != "" {
+		b, err := newBroker()
+		if err != nil {
+			return fmt.Errorf("connecting to broker: %w", err)
+		}
+		defer b.Close()
+
+		outbox := broker.NewOutbox(b, broker.Config{Prefix: cfg.Broker.Prefix, Storage: store}, log)
+		registerOutboxMetrics(outbox)
+		go outbox.Run(ctx)
+
+		// Resend the events the broker had not acknowledged before the last shutdown, then relay the new ones. The
+		// parser processes no block meanwhile, which runs in the background since the outbox holds the replay back
+		// while the broker is unreachable.
+		from, ok := parser.Position(store, broker.Position)
+		if cfg.Broker.ReplayFrom >= 0 {
+			from, ok = cfg.Broker.ReplayFrom, true
+		}
+		if !ok {
+			from = store.Checkpoint()
+		}
+		go func() {
+			log.Infow("startup", "status", "relaying events", "from", from, "replayed", ethereumParser.AddPublisherAfter(outbox, from))
+		}()
+	}
+
+	// Start enforcing the retention policy, if any
+	retention := parser.RetentionPolicy{
+		MaxAge:        cfg.Retention.MaxAge,
+		MaxBlocks:     cfg.Retention.MaxBlocks,
+		MaxPerAddress: cfg.Retention.MaxRecords,
+	}
+	if retention.Enabled() {
+		log.Infow("startup", "status", "retention enabled", "policy", retention, "interval", cfg.Retention.PruneInterval)
+		pruner := parser.NewPruner(store, retention, cfg.Retention.PruneInterval, log)
+		registerPrunerMetrics(pruner)
+		go pruner.Run(ctx)
+	}
+
+	// Require API keys on every endpoint, if configured
+	keys, err := newKeys()
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		log.Warnw("startup", "status", "authentication disabled, set ADMIN_API_KEY to require API keys")
+	}
+
+	// Rate limit the clients of the HTTP API, if configured
+	var ipLimit, keyLimit *ratelimit.Limiter
+	if cfg.Limits.IPRate > 0 {
+		ipLimit = ratelimit.New(cfg.Limits.IPRate, cfg.Limits.IPBurst)
+		go ipLimit.Run(ctx, time.Minute)
+	}
+	if cfg.Limits.KeyRate > 0 && keys != nil {
+		keyLimit = ratelimit.New(cfg.Limits.KeyRate, cfg.Limits.KeyBurst)
+		go keyLimit.Run(ctx, time.Minute)
+	}
 
-	// Construct the mux for the API calls.
-	apiMux := server.APIMux(server.APIMuxConfig{
-		Ctx:      context.Background(),
+	// Construct the mux for the API calls, with the optional endpoints that are enabled.
+	muxConfig := server.APIMuxConfig{
+		Ctx:      ctx,
 		Shutdown: shutdown,
 		Log:      log,
 		Parser:   ethereumParser,
-	})
+		Webhooks: dispatcher,
+		Notify:   notifications,
+		Keys:     keys,
+		AdminKey: cfg.Auth.AdminKey,
+		LogLevel: &logLevel,
+		Storage:  store,
+		IPLimit:  ipLimit,
+		KeyLimit: keyLimit,
+		MaxLag:   cfg.HTTP.ReadyMaxLag,
+		CORS:     server.CORSConfig{AllowedOrigins: cfg.HTTP.CORSOrigins, MaxAge: cfg.HTTP.CORSMaxAge},
+	}
+	if cfg.Features.Streams {
+		muxConfig.Events = bus
+	}
+	if cfg.Features.Metrics {
+		muxConfig.Metrics = metrics.Handler()
+	}
+	if cfg.Features.GraphQL {
+		// The GraphQL endpoint shares the parser and event bus.
+		graphQL, err := gql.NewHandler(gql.Config{
+			Log:         log,
+			Parser:      ethereumParser,
+			Events:      bus,
+			CheckOrigin: muxConfig.CORS.CheckOrigin,
+		})
+		if err != nil {
+			return fmt.Errorf("constructing graphql handler: %w", err)
+		}
+		muxConfig.GraphQL = graphQL
+	}
+	apiMux := server.APIMux(muxConfig)
 
 	// Construct a server to service the requests against the mux.
 	api := http.Server{
-		Addr:         "0.0.0.0:8080",
+		Addr:         cfg.HTTP.Addr,
 		Handler:      apiMux,
-		ReadTimeout:  time.Second * 5, //cfg.Web.ReadTimeout,
-		WriteTimeout: time.Second * 10,
-		IdleTimeout:  time.Second * 120,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
 		ErrorLog:     zap.NewStdLog(log.Desugar()),
 	}
 
 	// Make a channel to listen for errors coming from the listener. Use a
 	// buffered channel so the goroutine can exit if we don't collect this error.
-	serverErrors := make(chan error, 1)
+	serverErrors := make(chan error, 2)
 
 	// Start the service listening for server requests.
 	go func() {
@@ -90,6 +331,27 @@ func run(log *zap.SugaredLogger) error {
 		serverErrors <- api.ListenAndServe()
 	}()
 
+	// Construct the gRPC server sharing the parser, event bus and logger of the REST API.
+	grpcServer := rpc.NewServer(rpc.Config{
+		Log:    log,
+		Parser: ethereumParser,
+		Events: bus,
+		Keys:   keys,
+	})
+
+	// Start the gRPC service listening for requests, if enabled.
+	if cfg.Features.GRPC {
+		go func() {
+			log.Infow("startup", "status", "grpc server started", "host", cfg.GRPC.Addr)
+			lis, err := net.Listen("tcp", cfg.GRPC.Addr)
+			if err != nil {
+				serverErrors <- err
+				return
+			}
+			serverErrors <- grpcServer.Serve(lis)
+		}()
+	}
+
 	// =========================================================================
 	// Shutdown
 
@@ -103,14 +365,27 @@ func run(log *zap.SugaredLogger) error {
 		defer log.Infow("shutdown", "status", "shutdown complete", "signal", sig)
 
 		// Give outstanding requests a deadline for completion.
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 		defer cancel()
 
+		// Let the gRPC calls finish within the same deadline, streams are cut when it expires.
+		go func() {
+			<-ctx.Done()
+			grpcServer.Stop()
+		}()
+		grpcServer.GracefulStop()
+
 		// Asking listener to shut down and shed load.
 		if err := api.Shutdown(ctx); err != nil {
 			api.Close()
 			return fmt.Errorf("could not stop server gracefully: %w", err)
 		}
+
+		if *dump != "" {
+			if err := dumpSnapshot(log, store, *dump); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"trustwallet/business/broker"
+	"trustwallet/business/metrics"
+	"trustwallet/business/parser"
+	"trustwallet/business/storage"
+)
+
+// registerCacheMetrics exposes the figures of the storage cache.
+func registerCacheMetrics(cache *storage.CachedStorage) {
+	stat := func(field func(storage.CacheStats) int) func() float64 {
+		return func() float64 { return float64(field(cache.Stats())) }
+	}
+
+	metrics.CounterFunc("cache_hits_total", "Transaction reads answered by the storage cache.", stat(func(s storage.CacheStats) int { return s.Hits }))
+	metrics.CounterFunc("cache_misses_total", "Transaction reads that went through to the storage.", stat(func(s storage.CacheStats) int { return s.Misses }))
+	metrics.CounterFunc("cache_evictions_total", "Addresses evicted from the storage cache.", stat(func(s storage.CacheStats) int { return s.Evictions }))
+	metrics.GaugeFunc("cache_entries", "Addresses held by the storage cache.", stat(func(s storage.CacheStats) int { return s.Entries }))
+	metrics.GaugeFunc("cache_transactions", "Transactions held by the storage cache, which bounds them.", stat(func(s storage.CacheStats) int { return s.Transactions }))
+}
+
+// registerPrunerMetrics exposes the figures of the retention pruner.
+func registerPrunerMetrics(pruner *parser.Pruner) {
+	metrics.CounterFunc("prune_runs_total", "Runs of the retention pruner.", func() float64 {
+		return float64(pruner.Metrics().Runs)
+	})
+	metrics.CounterFunc("pruned_transactions_total", "Transactions removed by the retention pruner.", func() float64 {
+		return float64(pruner.Metrics().Removed)
+	})
+}
+
+// registerOutboxMetrics exposes the figures of the broker outbox.
+func registerOutboxMetrics(outbox *broker.Outbox) {
+	metrics.GaugeFunc("broker_pending_blocks", "Blocks waiting to be relayed to the message broker.", func() float64 {
+		pending, _ := outbox.Stats()
+		return float64(pending)
+	})
+	metrics.CounterFunc("broker_backpressure_waits_total", "Times the parser waited for the broker because too many blocks were pending.", func() float64 {
+		_, waits := outbox.Stats()
+		return float64(waits)
+	})
+	metrics.GaugeFunc("broker_published_block", "Last block whose events were all acknowledged by the broker.", func() float64 {
+		return float64(outbox.Published())
+	})
+}
@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: parser.proto
+
+package parserpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ParserService_GetCurrentBlock_FullMethodName = "/ethparser.v1.ParserService/GetCurrentBlock"
+	ParserService_Subscribe_FullMethodName       = "/ethparser.v1.ParserService/Subscribe"
+	ParserService_Unsubscribe_FullMethodName     = "/ethparser.v1.ParserService/Unsubscribe"
+	ParserService_GetTransactions_FullMethodName = "/ethparser.v1.ParserService/GetTransactions"
+	ParserService_WatchAddress_FullMethodName    = "/ethparser.v1.ParserService/WatchAddress"
+)
+
+// ParserServiceClient is the client API for ParserService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ParserServiceClient interface {
+	// GetCurrentBlock returns the last parsed block number.
+	GetCurrentBlock(ctx context.Context, in *GetCurrentBlockRequest, opts ...grpc.CallOption) (*GetCurrentBlockResponse, error)
+	// Subscribe adds an address to the observed ones.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*SubscribeResponse, error)
+	// Unsubscribe stops observing an address, purging its stored transactions if asked to.
+	Unsubscribe(ctx context.Context, in *UnsubscribeRequest, opts ...grpc.CallOption) (*UnsubscribeResponse, error)
+	// GetTransactions returns a filtered page of the transactions of an address, oldest first.
+	GetTransactions(ctx context.Context, in *GetTransactionsRequest, opts ...grpc.CallOption) (*GetTransactionsResponse, error)
+	// WatchAddress streams the events of an address as the parser ingests them.
+	// The stream ends with NotFound once the address is unsubscribed.
+	WatchAddress(ctx context.Context, in *WatchAddressRequest, opts ...grpc.CallOption) (ParserService_WatchAddressClient, error)
+}
+
+type parserServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewParserServiceClient(cc grpc.ClientConnInterface) ParserServiceClient {
+	return &parserServiceClient{cc}
+}
+
+func (c *parserServiceClient) GetCurrentBlock(ctx context.Context, in *GetCurrentBlockRequest, opts ...grpc.CallOption) (*GetCurrentBlockResponse, error) {
+	out := new(GetCurrentBlockResponse)
+	err := c.cc.Invoke(ctx, ParserService_GetCurrentBlock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parserServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*SubscribeResponse, error) {
+	out := new(SubscribeResponse)
+	err := c.cc.Invoke(ctx, ParserService_Subscribe_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parserServiceClient) Unsubscribe(ctx context.Context, in *UnsubscribeRequest, opts ...grpc.CallOption) (*UnsubscribeResponse, error) {
+	out := new(UnsubscribeResponse)
+	err := c.cc.Invoke(ctx, ParserService_Unsubscribe_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parserServiceClient) GetTransactions(ctx context.Context, in *GetTransactionsRequest, opts ...grpc.CallOption) (*GetTransactionsResponse, error) {
+	out := new(GetTransactionsResponse)
+	err := c.cc.Invoke(ctx, ParserService_GetTransactions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *parserServiceClient) WatchAddress(ctx context.Context, in *WatchAddressRequest, opts ...grpc.CallOption) (ParserService_WatchAddressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ParserService_ServiceDesc.Streams[0], ParserService_WatchAddress_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &parserServiceWatchAddressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ParserService_WatchAddressClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type parserServiceWatchAddressClient struct {
+	grpc.ClientStream
+}
+
+func (x *parserServiceWatchAddressClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParserServiceServer is the server API for ParserService service.
+// All implementations must embed UnimplementedParserServiceServer
+// for forward compatibility
+type ParserServiceServer interface {
+	// GetCurrentBlock returns the last parsed block number.
+	GetCurrentBlock(context.Context, *GetCurrentBlockRequest) (*GetCurrentBlockResponse, error)
+	// Subscribe adds an address to the observed ones.
+	Subscribe(context.Context, *SubscribeRequest) (*SubscribeResponse, error)
+	// Unsubscribe stops observing an address, purging its stored transactions if asked to.
+	Unsubscribe(context.Context, *UnsubscribeRequest) (*UnsubscribeResponse, error)
+	// GetTransactions returns a filtered page of the transactions of an address, oldest first.
+	GetTransactions(context.Context, *GetTransactionsRequest) (*GetTransactionsResponse, error)
+	// WatchAddress streams the events of an address as the parser ingests them.
+	// The stream ends with NotFound once the address is unsubscribed.
+	WatchAddress(*WatchAddressRequest, ParserService_WatchAddressServer) error
+	mustEmbedUnimplementedParserServiceServer()
+}
+
+// UnimplementedParserServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedParserServiceServer struct {
+}
+
+func (UnimplementedParserServiceServer) GetCurrentBlock(context.Context, *GetCurrentBlockRequest) (*GetCurrentBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCurrentBlock not implemented")
+}
+func (UnimplementedParserServiceServer) Subscribe(context.Context, *SubscribeRequest) (*SubscribeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedParserServiceServer) Unsubscribe(context.Context, *UnsubscribeRequest) (*UnsubscribeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unsubscribe not implemented")
+}
+func (UnimplementedParserServiceServer) GetTransactions(context.Context, *GetTransactionsRequest) (*GetTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransactions not implemented")
+}
+func (UnimplementedParserServiceServer) WatchAddress(*WatchAddressRequest, ParserService_WatchAddressServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAddress not implemented")
+}
+func (UnimplementedParserServiceServer) mustEmbedUnimplementedParserServiceServer() {}
+
+// UnsafeParserServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ParserServiceServer will
+// result in compilation errors.
+type UnsafeParserServiceServer interface {
+	mustEmbedUnimplementedParserServiceServer()
+}
+
+func RegisterParserServiceServer(s grpc.ServiceRegistrar, srv ParserServiceServer) {
+	s.RegisterService(&ParserService_ServiceDesc, srv)
+}
+
+func _ParserService_GetCurrentBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCurrentBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParserServiceServer).GetCurrentBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParserService_GetCurrentBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParserServiceServer).GetCurrentBlock(ctx, req.(*GetCurrentBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParserService_Subscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubscribeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParserServiceServer).Subscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParserService_Subscribe_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParserServiceServer).Subscribe(ctx, req.(*SubscribeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParserService_Unsubscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnsubscribeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParserServiceServer).Unsubscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParserService_Unsubscribe_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParserServiceServer).Unsubscribe(ctx, req.(*UnsubscribeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParserService_GetTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParserServiceServer).GetTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ParserService_GetTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParserServiceServer).GetTransactions(ctx, req.(*GetTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ParserService_WatchAddress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAddressRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ParserServiceServer).WatchAddress(m, &parserServiceWatchAddressServer{stream})
+}
+
+type ParserService_WatchAddressServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type parserServiceWatchAddressServer struct {
+	grpc.ServerStream
+}
+
+func (x *parserServiceWatchAddressServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ParserService_ServiceDesc is the grpc.ServiceDesc for ParserService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ParserService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ethparser.v1.ParserService",
+	HandlerType: (*ParserServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCurrentBlock",
+			Handler:    _ParserService_GetCurrentBlock_Handler,
+		},
+		{
+			MethodName: "Subscribe",
+			Handler:    _ParserService_Subscribe_Handler,
+		},
+		{
+			MethodName: "Unsubscribe",
+			Handler:    _ParserService_Unsubscribe_Handler,
+		},
+		{
+			MethodName: "GetTransactions",
+			Handler:    _ParserService_GetTransactions_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAddress",
+			Handler:       _ParserService_WatchAddress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "parser.proto",
+}
@@ -0,0 +1,346 @@
+// Package rpc serves the parser over gRPC, next to the REST API of package server.
+//
+// The service is defined in proto/parser.proto, and parserpb is generated from it with protoc-gen-go and
+// protoc-gen-go-grpc:
+//
+//	protoc -I api/rpc/proto --go_out=api/rpc/parserpb --go_opt=paths=source_relative \
+//		--go-grpc_out=api/rpc/parserpb --go-grpc_opt=paths=source_relative parser.proto
+package rpc
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"math/big"
+	"time"
+	"trustwallet/api/rpc/parserpb"
+	"trustwallet/api/server"
+	"trustwallet/business/auth"
+	"trustwallet/business/events"
+	"trustwallet/business/parser"
+)
+
+// watchBuffer is the number of events a slow WatchAddress client may lag behind before its stream is ended.
+const watchBuffer = 64
+
+// Config contains all the mandatory systems required by the service. Calls must carry an API key in their
+// x-api-key or authorization metadata once Keys is set.
+type Config struct {
+	Log    *zap.SugaredLogger
+	Parser server.Parser
+	Events *events.Bus
+	Keys   *auth.Keys
+}
+
+// Service implements parserpb.ParserServiceServer over the same Parser as the REST handlers.
+type Service struct {
+	parserpb.UnimplementedParserServiceServer
+
+	parser server.Parser
+	events *events.Bus
+	Log    *zap.SugaredLogger
+}
+
+// NewServer constructs a gRPC server with the parser service registered and every call logged, and
+// authenticated when keys are configured.
+func NewServer(cfg Config) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{unaryLogger(cfg.Log)}
+	stream := []grpc.StreamServerInterceptor{streamLogger(cfg.Log)}
+	if cfg.Keys != nil {
+		unary = append(unary, unaryAuth(cfg.Keys))
+		stream = append(stream, streamAuth(cfg.Keys))
+	}
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	parserpb.RegisterParserServiceServer(srv, &Service{
+		parser: cfg.Parser,
+		events: cfg.Events,
+		Log:    cfg.Log,
+	})
+
+	return srv
+}
+
+func (s *Service) GetCurrentBlock(context.Context, *parserpb.GetCurrentBlockRequest) (*parserpb.GetCurrentBlockResponse, error) {
+	return &parserpb.GetCurrentBlockResponse{CurrentBlock: uint64(s.parser.GetCurrentBlock())}, nil
+}
+
+func (s *Service) Subscribe(ctx context.Context, req *parserpb.SubscribeRequest) (*parserpb.SubscribeResponse, error) {
+	if err := validAddress(req.GetAddress()); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.parser.Subscribe(auth.Tenant(ctx), req.GetAddress())
+	if errors.Is(err, parser.ErrSubscriptionLimit) {
+		return nil, status.Error(codes.ResourceExhausted, "subscription limit reached")
+	}
+
+	return &parserpb.SubscribeResponse{Result: ok}, nil
+}
+
+func (s *Service) Unsubscribe(ctx context.Context, req *parserpb.UnsubscribeRequest) (*parserpb.UnsubscribeResponse, error) {
+	if err := validAddress(req.GetAddress()); err != nil {
+		return nil, err
+	}
+
+	return &parserpb.UnsubscribeResponse{Result: s.parser.Unsubscribe(auth.Tenant(ctx), req.GetAddress(), req.GetPurge())}, nil
+}
+
+func (s *Service) GetTransactions(ctx context.Context, req *parserpb.GetTransactionsRequest) (*parserpb.GetTransactionsResponse, error) {
+	if err := validAddress(req.GetAddress()); err != nil {
+		return nil, err
+	}
+	until, ok := s.parser.History(auth.Tenant(ctx), req.GetAddress())
+	if !ok {
+		return nil, status.Error(codes.NotFound, "address is not subscribed")
+	}
+
+	q, err := transactionQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	q = q.UpTo(until)
+
+	txs, next, err := s.parser.QueryTransactions(req.GetAddress(), q)
+	if errors.Is(err, parser.ErrInvalidCursor) {
+		return nil, status.Error(codes.InvalidArgument, "cursor is invalid")
+	}
+	if err != nil {
+		s.Log.Errorw("querying transactions", "address", req.GetAddress(), "error", err)
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &parserpb.GetTransactionsResponse{
+		Transactions: make([]*parserpb.Transaction, 0, len(txs)),
+		NextCursor:   next,
+	}
+	for i := range txs {
+		resp.Transactions = append(resp.Transactions, toTransaction(&txs[i]))
+	}
+
+	return resp, nil
+}
+
+func (s *Service) WatchAddress(req *parserpb.WatchAddressRequest, stream parserpb.ParserService_WatchAddressServer) error {
+	if err := validAddress(req.GetAddress()); err != nil {
+		return err
+	}
+	if s.events == nil {
+		return status.Error(codes.Unavailable, "event stream is disabled")
+	}
+	if !s.parser.IsSubscribed(auth.Tenant(stream.Context()), req.GetAddress()) {
+		return status.Error(codes.NotFound, "address is not subscribed")
+	}
+
+	sub, missed := s.events.Subscribe(req.GetLastEventId(), watchBuffer, req.GetAddress())
+	defer s.events.Unsubscribe(sub)
+
+	tenant := auth.Tenant(stream.Context())
+	for _, msg := range missed {
+		if !s.parser.IsSubscribed(tenant, req.GetAddress()) {
+			return status.Error(codes.NotFound, "address is no longer subscribed")
+		}
+		if err := stream.Send(toEvent(msg)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "client is too slow, resume with last_event_id")
+			}
+			if !s.parser.IsSubscribed(tenant, req.GetAddress()) {
+				return status.Error(codes.NotFound, "address is no longer subscribed")
+			}
+			if err := stream.Send(toEvent(msg)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// validAddress rejects the addresses the REST handlers reject.
+func validAddress(address string) error {
+	if address == "" || address == "unknown" {
+		return status.Error(codes.InvalidArgument, "address is invalid")
+	}
+	return nil
+}
+
+// transactionQuery converts and validates the filters of a GetTransactions request.
+func transactionQuery(req *parserpb.GetTransactionsRequest) (parser.TransactionQuery, error) {
+	q := parser.TransactionQuery{
+		Limit:     int(req.GetLimit()),
+		Cursor:    req.GetCursor(),
+		Direction: parser.Direction(req.GetDirection()),
+		FromBlock: req.GetFromBlock(),
+		ToBlock:   req.GetToBlock(),
+		Since:     req.GetSince(),
+		Until:     req.GetUntil(),
+		Status:    req.GetStatus(),
+	}
+
+	switch q.Direction {
+	case "", parser.DirectionAll, parser.DirectionIn, parser.DirectionOut:
+	default:
+		return q, status.Error(codes.InvalidArgument, "direction is invalid")
+	}
+	switch q.Status {
+	case "", parser.TransactionSuccess, parser.TransactionFailed:
+	default:
+		return q, status.Error(codes.InvalidArgument, "status is invalid")
+	}
+	if q.Limit < 0 || q.Limit > parser.MaxQueryLimit {
+		return q, status.Error(codes.InvalidArgument, "limit is invalid")
+	}
+	if q.FromBlock < 0 || q.ToBlock < 0 || q.Since < 0 || q.Until < 0 {
+		return q, status.Error(codes.InvalidArgument, "range is invalid")
+	}
+	if v := req.GetMinValue(); v != "" {
+		n, ok := new(big.Int).SetString(v, 0)
+		if !ok || n.Sign() < 0 {
+			return q, status.Error(codes.InvalidArgument, "min_value is invalid")
+		}
+		q.MinValue = n
+	}
+
+	return q, nil
+}
+
+// toTransaction converts a parser transaction to its protobuf message.
+func toTransaction(tx *parser.Transaction) *parserpb.Transaction {
+	pb := &parserpb.Transaction{
+		Hash:      tx.Hash,
+		From:      tx.From,
+		To:        tx.To,
+		Value:     tx.Value,
+		Status:    tx.Status,
+		Gas:       tx.Gas,
+		GasPrice:  tx.GasPrice,
+		BlockHash: tx.BlockHash,
+		Timestamp: tx.Timestamp,
+	}
+	if tx.BlockNumber != nil {
+		pb.BlockNumber = tx.BlockNumber.Uint64()
+	}
+	for i := range tx.Transfers {
+		pb.Transfers = append(pb.Transfers, toTransfer(&tx.Transfers[i]))
+	}
+	return pb
+}
+
+// toTransfer converts a token transfer to its protobuf message.
+func toTransfer(t *parser.TokenTransfer) *parserpb.TokenTransfer {
+	return &parserpb.TokenTransfer{
+		Token:    t.Token,
+		Standard: t.Standard,
+		From:     t.From,
+		To:       t.To,
+		Value:    t.Value,
+		TokenId:  t.TokenID,
+		LogIndex: uint32(t.LogIndex),
+	}
+}
+
+// toEvent converts a bus message to its protobuf message.
+func toEvent(msg events.Message) *parserpb.Event {
+	e := msg.Event
+	pb := &parserpb.Event{
+		Seq:           msg.Seq,
+		Id:            e.Key(),
+		Type:          string(e.Type),
+		Address:       e.Address,
+		Block:         uint64(e.Block),
+		BlockHash:     e.BlockHash,
+		Confirmations: uint32(e.Confirmations),
+		Status:        e.Status,
+		Fork:          uint64(e.Fork),
+	}
+	if e.Transaction != nil {
+		pb.Transaction = toTransaction(e.Transaction)
+	}
+	if e.Transfer != nil {
+		pb.Transfer = toTransfer(e.Transfer)
+	}
+	return pb
+}
+
+// unaryLogger logs every unary call with its duration and status code.
+func unaryLogger(log *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		log.Infow("grpc", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+		return resp, err
+	}
+}
+
+// streamLogger logs every streaming call once it ends.
+func streamLogger(log *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		log.Infow("grpc", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+		return err
+	}
+}
+
+// unaryAuth rejects the calls without an active API key, and passes the tenant of the key on to the service.
+func unaryAuth(keys *auth.Keys) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamAuth is unaryAuth for streaming calls.
+func streamAuth(keys *auth.Keys) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), keys)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate returns ctx carrying the tenant of the API key found in its metadata.
+func authenticate(ctx context.Context, keys *auth.Keys) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	key, ok := keys.Authenticate(auth.FromHeader(first("x-api-key"), first("authorization")))
+	if !ok {
+		return ctx, status.Error(codes.Unauthenticated, "api key is missing or invalid")
+	}
+	return auth.WithKey(ctx, key), nil
+}
+
+// tenantStream overrides the context of a stream with one carrying the tenant.
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+	"trustwallet/api/rpc/parserpb"
+	"trustwallet/business/events"
+	"trustwallet/business/parser"
+	"trustwallet/business/storage"
+)
+
+// Define a test of the gRPC service over an in-memory connection
+func TestService(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	store := storage.NewMemoryStorage()
+	store.AddTransaction("0x123", parser.Transaction{Hash: "0xaaa", From: "0x123", To: "0x456", Value: "0x1", BlockNumber: big.NewInt(7)})
+	bus := events.NewBus(10)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(Config{
+		Log:    log,
+		Parser: parser.NewEthereumParser(store, "http://127.0.0.1:0", time.Hour, log),
+		Events: bus,
+	})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+	client := parserpb.NewParserServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := client.Subscribe(ctx, &parserpb.SubscribeRequest{Address: "0x123"})
+	if err != nil || !sub.GetResult() {
+		t.Fatalf("Subscribe returned %v, %v, expected true", sub, err)
+	}
+	if _, err = client.Subscribe(ctx, &parserpb.SubscribeRequest{Address: "unknown"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Subscribe returned %v, expected InvalidArgument", err)
+	}
+
+	txs, err := client.GetTransactions(ctx, &parserpb.GetTransactionsRequest{Address: "0x123", Direction: "out", Limit: 10})
+	if err != nil || len(txs.GetTransactions()) != 1 || txs.GetTransactions()[0].GetBlockNumber() != 7 {
+		t.Fatalf("GetTransactions returned %v, %v, expected the transaction of block 7", txs, err)
+	}
+	if _, err = client.GetTransactions(ctx, &parserpb.GetTransactionsRequest{Address: "0x123", Direction: "up"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetTransactions returned %v, expected InvalidArgument", err)
+	}
+
+	// Replay an event published before the call, then receive a live one
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 8})
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 9})
+	stream, err := client.WatchAddress(ctx, &parserpb.WatchAddressRequest{Address: "0x123", LastEventId: 1})
+	if err != nil {
+		t.Fatalf("WatchAddress returned error: %v", err)
+	}
+	e, err := stream.Recv()
+	if err != nil || e.GetBlock() != 9 || e.GetSeq() != 2 {
+		t.Fatalf("received %v, %v, expected the event of block 9", e, err)
+	}
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 10})
+	if e, err = stream.Recv(); err != nil || e.GetBlock() != 10 {
+		t.Fatalf("received %v, %v, expected the event of block 10", e, err)
+	}
+
+	// Confirmations, statuses, transfers and forks are carried along
+	transfer := parser.TokenTransfer{Token: "0xc0", Standard: parser.StandardERC721, From: "0x456", To: "0x123", Value: "0x1", TokenID: "0x7", LogIndex: 2}
+	tx := parser.Transaction{Hash: "0xbbb", From: "0x456", To: "0xc0", BlockNumber: big.NewInt(10), Transfers: []parser.TokenTransfer{transfer}}
+	bus.Publish(parser.Event{Type: parser.EventStatus, Address: "0x123", Block: 12, Transaction: &tx, Confirmations: 3, Status: parser.StatusConfirmed})
+	bus.Publish(parser.Event{Type: parser.EventTokenTransfer, Address: "0x123", Block: 10, Transaction: &tx, Transfer: &transfer})
+	bus.Publish(parser.Event{Type: parser.EventReorg, Address: "0x123", Block: 13, Transaction: &tx, Fork: 9})
+	if e, err = stream.Recv(); err != nil || e.GetConfirmations() != 3 || e.GetStatus() != parser.StatusConfirmed {
+		t.Fatalf("received %v, %v, expected a status event with 3 confirmations", e, err)
+	}
+	if e, err = stream.Recv(); err != nil || e.GetTransfer().GetTokenId() != "0x7" || e.GetTransfer().GetLogIndex() != 2 || len(e.GetTransaction().GetTransfers()) != 1 {
+		t.Fatalf("received %v, %v, expected the transfer of token 0x7", e, err)
+	}
+	if e, err = stream.Recv(); err != nil || e.GetFork() != 9 {
+		t.Fatalf("received %v, %v, expected a reorg event from block 9", e, err)
+	}
+
+	// The stream ends once the tenant unsubscribes from the address
+	if _, err = client.Unsubscribe(ctx, &parserpb.UnsubscribeRequest{Address: "0x123"}); err != nil {
+		t.Fatalf("Unsubscribe returned error: %v", err)
+	}
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 11})
+	if e, err = stream.Recv(); status.Code(err) != codes.NotFound {
+		t.Errorf("received %v, %v, expected NotFound", e, err)
+	}
+}
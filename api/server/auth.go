@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"trustwallet/business/auth"
+	"trustwallet/business/web"
+)
+
+type IssueKeyRequest struct {
+	Tenant string `json:"tenant"`
+}
+
+// IssueKeyResponse is the only response carrying the key itself.
+type IssueKeyResponse struct {
+	auth.Key
+	Secret string `json:"key"`
+}
+
+type KeysResponse struct {
+	Keys []auth.Key `json:"keys"`
+}
+
+type SubscriptionsResponse struct {
+	Addresses []string `json:"addresses"`
+}
+
+// authenticate rejects the requests without an active API key, and passes the tenant of the key on to the handlers.
+func (h Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := h.Keys.Authenticate(auth.FromHeader(r.Header.Get("X-API-Key"), r.Header.Get("Authorization")))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="eth-parser"`)
+			web.RespondError(w, r, web.Unauthorized("api key is missing or invalid"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), key)))
+	})
+}
+
+// authenticateAdmin rejects the requests that do not carry the admin key.
+func (h Handler) authenticateAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.Equal(auth.FromHeader(r.Header.Get("X-API-Key"), r.Header.Get("Authorization")), h.AdminKey) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="eth-parser-admin"`)
+			web.RespondError(w, r, web.Unauthorized("admin key is missing or invalid"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IssueKey creates an API key for a tenant. The response is the only one carrying the key.
+func (h Handler) IssueKey(w http.ResponseWriter, r *http.Request) {
+	var req IssueKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.RespondError(w, r, web.InvalidBody("body is invalid"))
+		return
+	}
+
+	key, secret, err := h.Keys.Issue(req.Tenant)
+	if errors.Is(err, auth.ErrInvalidTenant) {
+		web.RespondError(w, r, web.InvalidBody("tenant is invalid"))
+		return
+	}
+	if err != nil {
+		h.logFor(r).Errorw("issuing key", "tenant", req.Tenant, "error", err)
+		web.RespondError(w, r, web.ErrInternal)
+		return
+	}
+
+	h.logFor(r).Infow("admin", "status", "key issued", "tenant", key.Tenant, "key", key.ID)
+	h.respond(w, r, http.StatusCreated, IssueKeyResponse{Key: key, Secret: secret})
+}
+
+// ListKeys lists every API key, without the keys themselves.
+func (h Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, http.StatusOK, KeysResponse{Keys: h.Keys.List()})
+}
+
+// RevokeKey disables an API key. The subscriptions of its tenant are kept.
+func (h Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	id := param(r, "id")
+
+	if !h.Keys.Revoke(id) {
+		web.RespondError(w, r, web.NotFound("key"))
+		return
+	}
+
+	h.logFor(r).Infow("admin", "status", "key revoked", "key", id)
+	h.respond(w, r, http.StatusOK, SubscribeAddressResponse{Result: true})
+}
+
+// ListSubscriptions lists the addresses the tenant of the request is subscribed to.
+func (h Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, http.StatusOK, SubscriptionsResponse{Addresses: h.Parser.Subscriptions(auth.Tenant(r.Context()))})
+}
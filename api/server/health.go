@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the checks of a readiness probe, so a hung node fails the probe instead of blocking it.
+const readyTimeout = 3 * time.Second
+
+type ReadinessResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+type StatusResponse struct {
+	HeadBlock      int               `json:"head_block"`
+	ProcessedBlock int               `json:"processed_block"`
+	Lag            int               `json:"lag"`
+	LastPoll       *time.Time        `json:"last_poll,omitempty"`
+	Endpoint       string            `json:"endpoint"`
+	Backfill       *BackfillResponse `json:"backfill,omitempty"`
+}
+
+// BackfillResponse is the progress of the parser catching up with the head, from the block it started after.
+type BackfillResponse struct {
+	From     int     `json:"from"`
+	To       int     `json:"to"`
+	Current  int     `json:"current"`
+	Progress float64 `json:"progress"`
+}
+
+// Healthz answers as long as the process serves requests.
+func (h Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz answers 503 unless the storage and the Ethereum node are reachable and the parser is no more than
+// MaxLag blocks behind the head. The causes are logged rather than returned, since they may hold the node URL.
+func (h Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	resp := ReadinessResponse{Ready: true, Checks: map[string]string{"dependencies": "ok", "lag": "ok"}}
+	if err := h.Parser.Ping(ctx); err != nil {
+		h.logFor(r).Warnw("readiness", "error", err)
+		resp.Ready = false
+		resp.Checks["dependencies"] = "unreachable"
+	}
+	if lag := h.Parser.Status().Lag; h.MaxLag > 0 && lag > h.MaxLag {
+		resp.Ready = false
+		resp.Checks["lag"] = fmt.Sprintf("%d blocks behind, more than %d", lag, h.MaxLag)
+	}
+
+	if !resp.Ready {
+		h.respond(w, r, http.StatusServiceUnavailable, resp)
+		return
+	}
+	h.respond(w, r, http.StatusOK, resp)
+}
+
+// Status returns how far the parser is in following the chain.
+func (h Handler) Status(w http.ResponseWriter, r *http.Request) {
+	status := h.Parser.Status()
+	resp := StatusResponse{
+		HeadBlock:      status.HeadBlock,
+		ProcessedBlock: status.ProcessedBlock,
+		Lag:            status.Lag,
+		Endpoint:       status.Endpoint,
+	}
+	if !status.LastPoll.IsZero() {
+		resp.LastPoll = &status.LastPoll
+	}
+	if b := status.Backfill; b != nil {
+		resp.Backfill = &BackfillResponse{From: b.From, To: b.To, Current: b.Current, Progress: b.Progress()}
+	}
+
+	h.respond(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"trustwallet/business/auth"
+	"trustwallet/business/web"
+)
+
+type UsageResponse struct {
+	Tenant            string     `json:"tenant"`
+	Subscriptions     int        `json:"subscriptions"`
+	SubscriptionLimit int        `json:"subscription_limit"`
+	RateLimit         *RateUsage `json:"rate_limit,omitempty"`
+}
+
+// RateUsage describes the bucket the requests of a client are taken from, per API key or else per IP.
+type RateUsage struct {
+	Scope     string  `json:"scope"`
+	Rate      float64 `json:"rate"`
+	Burst     int     `json:"burst"`
+	Remaining int     `json:"remaining"`
+}
+
+// limitIP rejects the requests of client IPs that exceed their rate.
+func (h Handler) limitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retry := h.IPLimit.Allow(clientIP(r)); !ok {
+			tooManyRequests(w, r, retry)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitKey rejects the requests of API keys that exceed their rate. It runs after authenticate.
+func (h Handler) limitKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retry := h.KeyLimit.Allow(auth.KeyID(r.Context())); !ok {
+			tooManyRequests(w, r, retry)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Usage returns the subscriptions of the tenant against its limit, and what is left of its rate limit.
+func (h Handler) Usage(w http.ResponseWriter, r *http.Request) {
+	tenant := auth.Tenant(r.Context())
+	usage := UsageResponse{
+		Tenant:            tenant,
+		Subscriptions:     len(h.Parser.Subscriptions(tenant)),
+		SubscriptionLimit: h.Parser.SubscriptionLimit(),
+	}
+
+	if id := auth.KeyID(r.Context()); id != "" && h.KeyLimit != nil {
+		usage.RateLimit = &RateUsage{Scope: "api_key", Rate: h.KeyLimit.Rate(), Burst: h.KeyLimit.Burst(), Remaining: h.KeyLimit.Remaining(id)}
+	} else if h.IPLimit != nil {
+		usage.RateLimit = &RateUsage{Scope: "ip", Rate: h.IPLimit.Rate(), Burst: h.IPLimit.Burst(), Remaining: h.IPLimit.Remaining(clientIP(r))}
+	}
+
+	h.respond(w, r, http.StatusOK, usage)
+}
+
+// tooManyRequests replies 429, telling the client when to retry in whole seconds.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	web.RespondError(w, r, web.ErrRateLimited)
+}
+
+// subscriptionLimitReached replies 429 to a tenant at its subscription limit. Waiting does not help, so there is
+// no Retry-After: the tenant has to unsubscribe an address first.
+func subscriptionLimitReached(w http.ResponseWriter, r *http.Request) {
+	web.RespondError(w, r, web.ErrSubscriptionLimit)
+}
+
+// clientIP returns the IP address of the client, without its port. Proxies are not trusted, so the API should
+// be reached directly or through a proxy that limits on its own.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
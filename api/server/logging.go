@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"trustwallet/business/web"
+)
+
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// GetLogLevel gets the lowest level the application logs.
+func (h Handler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, http.StatusOK, LogLevel{Level: h.LogLevel.Level().String()})
+}
+
+// SetLogLevel changes the lowest level the application logs, until it restarts.
+func (h Handler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.RespondError(w, r, web.InvalidBody("body is invalid"))
+		return
+	}
+
+	level, err := zapcore.ParseLevel(req.Level)
+	if err != nil || level < zapcore.DebugLevel || level > zapcore.ErrorLevel {
+		web.RespondError(w, r, web.InvalidBody("level is invalid, expected debug, info, warn or error"))
+		return
+	}
+
+	previous := h.LogLevel.Level()
+	h.LogLevel.SetLevel(level)
+
+	// Logged at warn, so the change is recorded whatever the new level
+	h.logFor(r).Warnw("admin", "status", "log level changed", "from", previous.String(), "to", level.String())
+	h.respond(w, r, http.StatusOK, LogLevel{Level: level.String()})
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bufio"
+	"github.com/dimfeld/httptreemux/v5"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"trustwallet/business/metrics"
+)
+
+// statusRecorder remembers the status code and the number of bytes written through it. It passes hijacking and
+// flushing through, so WebSocket upgrades and event streams keep working behind it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// A hijacked connection answers 101 Switching Protocols
+	sr.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(sr.ResponseWriter).Hijack()
+}
+
+func (sr *statusRecorder) Flush() {
+	http.NewResponseController(sr.ResponseWriter).Flush()
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// instrument records the duration of every request in the http_request_duration_seconds metric, labelled with
+// the route pattern rather than the path so addresses do not explode the number of series.
+func (h Handler) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		route := httptreemux.ContextRoute(r.Context())
+		metrics.HTTPDuration.WithLabelValues(r.Method, route, strconv.Itoa(sr.status)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+	"trustwallet/business/web"
+)
+
+// Middleware wraps a handler with behaviour shared by every request.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps a handler with middlewares, the first one being the outermost, so it runs first on the way in and
+// last on the way out.
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// maxRequestIDLength bounds the IDs accepted from clients, so they cannot flood the logs.
+const maxRequestIDLength = 128
+
+// requestID tags every request with an ID, the one sent by the client or proxy in X-Request-ID when it is
+// printable and short enough, or else a random one. The ID is echoed in the response and added to the logs.
+func (h Handler) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(web.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(web.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(web.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether a client supplied ID is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random bytes, hex encoded.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// accessLog logs every request once it is answered.
+func (h Handler) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		h.Log.Infow("request",
+			"request_id", web.RequestID(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sr.status,
+			"bytes", sr.bytes,
+			"duration", time.Since(start),
+			"remote_ip", clientIP(r),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// recoverPanic turns a panicking handler into a 500, logging the panic with its stack instead of dropping the
+// connection. Handlers aborting on purpose with http.ErrAbortHandler are left to the server.
+func (h Handler) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			h.logFor(r).Errorw("panic", "panic", fmt.Sprint(rec), "stack", string(debug.Stack()))
+
+			// Past the headers, the client already has a status and only a truncated body can tell it
+			if sr.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			web.RespondError(w, r, web.ErrInternal)
+		}()
+
+		next.ServeHTTP(sr, r)
+	})
+}
+
+// CORSConfig lists what browsers may do across origins. CORS is disabled when AllowedOrigins is empty.
+type CORSConfig struct {
+	AllowedOrigins []string // "*" allows every origin
+	MaxAge         time.Duration
+}
+
+// CheckOrigin reports whether a WebSocket upgrade may proceed, which browsers send across origins without any
+// preflight: requests without an Origin, such as those of non-browser clients, from the origin of the server
+// itself, or from an allowed origin.
+func (c CORSConfig) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHeaders are the request headers browsers may send across origins.
+const corsHeaders = "Authorization, Content-Type, X-API-Key, X-Request-ID, Last-Event-ID, traceparent"
+
+// corsExposed are the response headers scripts may read across origins.
+const corsExposed = "X-Request-ID, Retry-After"
+
+// cors answers the preflight requests of the allowed origins and lets browsers read their responses. Preflights
+// are answered before authentication, since browsers send them without credentials.
+func cors(cfg CORSConfig) Middleware {
+	allowed := make(map[string]bool)
+	for _, origin := range cfg.AllowedOrigins {
+		allowed[origin] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(allowed[origin] || allowed["*"]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposed)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// compress gzips the responses of the clients accepting it. WebSocket upgrades, event streams and responses
+// the handler encoded itself, such as the metrics, are passed through untouched.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipWriter compresses what is written through it. It holds the status back until the first write, so the
+// content type can be sniffed from the uncompressed body before deciding whether to compress it.
+type gzipWriter struct {
+	http.ResponseWriter
+	status  int
+	started bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipWriter) WriteHeader(status int) {
+	if gw.status == 0 {
+		gw.status = status
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	gw.start(b)
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+func (gw *gzipWriter) Flush() {
+	gw.start(nil)
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// start writes the status, compressing the body when it has one worth compressing.
+func (gw *gzipWriter) start(b []byte) {
+	if gw.started {
+		return
+	}
+	gw.started = true
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+
+	header := gw.ResponseWriter.Header()
+	if header.Get("Content-Type") == "" && len(b) > 0 {
+		header.Set("Content-Type", http.DetectContentType(b))
+	}
+	bodyless := gw.status < http.StatusOK || gw.status == http.StatusNoContent || gw.status == http.StatusNotModified
+	compressed := header.Get("Content-Encoding") != "" || header.Get("Content-Type") == "application/gzip"
+	if !bodyless && !compressed && !strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.status)
+}
+
+// close writes the status of an empty response and ends the compressed body.
+func (gw *gzipWriter) close() {
+	if !gw.started {
+		// Nothing was written, so there is nothing worth compressing
+		gw.started = true
+		if gw.status != 0 {
+			gw.ResponseWriter.WriteHeader(gw.status)
+		}
+		return
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
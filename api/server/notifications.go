@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"trustwallet/business/auth"
+	"trustwallet/business/notify"
+	"trustwallet/business/parser"
+	"trustwallet/business/web"
+)
+
+type PreferencesResponse struct {
+	Preferences []notify.Preference `json:"preferences"`
+}
+
+// AddPreference subscribes an address and registers a notification preference for it.
+func (h Handler) AddPreference(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	if address == "unknown" {
+		web.RespondError(w, r, web.ErrInvalidAddress)
+		return
+	}
+
+	var pref notify.Preference
+	if err := json.NewDecoder(r.Body).Decode(&pref); err != nil {
+		web.RespondError(w, r, web.InvalidBody("body is invalid"))
+		return
+	}
+	pref.Tenant, pref.Address = auth.Tenant(r.Context()), address
+
+	pref, err := h.Notifications.Add(pref)
+	if err != nil {
+		web.RespondError(w, r, web.InvalidBody(err.Error()))
+		return
+	}
+
+	// Notifications only happen for the addresses the parser matches
+	if _, err = h.Parser.Subscribe(pref.Tenant, address); errors.Is(err, parser.ErrSubscriptionLimit) {
+		h.Notifications.Remove(pref.Tenant, address, pref.ID)
+		subscriptionLimitReached(w, r)
+		return
+	}
+
+	h.respond(w, r, http.StatusCreated, pref)
+}
+
+// ListPreferences lists the notification preferences the tenant set for an address.
+func (h Handler) ListPreferences(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	h.respond(w, r, http.StatusOK, PreferencesResponse{Preferences: h.Notifications.Preferences(auth.Tenant(r.Context()), address)})
+}
+
+// RemovePreference deletes a notification preference the tenant set for an address.
+func (h Handler) RemovePreference(w http.ResponseWriter, r *http.Request) {
+	address, id := param(r, "address"), param(r, "id")
+
+	if !h.Notifications.Remove(auth.Tenant(r.Context()), address, id) {
+		web.RespondError(w, r, web.NotFound("preference"))
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, SubscribeAddressResponse{Result: true})
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+// APIVersion prefixes the paths of the current version of the API.
+const APIVersion = "/v1"
+
+// OpenAPISpec is the OpenAPI 3 document describing the routes mounted under APIVersion.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// OpenAPI serves the OpenAPI document of the API.
+func (h Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(OpenAPISpec)
+}
+
+// deprecated marks the responses of the unversioned paths, pointing clients at their versioned successor.
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+APIVersion+strings.TrimSuffix(r.URL.Path, "/")+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
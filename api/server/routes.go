@@ -6,6 +6,13 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"trustwallet/business/auth"
+	"trustwallet/business/events"
+	"trustwallet/business/notify"
+	"trustwallet/business/parser"
+	"trustwallet/business/ratelimit"
+	"trustwallet/business/web"
+	"trustwallet/business/webhook"
 )
 
 // APIMuxConfig contains all the mandatory systems required by handlers.
@@ -14,27 +21,157 @@ type APIMuxConfig struct {
 	Shutdown chan os.Signal
 	Log      *zap.SugaredLogger
 	Parser   Parser
+	Events   *events.Bus
+	Webhooks *webhook.Dispatcher
+	Notify   *notify.Service
+	GraphQL  http.Handler
+	Keys     *auth.Keys
+	AdminKey string
+	LogLevel *zap.AtomicLevel
+	Storage  parser.Storage
+	IPLimit  *ratelimit.Limiter
+	KeyLimit *ratelimit.Limiter
+	Metrics  http.Handler
+	MaxLag   int
+	CORS     CORSConfig
 }
 
 // Handler manages the set of user endpoints.
 type Handler struct {
-	Parser Parser
-	Log    *zap.SugaredLogger
+	Parser        Parser
+	Events        *events.Bus
+	Webhooks      *webhook.Dispatcher
+	Notifications *notify.Service
+	Keys          *auth.Keys
+	AdminKey      string
+	LogLevel      *zap.AtomicLevel
+	Storage       parser.Storage
+	IPLimit       *ratelimit.Limiter
+	KeyLimit      *ratelimit.Limiter
+	MaxLag        int
+	CORS          CORSConfig
+	Log           *zap.SugaredLogger
 }
 
 // APIMux constructs a http.Handler with all application routes defined.
 func APIMux(cfg APIMuxConfig) http.Handler {
 	mux := httptreemux.NewContextMux()
 
+	// Unknown routes and methods are answered with the error envelope too
+	mux.NotFoundHandler = func(w http.ResponseWriter, r *http.Request) {
+		web.RespondError(w, r, web.NotFound("route"))
+	}
+	mux.MethodNotAllowedHandler = func(w http.ResponseWriter, r *http.Request, methods map[string]httptreemux.HandlerFunc) {
+		for m := range methods {
+			w.Header().Add("Allow", m)
+		}
+		web.RespondError(w, r, web.ErrMethodNotAllowed)
+	}
+
 	// Register endpoints.
 	hd := Handler{
-		Parser: cfg.Parser,
-		Log:    cfg.Log,
+		Parser:        cfg.Parser,
+		Events:        cfg.Events,
+		Webhooks:      cfg.Webhooks,
+		Notifications: cfg.Notify,
+		Keys:          cfg.Keys,
+		AdminKey:      cfg.AdminKey,
+		LogLevel:      cfg.LogLevel,
+		Storage:       cfg.Storage,
+		IPLimit:       cfg.IPLimit,
+		KeyLimit:      cfg.KeyLimit,
+		MaxLag:        cfg.MaxLag,
+		CORS:          cfg.CORS,
+		Log:           cfg.Log,
+	}
+
+	// Scrapers and probes reach the metrics and health checks without a key or a rate limit, so they are
+	// registered before any middleware
+	if cfg.Metrics != nil {
+		mux.Handler(http.MethodGet, "/metrics", cfg.Metrics)
+	}
+	mux.Handle(http.MethodGet, "/healthz", hd.Healthz)
+	mux.Handle(http.MethodGet, "/readyz", hd.Readyz)
+
+	// Every other request is traced and measured, including the ones refused by the middlewares below
+	mux.UseHandler(hd.trace)
+	mux.UseHandler(hd.instrument)
+
+	// Every client IP is rate limited, on the admin routes too
+	if cfg.IPLimit != nil {
+		mux.UseHandler(hd.limitIP)
+	}
+
+	// The API is served under its version, and still on the unversioned paths it was first published on
+	// The specification is public, so clients can generate their SDK before they hold a key.
+	v1 := mux.NewContextGroup(APIVersion)
+	v1.Handle(http.MethodGet, "/openapi.json", hd.OpenAPI)
+	hd.mount(v1, cfg)
+	legacy := mux.NewContextGroup("/")
+	legacy.UseHandler(deprecated)
+	hd.mount(legacy, cfg)
+
+	// Every request, routed or not, gets an ID, an access log entry, compression and panic recovery. CORS
+	// preflights are answered here, since the routes only register their own methods.
+	return Chain(mux, hd.requestID, hd.accessLog, compress, hd.recoverPanic, cors(cfg.CORS))
+}
+
+// mount registers the routes of the API on a group.
+func (h Handler) mount(g *httptreemux.ContextGroup, cfg APIMuxConfig) {
+	// Every route but the admin ones requires an API key once keys are configured, and is rate limited per key.
+	// The admin group is created first so it does not inherit these middlewares.
+	if cfg.Keys != nil {
+		if cfg.AdminKey != "" {
+			admin := g.NewContextGroup("/admin")
+			admin.UseHandler(h.authenticateAdmin)
+			admin.Handle(http.MethodPost, "/keys", h.IssueKey)
+			admin.Handle(http.MethodGet, "/keys", h.ListKeys)
+			admin.Handle(http.MethodDelete, "/keys/:id", h.RevokeKey)
+			if cfg.LogLevel != nil {
+				admin.Handle(http.MethodGet, "/log_level", h.GetLogLevel)
+				admin.Handle(http.MethodPut, "/log_level", h.SetLogLevel)
+			}
+			if cfg.Storage != nil {
+				admin.Handle(http.MethodGet, "/snapshot", h.Snapshot)
+			}
+		}
+		g.UseHandler(h.authenticate)
+		if cfg.KeyLimit != nil {
+			g.UseHandler(h.limitKey)
+		}
+	}
+
+	g.Handle(http.MethodGet, "/current_block", h.GetCurrentBlock)
+	g.Handle(http.MethodPost, "/subscribe/:address", h.Subscribe)
+	g.Handle(http.MethodDelete, "/subscribe/:address", h.Unsubscribe)
+	g.Handle(http.MethodGet, "/subscriptions", h.ListSubscriptions)
+	g.Handle(http.MethodGet, "/usage", h.Usage)
+	g.Handle(http.MethodGet, "/status", h.Status)
+	g.Handle(http.MethodGet, "/transactions/:address", h.GetTransactions)
+
+	// Live streams need the event bus the parser publishes to
+	if cfg.Events != nil {
+		g.Handle(http.MethodGet, "/stream/:address", h.Stream)
+		g.Handle(http.MethodGet, "/ws", h.WebSocket)
 	}
 
-	mux.Handle(http.MethodGet, "/current_block", hd.GetCurrentBlock)
-	mux.Handle(http.MethodPost, "/subscribe/:address", hd.Subscribe)
-	mux.Handle(http.MethodGet, "/transactions/:address", hd.GetTransactions)
+	if cfg.Webhooks != nil {
+		g.Handle(http.MethodPost, "/webhooks/:address", h.RegisterWebhook)
+		g.Handle(http.MethodGet, "/webhooks/:address", h.ListWebhooks)
+		g.Handle(http.MethodGet, "/webhooks/:address/dead_letters", h.ListDeadLetters)
+		g.Handle(http.MethodDelete, "/webhooks/:address/:id", h.RemoveWebhook)
+		g.Handle(http.MethodGet, "/webhooks/:address/:id/deliveries", h.ListDeliveries)
+	}
 
-	return mux
+	if cfg.Notify != nil {
+		g.Handle(http.MethodPost, "/notifications/:address", h.AddPreference)
+		g.Handle(http.MethodGet, "/notifications/:address", h.ListPreferences)
+		g.Handle(http.MethodDelete, "/notifications/:address/:id", h.RemovePreference)
+	}
+
+	// Queries and mutations are posted, subscriptions upgrade a GET to a WebSocket
+	if cfg.GraphQL != nil {
+		g.Handler(http.MethodPost, "/graphql", cfg.GraphQL)
+		g.Handler(http.MethodGet, "/graphql", cfg.GraphQL)
+	}
 }
@@ -1,26 +1,58 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"github.com/dimfeld/httptreemux/v5"
+	"math/big"
 	"net/http"
+	"strconv"
+	"trustwallet/business/auth"
 	"trustwallet/business/parser"
+	"trustwallet/business/web"
 )
 
 type Parser interface {
 	// GetCurrentBlock last parsed block
 	GetCurrentBlock() int
 
-	// Subscribe add address to observer
-	Subscribe(address string) bool
+	// Subscribe add address to the observer of a tenant, failing with parser.ErrSubscriptionLimit once the
+	// tenant observes too many
+	Subscribe(tenant, address string) (bool, error)
+
+	// SubscriptionLimit number of addresses a tenant may observe, 0 when unlimited
+	SubscriptionLimit() int
+
+	// Unsubscribe remove address from the observer of a tenant, purging its stored transactions if asked to and
+	// no other tenant observes it
+	Unsubscribe(tenant, address string, purge bool) bool
+
+	// Subscriptions list of addresses a tenant observes
+	Subscriptions(tenant string) []string
+
+	// IsSubscribed whether a tenant observes an address, and may thus read its activity
+	IsSubscribed(tenant, address string) bool
+
+	// History whether a tenant may read the transactions of an address, and the last block it may read, 0 while
+	// it observes the address
+	History(tenant, address string) (int, bool)
 
 	// GetTransactions list of inbound or outbound transactions for an address
 	GetTransactions(address string) []parser.Transaction
+
+	// Status how far the parser is in following the chain
+	Status() parser.SyncStatus
+
+	// Ping whether the storage and the Ethereum node are reachable
+	Ping(ctx context.Context) error
+
+	// QueryTransactions filtered page of transactions for an address, with the cursor to resume after it
+	QueryTransactions(address string, q parser.TransactionQuery) ([]parser.Transaction, string, error)
 }
 
 type TransactionsResponse struct {
 	Transaction []parser.Transaction `json:"transactions"`
+	NextCursor  string               `json:"next_cursor,omitempty"`
 }
 
 type CurrentBlockResponse struct {
@@ -39,17 +71,7 @@ func (h Handler) GetCurrentBlock(w http.ResponseWriter, r *http.Request) {
 		CurrentBlock: block,
 	}
 
-	output, err := json.Marshal(blk)
-	if err != nil {
-		h.Log.Errorw("marshalling response", "data", blk, "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"status": 500, "message":"internal error"}`)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, string(output))
-	return
+	h.respond(w, r, http.StatusOK, blk)
 }
 
 // Subscribe decrypts a string using the Caesar Cipher.
@@ -58,56 +80,189 @@ func (h Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	address := param(r, "address")
 
 	if address == "unknown" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, `{"status": 400, "message":"address is invalid"}`)
+		web.RespondError(w, r, web.ErrInvalidAddress)
 		return
 	}
 
-	sub := h.Parser.Subscribe(address)
+	sub, err := h.Parser.Subscribe(auth.Tenant(r.Context()), address)
+	if errors.Is(err, parser.ErrSubscriptionLimit) {
+		subscriptionLimitReached(w, r)
+		return
+	}
 
 	ok := SubscribeAddressResponse{
 		Result: sub,
 	}
 
-	output, err := json.Marshal(ok)
-	if err != nil {
-		h.Log.Errorw("marshalling response", "data", ok, "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"status": 500, "message":"internal error"}`)
+	h.respond(w, r, http.StatusCreated, ok)
+}
+
+// Unsubscribe stops tracking an address. Its stored transactions are kept unless the purge query parameter is true.
+func (h Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	if address == "unknown" {
+		web.RespondError(w, r, web.ErrInvalidAddress)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprint(w, string(output))
-	return
+	purge := false
+	if v := r.URL.Query().Get("purge"); v != "" {
+		var err error
+		if purge, err = strconv.ParseBool(v); err != nil {
+			web.RespondError(w, r, web.InvalidParameter("purge"))
+			return
+		}
+	}
+
+	unsub := h.Parser.Unsubscribe(auth.Tenant(r.Context()), address, purge)
+
+	ok := SubscribeAddressResponse{
+		Result: unsub,
+	}
+
+	h.respond(w, r, http.StatusOK, ok)
 }
 
-// GetTransactions decrypts a string using the Caesar Cipher.
+// GetTransactions returns the transactions of an address, filtered and paginated by the query parameters.
+// Tenants can only read the addresses they are subscribed to, and the history they kept when unsubscribing.
 func (h Handler) GetTransactions(w http.ResponseWriter, r *http.Request) {
 	address := param(r, "address")
 
 	if address == "unknown" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, `{"status": 400, "message":"address is invalid"}`)
+		web.RespondError(w, r, web.ErrInvalidAddress)
 		return
 	}
 
-	txs := h.Parser.GetTransactions(address)
+	until, ok := h.Parser.History(auth.Tenant(r.Context()), address)
+	if !ok {
+		web.RespondError(w, r, web.ErrNotSubscribed)
+		return
+	}
 
-	tx := TransactionsResponse{
-		Transaction: txs,
+	q, invalid := transactionQuery(r)
+	if invalid != "" {
+		web.RespondError(w, r, web.InvalidParameter(invalid))
+		return
+	}
+	q = q.UpTo(until)
+
+	txs, next, err := h.Parser.QueryTransactions(address, q)
+	if errors.Is(err, parser.ErrInvalidCursor) {
+		web.RespondError(w, r, web.InvalidParameter("cursor"))
+		return
 	}
-	output, err := json.Marshal(tx)
 	if err != nil {
-		h.Log.Errorw("marshalling response", "data", tx, "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"status": 500, "message":"internal error"}`)
+		h.logFor(r).Errorw("querying transactions", "address", address, "error", err)
+		web.RespondError(w, r, web.ErrInternal)
+		return
+	}
+
+	if web.Negotiate(r, web.MediaJSON, web.MediaCSV) == web.MediaCSV {
+		h.respondTransactionsCSV(w, r, txs, next)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, string(output))
-	return
+	tx := TransactionsResponse{
+		Transaction: txs,
+		NextCursor:  next,
+	}
+	h.respond(w, r, http.StatusOK, tx)
+}
+
+// transactionColumns is the header row of the CSV transaction listings.
+var transactionColumns = []string{"hash", "from", "to", "value", "status", "gas", "gas_price", "block_number", "block_hash", "timestamp"}
+
+// respondTransactionsCSV writes transactions as CSV for the clients asking for text/csv. The cursor of the next
+// page, which has no place in the table, is sent in the X-Next-Cursor header.
+func (h Handler) respondTransactionsCSV(w http.ResponseWriter, r *http.Request, txs []parser.Transaction, next string) {
+	rows := make([][]string, len(txs))
+	for i, tx := range txs {
+		var block string
+		if tx.BlockNumber != nil {
+			block = tx.BlockNumber.String()
+		}
+		rows[i] = []string{tx.Hash, tx.From, tx.To, tx.Value, tx.Status, tx.Gas, tx.GasPrice, block, tx.BlockHash, strconv.FormatInt(tx.Timestamp, 10)}
+	}
+
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	if err := web.RespondCSV(w, http.StatusOK, transactionColumns, rows); err != nil {
+		h.logFor(r).Debugw("writing csv", "error", err)
+	}
+}
+
+// transactionQuery reads the transaction filters from the query string. On failure it returns the name of
+// the offending parameter.
+func transactionQuery(r *http.Request) (parser.TransactionQuery, string) {
+	values := r.URL.Query()
+	q := parser.TransactionQuery{
+		Cursor:    values.Get("cursor"),
+		Direction: parser.Direction(values.Get("direction")),
+		Status:    values.Get("status"),
+	}
+
+	switch q.Direction {
+	case "", parser.DirectionAll, parser.DirectionIn, parser.DirectionOut:
+	default:
+		return q, "direction"
+	}
+	switch q.Status {
+	case "", parser.TransactionSuccess, parser.TransactionFailed:
+	default:
+		return q, "status"
+	}
+
+	ints := []struct {
+		name string
+		dst  *int64
+	}{
+		{"fromBlock", &q.FromBlock},
+		{"toBlock", &q.ToBlock},
+		{"since", &q.Since},
+		{"until", &q.Until},
+	}
+	for _, i := range ints {
+		v := values.Get(i.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return q, i.name
+		}
+		*i.dst = n
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > parser.MaxQueryLimit {
+			return q, "limit"
+		}
+		q.Limit = n
+	}
+
+	if v := values.Get("minValue"); v != "" {
+		n, ok := new(big.Int).SetString(v, 0)
+		if !ok || n.Sign() < 0 {
+			return q, "minValue"
+		}
+		q.MinValue = n
+	}
+
+	return q, ""
+}
+
+// subscribed reports whether the tenant of the request is subscribed to an address, replying 404 when it is not
+// so tenants cannot tell which addresses others follow.
+func (h Handler) subscribed(w http.ResponseWriter, r *http.Request, address string) bool {
+	if h.Parser.IsSubscribed(auth.Tenant(r.Context()), address) {
+		return true
+	}
+
+	web.RespondError(w, r, web.ErrNotSubscribed)
+	return false
 }
 
 // param returns the web call parameters from the request.
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"net/http"
+	"trustwallet/business/snapshot"
+)
+
+// Snapshot streams a snapshot of the storage of the running server, which the export command downloads. An export
+// failing partway ends the stream early, which the client notices as a truncated snapshot.
+func (h Handler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="parser.ndjson.gz"`)
+
+	stats, err := snapshot.Export(w, h.Storage)
+	if err != nil {
+		h.logFor(r).Errorw("admin", "status", "snapshot failed", "error", err)
+		return
+	}
+	h.logFor(r).Infow("admin", "status", "snapshot exported", "stats", stats)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"trustwallet/business/auth"
+	"trustwallet/business/web"
+)
+
+// streamBuffer is the number of events a slow stream client may lag behind before it is disconnected.
+const streamBuffer = 64
+
+// heartbeatInterval is how often an idle stream sends a comment line to keep proxies from closing it.
+const heartbeatInterval = 15 * time.Second
+
+// Stream pushes the events of a subscribed address as Server-Sent Events. Clients reconnecting with the Last-Event-ID
+// header first receive the events they missed, as long as the bus still remembers them. The stream ends once the
+// tenant unsubscribes from the address.
+func (h Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	if address == "unknown" {
+		web.RespondError(w, r, web.ErrInvalidAddress)
+		return
+	}
+
+	if !h.subscribed(w, r, address) {
+		return
+	}
+
+	var after uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			web.RespondError(w, r, web.InvalidParameter("Last-Event-ID"))
+			return
+		}
+	}
+
+	// Streams outlive the server write timeout, so lift it for this response
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		h.logFor(r).Debugw("stream", "address", address, "error", err)
+	}
+
+	sub, missed := h.Events.Subscribe(after, streamBuffer, address)
+	defer h.Events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		h.logFor(r).Errorw("stream", "address", address, "error", err)
+		return
+	}
+
+	tenant := auth.Tenant(r.Context())
+	for _, msg := range missed {
+		if !h.Parser.IsSubscribed(tenant, address) {
+			return
+		}
+		if err := writeEvent(w, msg.Seq, string(msg.Event.Type), msg.Event); err != nil {
+			return
+		}
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+
+		case msg, ok := <-sub.C:
+			// The bus dropped a client that could not keep up, it will reconnect with Last-Event-ID
+			if !ok {
+				return
+			}
+			if !h.Parser.IsSubscribed(tenant, address) {
+				return
+			}
+			if err := writeEvent(w, msg.Seq, string(msg.Event.Type), msg.Event); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON payload.
+func writeEvent(w http.ResponseWriter, id uint64, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload)
+	return err
+}
@@ -1,15 +1,38 @@
 package tests
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
 	"log"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 	"trustwallet/api/server"
+	"trustwallet/business/auth"
+	"trustwallet/business/events"
 	"trustwallet/business/logger"
+	"trustwallet/business/metrics"
+	"trustwallet/business/notify"
+	"trustwallet/business/parser"
+	"trustwallet/business/ratelimit"
+	"trustwallet/business/storage"
+	"trustwallet/business/tracing"
+	"trustwallet/business/web"
+	"trustwallet/business/webhook"
 )
 
 // Success and failure markers.
@@ -39,14 +62,33 @@ func Test_Encypter_Decrypter(t *testing.T) {
 			Shutdown: shutdown,
 			Log:      sugaredLogger,
 			Parser:   ethParser,
+			Events:   eventBus,
+			Webhooks: dispatcher,
+			Notify:   notifications,
 		}),
 	}
 
 	t.Run("currentBlock200", tests.currentBlock200)
 	t.Run("subscribeAddress400", tests.subscribeAddress400)
 	t.Run("subscribeAddress200", tests.subscribeAddress200)
+	t.Run("unsubscribeAddress400", tests.unsubscribeAddress400)
+	t.Run("unsubscribeAddress200", tests.unsubscribeAddress200)
 	t.Run("getTransactions400", tests.getTransactions400)
 	t.Run("getTransactions200", tests.getTransactions200)
+	t.Run("getTransactionsQuery400", tests.getTransactionsQuery400)
+	t.Run("keptHistory", keptHistory)
+	t.Run("stream200", tests.stream200)
+	t.Run("webSocket", tests.webSocket)
+	t.Run("webhooks", tests.webhooks)
+	t.Run("notifications", tests.notifications)
+	t.Run("authentication", authentication)
+	t.Run("limits", limits)
+	t.Run("metrics", metricsEndpoint)
+	t.Run("health", health)
+	t.Run("tracing", tracingSpans)
+	t.Run("middleware", middleware)
+	t.Run("responses", responses)
+	t.Run("conformance", conformance)
 }
 
 // currentBlock200 get current block number.
@@ -94,6 +136,80 @@ func (ht *HandlerTests) subscribeAddress200(t *testing.T) {
 	}
 }
 
+// unsubscribeAddress400 unsubscribe with an invalid purge option.
+func (ht *HandlerTests) unsubscribeAddress400(t *testing.T) {
+	t.Log("Should return 400 for an invalid purge option")
+	{
+		w := ht.helperHttpClient(http.MethodDelete, fmt.Sprintf("/subscribe/%v?purge=%v", "0x123", "maybe"), nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s Should receive a status code of 400 for the response : %v", failed, w.Code)
+		}
+
+		t.Logf("%s Should receive a status code of 400 for the response", success)
+	}
+}
+
+// unsubscribeAddress200 unsubscribe a subscribed address.
+func (ht *HandlerTests) unsubscribeAddress200(t *testing.T) {
+	t.Log("Should return 200 and true for a subscribed address")
+	{
+		ht.helperHttpClient(http.MethodPost, fmt.Sprintf("/subscribe/%v", "0x456"), nil)
+
+		w := ht.helperHttpClient(http.MethodDelete, fmt.Sprintf("/subscribe/%v?purge=true", "0x456"), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the response : %v", failed, w.Code)
+		}
+
+		var resp server.SubscribeAddressResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || !resp.Result {
+			t.Fatalf("%s Should receive a true result : %v, %v", failed, resp.Result, err)
+		}
+
+		t.Logf("%s Should receive a status code of 200 for the response", success)
+	}
+}
+
+// keptHistory read the history kept when unsubscribing, and nothing after it.
+func keptHistory(t *testing.T) {
+	t.Log("Should read the history kept when unsubscribing without purge")
+	{
+		store := storage.NewMemoryStorage()
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:    zap.NewNop().Sugar(),
+				Parser: parser.NewIdleEthereumParser(store, "", zap.NewNop().Sugar()),
+			}),
+		}
+		transactions := func() (int, server.TransactionsResponse) {
+			w := ht.helperHttpClient(http.MethodGet, "/transactions/0xb1", nil)
+			var resp server.TransactionsResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			return w.Code, resp
+		}
+
+		ht.helperHttpClient(http.MethodPost, "/subscribe/0xb1", nil)
+		store.CommitBlock(7, map[string][]parser.Transaction{"0xb1": {{Hash: "0xaaa", From: "0xb1", BlockNumber: big.NewInt(7)}}})
+		if w := ht.helperHttpClient(http.MethodDelete, "/subscribe/0xb1", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the unsubscription : %v", failed, w.Code)
+		}
+
+		// Blocks matched after unsubscribing, for another tenant, stay out of the kept history
+		store.CommitBlock(8, map[string][]parser.Transaction{"0xb1": {{Hash: "0xbbb", From: "0xb1", BlockNumber: big.NewInt(8)}}})
+		if code, resp := transactions(); code != http.StatusOK || len(resp.Transaction) != 1 || resp.Transaction[0].Hash != "0xaaa" {
+			t.Fatalf("%s Should read the transactions up to the unsubscription : %v, %+v", failed, code, resp)
+		}
+
+		if w := ht.helperHttpClient(http.MethodDelete, "/subscribe/0xb1?purge=true", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the purge : %v", failed, w.Code)
+		}
+		if code, _ := transactions(); code != http.StatusNotFound {
+			t.Fatalf("%s Should receive a status code of 404 once the history is purged : %v", failed, code)
+		}
+
+		t.Logf("%s Should read the history kept when unsubscribing without purge", success)
+	}
+}
+
 // getTransactions400 get transactions for an address.
 func (ht *HandlerTests) getTransactions400(t *testing.T) {
 	t.Log("Should return 400 for empty address")
@@ -124,9 +240,676 @@ func (ht *HandlerTests) getTransactions200(t *testing.T) {
 	}
 }
 
+// getTransactionsQuery400 get transactions with invalid filters.
+func (ht *HandlerTests) getTransactionsQuery400(t *testing.T) {
+	t.Log("Should return 400 for invalid query parameters")
+	{
+		for _, query := range []string{"limit=0", "limit=abc", "direction=sideways", "fromBlock=-1", "minValue=xyz", "status=pending", "cursor=!!"} {
+			w := ht.helperHttpClient(http.MethodGet, fmt.Sprintf("/transactions/%v?%v", "0x123", query), nil)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("%s Should receive a status code of 400 for %v : %v", failed, query, w.Code)
+			}
+		}
+
+		t.Logf("%s Should receive a status code of 400 for the response", success)
+	}
+}
+
+// stream200 follow the events of an address.
+func (ht *HandlerTests) stream200(t *testing.T) {
+	t.Log("Should replay missed events after Last-Event-ID and then push live ones")
+	{
+		srv := httptest.NewServer(ht.app)
+		defer srv.Close()
+
+		if w := ht.helperHttpClient(http.MethodGet, "/stream/0xabc", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("%s Should receive a status code of 404 before subscribing : %v", failed, w.Code)
+		}
+		ht.helperHttpClient(http.MethodPost, "/subscribe/0xabc", nil)
+
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xabc", Block: 1})
+		after := eventBus.Seq()
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xabc", Block: 2})
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/stream/0xabc", nil)
+		if err != nil {
+			t.Fatalf("%s Should build the request : %v", failed, err)
+		}
+		req.Header.Set("Last-Event-ID", fmt.Sprint(after))
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s Should connect to the stream : %v", failed, err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("%s Should receive an event stream : %v", failed, resp.Header.Get("Content-Type"))
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		if got := readEvent(t, reader); got.Block != 2 {
+			t.Fatalf("%s Should replay block 2 first : %+v", failed, got)
+		}
+
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xabc", Block: 3})
+		if got := readEvent(t, reader); got.Block != 3 {
+			t.Fatalf("%s Should push block 3 live : %+v", failed, got)
+		}
+
+		t.Logf("%s Should replay missed events after Last-Event-ID and then push live ones", success)
+
+		t.Log("Should end the stream once the address is unsubscribed")
+		ht.helperHttpClient(http.MethodDelete, "/subscribe/0xabc", nil)
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xabc", Block: 4})
+		if rest, err := io.ReadAll(reader); err != nil || strings.Contains(string(rest), "data: ") {
+			t.Fatalf("%s Should end the stream without pushing block 4 : %q, %v", failed, rest, err)
+		}
+		t.Logf("%s Should end the stream once the address is unsubscribed", success)
+	}
+}
+
+// webSocket follow several addresses and new heads over one connection.
+func (ht *HandlerTests) webSocket(t *testing.T) {
+	t.Log("Should push the events of the followed addresses and new heads")
+	{
+		srv := httptest.NewServer(ht.app)
+		defer srv.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatalf("%s Should connect to the WebSocket : %v", failed, err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		conn.WriteJSON(server.WSRequest{Action: "bogus"})
+		var msg server.WSMessage
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "error" {
+			t.Fatalf("%s Should receive an error for an invalid action : %+v, %v", failed, msg, err)
+		}
+
+		conn.WriteJSON(server.WSRequest{Action: "subscribe", Addresses: []string{"0xd1"}})
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "error" {
+			t.Fatalf("%s Should receive an error for an address that is not subscribed : %+v, %v", failed, msg, err)
+		}
+
+		ht.helperHttpClient(http.MethodPost, "/subscribe/0xd1", nil)
+		ht.helperHttpClient(http.MethodPost, "/subscribe/0xd2", nil)
+		conn.WriteJSON(server.WSRequest{Action: "subscribe", Addresses: []string{"0xd1", "0xd2"}, Heads: true})
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "subscribed" {
+			t.Fatalf("%s Should receive a subscribed reply : %+v, %v", failed, msg, err)
+		}
+
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xd3", Block: 1})
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xd2", Block: 1})
+		eventBus.Publish(parser.Event{Type: parser.EventNewHead, Block: 1})
+
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "transaction" || msg.Event.Address != "0xd2" {
+			t.Fatalf("%s Should receive the transaction of 0xd2 : %+v, %v", failed, msg, err)
+		}
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "new_head" || msg.Event.Block != 1 {
+			t.Fatalf("%s Should receive the new head : %+v, %v", failed, msg, err)
+		}
+
+		t.Logf("%s Should push the events of the followed addresses and new heads", success)
+
+		t.Log("Should stop following an address once it is unsubscribed")
+		ht.helperHttpClient(http.MethodDelete, "/subscribe/0xd2", nil)
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xd2", Block: 2})
+		eventBus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0xd1", Block: 2})
+
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "unsubscribed" || len(msg.Addresses) != 1 || msg.Addresses[0] != "0xd2" {
+			t.Fatalf("%s Should receive an unsubscribed message for 0xd2 : %+v, %v", failed, msg, err)
+		}
+		if err = conn.ReadJSON(&msg); err != nil || msg.Type != "transaction" || msg.Event.Address != "0xd1" {
+			t.Fatalf("%s Should receive the transaction of 0xd1 only : %+v, %v", failed, msg, err)
+		}
+		t.Logf("%s Should stop following an address once it is unsubscribed", success)
+	}
+}
+
+// webhooks register, list and remove a webhook.
+func (ht *HandlerTests) webhooks(t *testing.T) {
+	t.Log("Should manage the webhooks of an address")
+	{
+		w := ht.helperHttpClient(http.MethodPost, "/webhooks/0xe1", []byte(`{"url":"ftp://example.com"}`))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s Should receive a status code of 400 for an invalid url : %v", failed, w.Code)
+		}
+		for _, url := range []string{"http://127.0.0.1:8080/hook", "http://10.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://100.64.0.1/hook", "http://[::1]/hook"} {
+			w = ht.helperHttpClient(http.MethodPost, "/webhooks/0xe1", []byte(`{"url":"`+url+`"}`))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("%s Should receive a status code of 400 for the internal url %v : %v", failed, url, w.Code)
+			}
+		}
+
+		w = ht.helperHttpClient(http.MethodPost, "/webhooks/0xe1", []byte(`{"url":"https://example.com/hook"}`))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s Should receive a status code of 201 for the response : %v", failed, w.Code)
+		}
+		var hook webhook.Webhook
+		if err := json.NewDecoder(w.Body).Decode(&hook); err != nil || hook.ID == "" || hook.Secret == "" {
+			t.Fatalf("%s Should receive the webhook with its secret : %+v, %v", failed, hook, err)
+		}
+
+		w = ht.helperHttpClient(http.MethodGet, "/webhooks/0xe1", nil)
+		var list server.WebhooksResponse
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list.Webhooks) != 1 {
+			t.Fatalf("%s Should list the webhook : %+v, %v", failed, list, err)
+		}
+
+		w = ht.helperHttpClient(http.MethodGet, fmt.Sprintf("/webhooks/0xe1/%v/deliveries", hook.ID), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the deliveries : %v", failed, w.Code)
+		}
+
+		w = ht.helperHttpClient(http.MethodDelete, fmt.Sprintf("/webhooks/0xe1/%v", hook.ID), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the removal : %v", failed, w.Code)
+		}
+		w = ht.helperHttpClient(http.MethodDelete, fmt.Sprintf("/webhooks/0xe1/%v", hook.ID), nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s Should receive a status code of 404 once removed : %v", failed, w.Code)
+		}
+
+		t.Logf("%s Should manage the webhooks of an address", success)
+	}
+}
+
+// notifications register and remove a notification preference.
+func (ht *HandlerTests) notifications(t *testing.T) {
+	t.Log("Should manage the notification preferences of an address")
+	{
+		w := ht.helperHttpClient(http.MethodPost, "/notifications/0xf1", []byte(`{"channel":"pigeon"}`))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s Should receive a status code of 400 for an unknown channel : %v", failed, w.Code)
+		}
+
+		w = ht.helperHttpClient(http.MethodPost, "/notifications/0xf1", []byte(`{"channel":"log","direction":"in","min_value":"100000000000000000"}`))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s Should receive a status code of 201 for the response : %v", failed, w.Code)
+		}
+		var pref notify.Preference
+		if err := json.NewDecoder(w.Body).Decode(&pref); err != nil || pref.ID == "" {
+			t.Fatalf("%s Should receive the preference : %+v, %v", failed, pref, err)
+		}
+
+		w = ht.helperHttpClient(http.MethodDelete, fmt.Sprintf("/notifications/0xf1/%v", pref.ID), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the removal : %v", failed, w.Code)
+		}
+
+		t.Logf("%s Should manage the notification preferences of an address", success)
+	}
+}
+
+// authentication issue keys and keep the subscriptions of two tenants apart.
+func authentication(t *testing.T) {
+	t.Log("Should require API keys and scope subscriptions to tenants")
+	{
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:      zap.NewNop().Sugar(),
+				Parser:   ethParser,
+				Keys:     auth.NewKeys(),
+				AdminKey: "admin-secret",
+			}),
+		}
+
+		if w := ht.helperHttpClient(http.MethodGet, "/subscriptions", nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s Should receive a status code of 401 without a key : %v", failed, w.Code)
+		}
+		if w := ht.helperAuthClient(http.MethodPost, "/admin/keys", "wrong", []byte(`{"tenant":"acme"}`)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s Should receive a status code of 401 without the admin key : %v", failed, w.Code)
+		}
+
+		issue := func(tenant string) server.IssueKeyResponse {
+			w := ht.helperAuthClient(http.MethodPost, "/admin/keys", "admin-secret", []byte(fmt.Sprintf(`{"tenant":%q}`, tenant)))
+			var key server.IssueKeyResponse
+			if err := json.NewDecoder(w.Body).Decode(&key); err != nil || w.Code != http.StatusCreated || key.Secret == "" {
+				t.Fatalf("%s Should issue a key : %v, %+v, %v", failed, w.Code, key, err)
+			}
+			return key
+		}
+		acme, globex := issue("acme"), issue("globex")
+
+		// Both tenants subscribe the same address, each as its own subscription
+		for _, key := range []server.IssueKeyResponse{acme, globex} {
+			if w := ht.helperAuthClient(http.MethodPost, "/subscribe/0xa1", key.Secret, nil); w.Code != http.StatusCreated {
+				t.Fatalf("%s Should receive a status code of 201 for the subscription : %v", failed, w.Code)
+			}
+		}
+		ht.helperAuthClient(http.MethodPost, "/subscribe/0xa2", acme.Secret, nil)
+
+		w := ht.helperAuthClient(http.MethodGet, "/subscriptions", globex.Secret, nil)
+		var subs server.SubscriptionsResponse
+		if err := json.NewDecoder(w.Body).Decode(&subs); err != nil || len(subs.Addresses) != 1 || subs.Addresses[0] != "0xa1" {
+			t.Fatalf("%s Should list only the subscriptions of the tenant : %+v, %v", failed, subs, err)
+		}
+		if w = ht.helperAuthClient(http.MethodGet, "/transactions/0xa2", globex.Secret, nil); w.Code != http.StatusNotFound {
+			t.Fatalf("%s Should receive a status code of 404 for the address of another tenant : %v", failed, w.Code)
+		}
+		if w = ht.helperAuthClient(http.MethodGet, "/transactions/0xa2", acme.Secret, nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for an owned address : %v", failed, w.Code)
+		}
+
+		// Revoked keys are refused right away
+		if w = ht.helperAuthClient(http.MethodDelete, "/admin/keys/"+acme.ID, "admin-secret", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the revocation : %v", failed, w.Code)
+		}
+		if w = ht.helperAuthClient(http.MethodGet, "/subscriptions", acme.Secret, nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s Should receive a status code of 401 with a revoked key : %v", failed, w.Code)
+		}
+
+		t.Logf("%s Should require API keys and scope subscriptions to tenants", success)
+	}
+
+	t.Log("Should change the log level at runtime with the admin key")
+	{
+		level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:      zap.NewNop().Sugar(),
+				Parser:   ethParser,
+				Keys:     auth.NewKeys(),
+				AdminKey: "admin-secret",
+				LogLevel: &level,
+			}),
+		}
+
+		if w := ht.helperAuthClient(http.MethodPut, "/v1/admin/log_level", "wrong", []byte(`{"level":"debug"}`)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s Should receive a status code of 401 without the admin key : %v", failed, w.Code)
+		}
+		for _, body := range []string{`{"level":"verbose"}`, `{"level":"fatal"}`, `{`} {
+			if w := ht.helperAuthClient(http.MethodPut, "/v1/admin/log_level", "admin-secret", []byte(body)); w.Code != http.StatusBadRequest {
+				t.Fatalf("%s Should receive a status code of 400 for %s : %v", failed, body, w.Code)
+			}
+		}
+		if w := ht.helperAuthClient(http.MethodPut, "/v1/admin/log_level", "admin-secret", []byte(`{"level":"debug"}`)); w.Code != http.StatusOK || level.Level() != zapcore.DebugLevel {
+			t.Fatalf("%s Should lower the level to debug : %v, %v", failed, w.Code, level.Level())
+		}
+		w := ht.helperAuthClient(http.MethodGet, "/v1/admin/log_level", "admin-secret", nil)
+		var got server.LogLevel
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil || got.Level != "debug" {
+			t.Fatalf("%s Should report the debug level : %+v, %v", failed, got, err)
+		}
+
+		t.Logf("%s Should change the log level at runtime with the admin key", success)
+	}
+}
+
+// limits rate limit clients and cap the subscriptions of tenants.
+func limits(t *testing.T) {
+	t.Log("Should answer 429 once a client exceeds its rate or subscription limit")
+	{
+		log := zap.NewNop().Sugar()
+		limited := parser.NewEthereumParser(storage.NewMemoryStorage(), "http://127.0.0.1:0", time.Hour, log)
+		limited.SetSubscriptionLimit(1)
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:     log,
+				Parser:  limited,
+				IPLimit: ratelimit.New(0.5, 4),
+			}),
+		}
+
+		if w := ht.helperHttpClient(http.MethodPost, "/subscribe/0xb1", nil); w.Code != http.StatusCreated {
+			t.Fatalf("%s Should receive a status code of 201 for the first subscription : %v", failed, w.Code)
+		}
+		w := ht.helperHttpClient(http.MethodPost, "/subscribe/0xb2", nil)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s Should receive a status code of 429 past the subscription limit : %v", failed, w.Code)
+		}
+
+		w = ht.helperHttpClient(http.MethodGet, "/usage", nil)
+		var usage server.UsageResponse
+		if err := json.NewDecoder(w.Body).Decode(&usage); err != nil || usage.Subscriptions != 1 || usage.SubscriptionLimit != 1 ||
+			usage.RateLimit == nil || usage.RateLimit.Scope != "ip" || usage.RateLimit.Remaining != 1 {
+			t.Fatalf("%s Should report the usage of the client : %+v, %v", failed, usage, err)
+		}
+
+		ht.helperHttpClient(http.MethodGet, "/current_block", nil)
+		w = ht.helperHttpClient(http.MethodGet, "/current_block", nil)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+			t.Fatalf("%s Should receive a status code of 429 with Retry-After past the rate limit : %v, %q", failed, w.Code, w.Header().Get("Retry-After"))
+		}
+
+		t.Logf("%s Should answer 429 once a client exceeds its rate or subscription limit", success)
+	}
+}
+
+// metricsEndpoint serves the Prometheus metrics without authentication.
+func metricsEndpoint(t *testing.T) {
+	t.Log("Should expose the request durations per route without an API key")
+	{
+		log := zap.NewNop().Sugar()
+		keys := auth.NewKeys()
+		keys.Issue("acme")
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:     log,
+				Parser:  parser.NewEthereumParser(storage.NewMemoryStorage(), "http://127.0.0.1:0", time.Hour, log),
+				Keys:    keys,
+				Metrics: metrics.Handler(),
+			}),
+		}
+
+		if w := ht.helperHttpClient(http.MethodGet, "/transactions/0xb1", nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s Should receive a status code of 401 without an API key : %v", failed, w.Code)
+		}
+		w := ht.helperHttpClient(http.MethodGet, "/metrics", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for the metrics : %v", failed, w.Code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, `ethparser_http_request_duration_seconds_count{code="401",method="GET",route="/transactions/:address"}`) {
+			t.Fatalf("%s Should record the request duration by route pattern : %s", failed, body)
+		}
+
+		t.Logf("%s Should expose the request durations per route without an API key", success)
+	}
+}
+
+// health reports the liveness, readiness and sync status of the parser.
+func health(t *testing.T) {
+	t.Log("Should fail readiness while the Ethereum node is unreachable")
+	{
+		log := zap.NewNop().Sugar()
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:    log,
+				Parser: parser.NewEthereumParser(storage.NewMemoryStorage(), "http://127.0.0.1:0", time.Hour, log),
+				MaxLag: 10,
+			}),
+		}
+
+		if w := ht.helperHttpClient(http.MethodGet, "/healthz", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for liveness : %v", failed, w.Code)
+		}
+		w := ht.helperHttpClient(http.MethodGet, "/readyz", nil)
+		var ready server.ReadinessResponse
+		if err := json.NewDecoder(w.Body).Decode(&ready); err != nil || w.Code != http.StatusServiceUnavailable ||
+			ready.Ready || ready.Checks["dependencies"] != "unreachable" || ready.Checks["lag"] != "ok" {
+			t.Fatalf("%s Should receive a status code of 503 for readiness : %v, %+v, %v", failed, w.Code, ready, err)
+		}
+
+		w = ht.helperHttpClient(http.MethodGet, "/status", nil)
+		var status server.StatusResponse
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil || w.Code != http.StatusOK ||
+			status.Endpoint != "127.0.0.1:0" || status.LastPoll != nil || status.Backfill != nil {
+			t.Fatalf("%s Should report that the parser never polled : %v, %+v, %v", failed, w.Code, status, err)
+		}
+
+		t.Logf("%s Should fail readiness while the Ethereum node is unreachable", success)
+	}
+
+	t.Log("Should pass readiness once the Ethereum node answers")
+	{
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"jsonrpc": "2.0", "id": 1, "result": "0x0"}`)
+		}))
+		defer node.Close()
+
+		log := zap.NewNop().Sugar()
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:    log,
+				Parser: parser.NewEthereumParser(storage.NewMemoryStorage(), node.URL, time.Hour, log),
+				MaxLag: 10,
+			}),
+		}
+
+		if w := ht.helperHttpClient(http.MethodGet, "/readyz", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should receive a status code of 200 for readiness : %v, %s", failed, w.Code, w.Body)
+		}
+
+		t.Logf("%s Should pass readiness once the Ethereum node answers", success)
+	}
+}
+
+// tracingSpans traces requests by route pattern, continuing the trace of the caller.
+func tracingSpans(t *testing.T) {
+	t.Log("Should record a span per request under the trace of the caller")
+	{
+		exporter := tracetest.NewInMemoryExporter()
+		provider := tracing.Setup(tracing.Config{ServiceName: "test", SampleRatio: 1}, exporter)
+		defer provider.Shutdown(context.Background())
+
+		log := zap.NewNop().Sugar()
+		ht := HandlerTests{
+			app: server.APIMux(server.APIMuxConfig{
+				Log:    log,
+				Parser: parser.NewEthereumParser(storage.NewMemoryStorage(), "http://127.0.0.1:0", time.Hour, log),
+			}),
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/transactions/0xb1", nil)
+		r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		ht.app.ServeHTTP(httptest.NewRecorder(), r)
+		provider.ForceFlush(context.Background())
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "GET /transactions/:address" ||
+			spans[0].SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("%s Should record the request under the trace of the caller : %+v", failed, spans)
+		}
+
+		t.Logf("%s Should record a span per request under the trace of the caller", success)
+	}
+}
+
+// panickingParser panics on GetCurrentBlock, standing for a buggy handler.
+type panickingParser struct {
+	*parser.EthereumParser
+}
+
+func (panickingParser) GetCurrentBlock() int {
+	panic("boom")
+}
+
+// middleware checks the middlewares wrapping every route.
+func middleware(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := zap.New(core).Sugar()
+	ht := HandlerTests{
+		app: server.APIMux(server.APIMuxConfig{
+			Log:    log,
+			Parser: panickingParser{parser.NewEthereumParser(storage.NewMemoryStorage(), "http://127.0.0.1:0", time.Hour, log)},
+			CORS:   server.CORSConfig{AllowedOrigins: []string{"https://dashboard.example"}, MaxAge: time.Hour},
+		}),
+	}
+
+	t.Log("Should tag requests with an ID and log them")
+	{
+		r := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+		r.Header.Set(web.RequestIDHeader, "req-42")
+		w := httptest.NewRecorder()
+		ht.app.ServeHTTP(w, r)
+		if got := w.Header().Get(web.RequestIDHeader); got != "req-42" {
+			t.Fatalf("%s Should echo the request ID of the client : %q", failed, got)
+		}
+		if got := ht.helperHttpClient(http.MethodGet, "/subscriptions", nil).Header().Get(web.RequestIDHeader); len(got) != 32 {
+			t.Fatalf("%s Should generate a request ID : %q", failed, got)
+		}
+
+		entries := logs.FilterMessage("request").All()
+		if len(entries) != 2 || entries[0].ContextMap()["request_id"] != "req-42" || entries[0].ContextMap()["status"] != int64(http.StatusOK) {
+			t.Fatalf("%s Should log every request : %+v", failed, entries)
+		}
+
+		t.Logf("%s Should tag requests with an ID and log them", success)
+	}
+
+	t.Log("Should answer a JSON 500 when a handler panics")
+	{
+		w := ht.helperHttpClient(http.MethodGet, "/current_block", nil)
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "internal error") {
+			t.Fatalf("%s Should receive a status code of 500 : %v, %s", failed, w.Code, w.Body)
+		}
+		if logs.FilterMessage("panic").Len() != 1 {
+			t.Fatalf("%s Should log the panic", failed)
+		}
+
+		t.Logf("%s Should answer a JSON 500 when a handler panics", success)
+	}
+
+	t.Log("Should answer the CORS preflights of the allowed origins only")
+	{
+		for origin, allowed := range map[string]bool{"https://dashboard.example": true, "https://evil.example": false} {
+			r := httptest.NewRequest(http.MethodOptions, "/subscribe/0xb1", nil)
+			r.Header.Set("Origin", origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			w := httptest.NewRecorder()
+			ht.app.ServeHTTP(w, r)
+			if got := w.Header().Get("Access-Control-Allow-Origin"); (got == origin) != allowed {
+				t.Fatalf("%s Should allow %s only if configured : %q", failed, origin, got)
+			}
+			if allowed && (w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Max-Age") != "3600") {
+				t.Fatalf("%s Should answer the preflight of %s : %v", failed, origin, w.Code)
+			}
+			if allowed && !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), http.MethodPut) {
+				t.Fatalf("%s Should allow PUT requests : %q", failed, w.Header().Get("Access-Control-Allow-Methods"))
+			}
+		}
+
+		t.Logf("%s Should answer the CORS preflights of the allowed origins only", success)
+	}
+
+	t.Log("Should open WebSockets from the allowed origins only")
+	{
+		srv := httptest.NewServer(server.APIMux(server.APIMuxConfig{
+			Log:    log,
+			Parser: ethParser,
+			Events: events.NewBus(10),
+			CORS:   server.CORSConfig{AllowedOrigins: []string{"https://dashboard.example"}},
+		}))
+		defer srv.Close()
+
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+		for origin, allowed := range map[string]bool{"": true, srv.URL: true, "https://dashboard.example": true, "https://evil.example": false} {
+			header := http.Header{}
+			if origin != "" {
+				header.Set("Origin", origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if (err == nil) != allowed {
+				t.Fatalf("%s Should open a WebSocket from %q only if allowed : %v", failed, origin, err)
+			}
+			if err == nil {
+				conn.Close()
+			} else if resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("%s Should receive a status code of 403 from %q : %v", failed, origin, resp.StatusCode)
+			}
+		}
+
+		t.Logf("%s Should open WebSockets from the allowed origins only", success)
+	}
+
+	t.Log("Should compress the responses of the clients accepting gzip")
+	{
+		r := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		ht.app.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("%s Should receive a gzip response : %v", failed, w.Header())
+		}
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("%s Should decode the gzip response : %v", failed, err)
+		}
+		var subs server.SubscriptionsResponse
+		if err = json.NewDecoder(gz).Decode(&subs); err != nil {
+			t.Fatalf("%s Should decode the subscriptions : %v", failed, err)
+		}
+		if got := w.Header().Get("Content-Type"); strings.Contains(got, "gzip") {
+			t.Fatalf("%s Should keep the content type of the uncompressed body : %q", failed, got)
+		}
+
+		t.Logf("%s Should compress the responses of the clients accepting gzip", success)
+	}
+}
+
+// responses checks the error envelope and the CSV transaction listings.
+func responses(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	store := storage.NewMemoryStorage()
+	store.AddTransaction("0xb1", parser.Transaction{Hash: "0xaaa", From: "0xb1", To: "0xb2", Value: "0x1", BlockNumber: big.NewInt(7)})
+	p := parser.NewEthereumParser(store, "http://127.0.0.1:0", time.Hour, log)
+	p.Subscribe(parser.DefaultTenant, "0xb1")
+	ht := HandlerTests{
+		app: server.APIMux(server.APIMuxConfig{Log: log, Parser: p}),
+	}
+
+	t.Log("Should answer failures with the JSON error envelope")
+	{
+		r := httptest.NewRequest(http.MethodGet, "/transactions/0xb1?limit=zero", nil)
+		r.Header.Set(web.RequestIDHeader, "req-7")
+		w := httptest.NewRecorder()
+		ht.app.ServeHTTP(w, r)
+
+		var resp web.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusBadRequest ||
+			resp.Code != web.CodeInvalidParameter || resp.Field != "limit" || resp.RequestID != "req-7" {
+			t.Fatalf("%s Should receive the envelope of an invalid parameter : %v, %+v, %v", failed, w.Code, resp, err)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+			t.Fatalf("%s Should receive a JSON content type : %q", failed, got)
+		}
+
+		w = ht.helperHttpClient(http.MethodPut, "/subscribe/0xb1", nil)
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusMethodNotAllowed || resp.Code != web.CodeMethodNotAllowed {
+			t.Fatalf("%s Should receive the envelope of a method not allowed : %v, %+v, %v", failed, w.Code, resp, err)
+		}
+
+		t.Logf("%s Should answer failures with the JSON error envelope", success)
+	}
+
+	t.Log("Should list transactions as CSV when asked to")
+	{
+		r := httptest.NewRequest(http.MethodGet, "/transactions/0xb1", nil)
+		r.Header.Set("Accept", "text/csv")
+		w := httptest.NewRecorder()
+		ht.app.ServeHTTP(w, r)
+
+		want := "hash,from,to,value,status,gas,gas_price,block_number,block_hash,timestamp\n0xaaa,0xb1,0xb2,0x1,,,,7,,0\n"
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") || w.Body.String() != want {
+			t.Fatalf("%s Should receive the transactions as CSV : %v, %q", failed, w.Code, w.Body)
+		}
+
+		t.Logf("%s Should list transactions as CSV when asked to", success)
+	}
+}
+
+// readEvent reads the next Server-Sent Event and decodes its data.
+func readEvent(t *testing.T, reader *bufio.Reader) parser.Event {
+	t.Helper()
+
+	var e parser.Event
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s Should read the stream : %v", failed, err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if err = json.Unmarshal([]byte(data), &e); err != nil {
+				t.Fatalf("%s Should decode the event : %v", failed, err)
+			}
+			return e
+		}
+	}
+}
+
 func (ht *HandlerTests) helperHttpClient(method, url string, body []byte) *httptest.ResponseRecorder {
 	r := httptest.NewRequest(method, url, bytes.NewBuffer(body))
 	w := httptest.NewRecorder()
 	ht.app.ServeHTTP(w, r)
 	return w
 }
+
+func (ht *HandlerTests) helperAuthClient(method, url, key string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, bytes.NewBuffer(body))
+	r.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	ht.app.ServeHTTP(w, r)
+	return w
+}
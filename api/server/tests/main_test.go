@@ -1,16 +1,33 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"go.uber.org/zap"
+	"net"
 	"testing"
+	"time"
+	"trustwallet/business/events"
 	"trustwallet/business/logger"
+	"trustwallet/business/notify"
 	"trustwallet/business/parser"
 	"trustwallet/business/storage"
+	"trustwallet/business/webhook"
 )
 
 var ethParser *parser.EthereumParser
 
+var eventBus *events.Bus
+
+var dispatcher *webhook.Dispatcher
+
+var notifications *notify.Service
+
+// webhooks resolves every webhook host to a public address, so registering works without DNS
+var webhooks = webhook.Config{LookupIP: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}}, nil
+}}
+
 func TestMain(m *testing.M) {
 	var err error
 	log, err := logger.New("MENTSPACE-API")
@@ -26,7 +43,13 @@ func TestMain(m *testing.M) {
 		}
 	}(log)
 
-	ethParser = parser.NewEthereumParser(storage.NewMemoryStorage(), "3b7ef887e2b244b9b0bd9b2a0c36cdf1", 5, log)
+	ethParser = parser.NewEthereumParser(storage.NewMemoryStorage(), "http://127.0.0.1:0", 5*time.Second, log)
+	eventBus = events.NewBus(100)
+	ethParser.AddPublisher(eventBus)
+	dispatcher = webhook.NewDispatcher(webhooks, log)
+	ethParser.AddPublisher(dispatcher)
+	notifications = notify.NewService(map[string]notify.Notifier{notify.ChannelLog: notify.NewLogNotifier(log)}, 10, ethParser, log)
+	ethParser.AddPublisher(notifications)
 
 	m.Run()
 }
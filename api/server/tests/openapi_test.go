@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go.uber.org/zap"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"trustwallet/api/gql"
+	"trustwallet/api/server"
+	"trustwallet/business/auth"
+	"trustwallet/business/events"
+	"trustwallet/business/notify"
+	"trustwallet/business/parser"
+	"trustwallet/business/ratelimit"
+	"trustwallet/business/storage"
+	"trustwallet/business/webhook"
+)
+
+// conformance checks that every route of the versioned API answers as its OpenAPI specification describes, both
+// when it succeeds and when it fails.
+func conformance(t *testing.T) {
+	ctx := context.Background()
+
+	openapi3filter.RegisterBodyDecoder("application/gzip", openapi3filter.FileBodyDecoder)
+	doc, err := openapi3.NewLoader().LoadFromData(server.OpenAPISpec)
+	if err != nil {
+		t.Fatalf("%s Should load the specification : %v", failed, err)
+	}
+	if err = doc.Validate(ctx); err != nil {
+		t.Fatalf("%s Should publish a valid specification : %v", failed, err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("%s Should route the specification : %v", failed, err)
+	}
+
+	log := zap.NewNop().Sugar()
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	store := storage.NewMemoryStorage()
+	store.AddTransaction("0xc1", parser.Transaction{Hash: "0xccc", From: "0xc1", To: "0xc2", Value: "0x1", BlockNumber: big.NewInt(9)})
+	p := parser.NewEthereumParser(store, "http://127.0.0.1:0", time.Hour, log)
+	bus := events.NewBus(10)
+	graph, err := gql.NewHandler(gql.Config{Log: log, Parser: p, Events: bus})
+	if err != nil {
+		t.Fatalf("%s Should build the GraphQL endpoint : %v", failed, err)
+	}
+	app := server.APIMux(server.APIMuxConfig{
+		Log:      log,
+		Parser:   p,
+		Events:   bus,
+		Webhooks: webhook.NewDispatcher(webhooks, log),
+		Notify:   notify.NewService(map[string]notify.Notifier{notify.ChannelLog: notify.NewLogNotifier(log)}, 10, p, log),
+		GraphQL:  graph,
+		Keys:     auth.NewKeys(),
+		AdminKey: "admin-secret",
+		LogLevel: &level,
+		Storage:  store,
+		KeyLimit: ratelimit.New(100, 100),
+	})
+
+	// call sends a request to the API and validates both the request and the response against the specification
+	call := func(method, path, key string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		r := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if body != nil {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+
+		route, params, err := router.FindRoute(r)
+		if err != nil {
+			t.Fatalf("%s Should find %s %s in the specification : %v", failed, method, path, err)
+		}
+		in := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+		if err = openapi3filter.ValidateRequest(ctx, in); err != nil {
+			t.Fatalf("%s Should send %s %s as specified : %v", failed, method, path, err)
+		}
+		out := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: in,
+			Status:                 w.Code,
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		}
+		if err = openapi3filter.ValidateResponse(ctx, out); err != nil {
+			t.Fatalf("%s Should answer %s %s as specified : %v, %s", failed, method, path, err, w.Body)
+		}
+		return w
+	}
+
+	t.Log("Should answer every route of the versioned API as specified")
+	{
+		call(http.MethodGet, "/v1/subscriptions", "", nil)
+		call(http.MethodPost, "/v1/admin/keys", "admin-secret", map[string]string{"tenant": ""})
+		w := call(http.MethodPost, "/v1/admin/keys", "admin-secret", map[string]string{"tenant": "acme"})
+		var issued server.IssueKeyResponse
+		json.NewDecoder(w.Body).Decode(&issued)
+		call(http.MethodGet, "/v1/admin/keys", "admin-secret", nil)
+		call(http.MethodPut, "/v1/admin/log_level", "admin-secret", map[string]string{"level": "debug"})
+		call(http.MethodGet, "/v1/admin/log_level", "admin-secret", nil)
+		call(http.MethodGet, "/v1/admin/snapshot", "admin-secret", nil)
+		key := issued.Secret
+
+		call(http.MethodGet, "/v1/current_block", key, nil)
+		call(http.MethodPost, "/v1/subscribe/unknown", key, nil)
+		call(http.MethodPost, "/v1/subscribe/0xc1", key, nil)
+		call(http.MethodGet, "/v1/subscriptions", key, nil)
+		call(http.MethodGet, "/v1/usage", key, nil)
+		call(http.MethodGet, "/v1/status", key, nil)
+		call(http.MethodGet, "/v1/transactions/0xc1?limit=10&direction=out", key, nil)
+		call(http.MethodGet, "/v1/transactions/0xc1?cursor=garbage", key, nil)
+		call(http.MethodGet, "/v1/transactions/0xc9", key, nil)
+		call(http.MethodGet, "/v1/stream/0xc9", key, nil)
+
+		call(http.MethodPost, "/v1/webhooks/0xc1", key, map[string]string{"url": "ftp://example.com"})
+		w = call(http.MethodPost, "/v1/webhooks/0xc1", key, map[string]string{"url": "https://example.com/hook"})
+		var hook webhook.Webhook
+		json.NewDecoder(w.Body).Decode(&hook)
+		call(http.MethodGet, "/v1/webhooks/0xc1", key, nil)
+		call(http.MethodGet, "/v1/webhooks/0xc1/dead_letters", key, nil)
+		call(http.MethodGet, "/v1/webhooks/0xc1/"+hook.ID+"/deliveries", key, nil)
+		call(http.MethodDelete, "/v1/webhooks/0xc1/"+hook.ID, key, nil)
+		call(http.MethodDelete, "/v1/webhooks/0xc1/"+hook.ID, key, nil)
+
+		w = call(http.MethodPost, "/v1/notifications/0xc1", key, map[string]string{"channel": "log", "direction": "in", "min_value": "1"})
+		var pref notify.Preference
+		json.NewDecoder(w.Body).Decode(&pref)
+		call(http.MethodGet, "/v1/notifications/0xc1", key, nil)
+		call(http.MethodDelete, "/v1/notifications/0xc1/"+pref.ID, key, nil)
+
+		call(http.MethodPost, "/v1/graphql", key, map[string]string{"query": "{ currentBlock }"})
+
+		call(http.MethodDelete, "/v1/subscribe/0xc1?purge=true", key, nil)
+		call(http.MethodDelete, "/v1/admin/keys/"+issued.ID, "admin-secret", nil)
+		call(http.MethodDelete, "/v1/admin/keys/"+issued.ID, "admin-secret", nil)
+
+		t.Logf("%s Should answer every route of the versioned API as specified", success)
+	}
+
+	t.Log("Should serve the specification without a key")
+	{
+		r := httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), server.OpenAPISpec) {
+			t.Fatalf("%s Should receive the specification : %v", failed, w.Code)
+		}
+
+		t.Logf("%s Should serve the specification without a key", success)
+	}
+
+	t.Log("Should keep serving the unversioned paths, marked as deprecated")
+	{
+		r := httptest.NewRequest(http.MethodGet, "/current_block", nil)
+		r.Header.Set("Authorization", "Bearer admin-secret")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("Deprecation") != "true" ||
+			w.Header().Get("Link") != `</v1/current_block>; rel="successor-version"` {
+			t.Fatalf("%s Should mark the legacy path as deprecated : %v, %v", failed, w.Code, w.Header())
+		}
+
+		ht := HandlerTests{app: server.APIMux(server.APIMuxConfig{Log: log, Parser: p})}
+		if w = ht.helperHttpClient(http.MethodGet, "/current_block", nil); w.Code != http.StatusOK {
+			t.Fatalf("%s Should answer the legacy path : %v", failed, w.Code)
+		}
+
+		t.Logf("%s Should keep serving the unversioned paths, marked as deprecated", success)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/dimfeld/httptreemux/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"trustwallet/business/logger"
+	"trustwallet/business/tracing"
+	"trustwallet/business/web"
+)
+
+// trace starts a server span for every request, continuing the trace of the caller when the request carries a
+// traceparent header. The span is named after the route pattern, like the metrics, and answers with 5xx
+// statuses are marked failed.
+func (h Handler) trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := httptreemux.ContextRoute(r.Context())
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(r.Method), semconv.HTTPRoute(route), attribute.String("http.request_id", web.RequestID(r.Context()))),
+		)
+		defer span.End()
+
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r.WithContext(ctx))
+
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPStatusCode(sr.status))
+		if sr.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sr.status))
+		}
+	})
+}
+
+// logFor returns the logger of the handlers, adding the request ID and the trace and span IDs of the request
+// to its entries.
+func (h Handler) logFor(r *http.Request) *zap.SugaredLogger {
+	log := logger.WithTrace(r.Context(), h.Log)
+	if id := web.RequestID(r.Context()); id != "" {
+		log = log.With("request_id", id)
+	}
+	return log
+}
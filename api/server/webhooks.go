@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"trustwallet/business/auth"
+	"trustwallet/business/parser"
+	"trustwallet/business/web"
+	"trustwallet/business/webhook"
+)
+
+type RegisterWebhookRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []webhook.Webhook `json:"webhooks"`
+}
+
+type DeliveriesResponse struct {
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
+type DeadLettersResponse struct {
+	DeadLetters []webhook.DeadLetter `json:"dead_letters"`
+}
+
+// RegisterWebhook subscribes an address and registers a webhook receiving its activity. The response is the
+// only one carrying the webhook secret.
+func (h Handler) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	if address == "unknown" {
+		web.RespondError(w, r, web.ErrInvalidAddress)
+		return
+	}
+
+	var req RegisterWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.RespondError(w, r, web.InvalidBody("body is invalid"))
+		return
+	}
+
+	tenant := auth.Tenant(r.Context())
+	hook, err := h.Webhooks.Register(tenant, address, req.URL, req.Secret)
+	if errors.Is(err, webhook.ErrInvalidURL) {
+		web.RespondError(w, r, web.InvalidBody("url is invalid"))
+		return
+	}
+	if errors.Is(err, webhook.ErrPrivateURL) {
+		web.RespondError(w, r, web.InvalidBody("url must resolve to a public address"))
+		return
+	}
+	if errors.Is(err, webhook.ErrWebhookLimit) {
+		web.RespondError(w, r, web.ErrWebhookLimit)
+		return
+	}
+	if err != nil {
+		h.logFor(r).Errorw("registering webhook", "address", address, "error", err)
+		web.RespondError(w, r, web.ErrInternal)
+		return
+	}
+
+	// Deliveries only happen for the addresses the parser matches
+	if _, err = h.Parser.Subscribe(tenant, address); errors.Is(err, parser.ErrSubscriptionLimit) {
+		h.Webhooks.Remove(tenant, address, hook.ID)
+		subscriptionLimitReached(w, r)
+		return
+	}
+
+	h.respond(w, r, http.StatusCreated, hook)
+}
+
+// ListWebhooks lists the webhooks the tenant registered for an address.
+func (h Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	h.respond(w, r, http.StatusOK, WebhooksResponse{Webhooks: h.Webhooks.Webhooks(auth.Tenant(r.Context()), address)})
+}
+
+// RemoveWebhook deletes a webhook the tenant registered for an address.
+func (h Handler) RemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	address, id := param(r, "address"), param(r, "id")
+
+	if !h.Webhooks.Remove(auth.Tenant(r.Context()), address, id) {
+		web.RespondError(w, r, web.NotFound("webhook"))
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, SubscribeAddressResponse{Result: true})
+}
+
+// ListDeliveries returns the delivery log of a webhook.
+func (h Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	address, id := param(r, "address"), param(r, "id")
+
+	deliveries, ok := h.Webhooks.Deliveries(auth.Tenant(r.Context()), address, id)
+	if !ok {
+		web.RespondError(w, r, web.NotFound("webhook"))
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, DeliveriesResponse{Deliveries: deliveries})
+}
+
+// ListDeadLetters returns the events that could not be delivered to the webhooks the tenant registered for an
+// address.
+func (h Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	address := param(r, "address")
+
+	h.respond(w, r, http.StatusOK, DeadLettersResponse{DeadLetters: h.Webhooks.DeadLetters(auth.Tenant(r.Context()), address)})
+}
+
+// respond writes data as the JSON body of the response.
+func (h Handler) respond(w http.ResponseWriter, r *http.Request, status int, data any) {
+	if err := web.Respond(w, status, data); err != nil {
+		h.logFor(r).Errorw("marshalling response", "data", data, "error", err)
+		web.RespondError(w, r, web.ErrInternal)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"time"
+	"trustwallet/business/auth"
+	"trustwallet/business/events"
+	"trustwallet/business/parser"
+)
+
+// Limits of a WebSocket connection.
+const (
+	wsMaxAddresses  = 100              // addresses a single connection may follow
+	wsBuffer        = 256              // events a connection may lag behind before it is closed
+	wsMaxMessage    = 64 * 1024        // size of a client message
+	wsWriteWait     = 10 * time.Second // time allowed to write a message
+	wsPongWait      = 60 * time.Second // time allowed between two pongs
+	wsPingInterval  = wsPongWait / 2   // how often the server pings
+	wsRepliesBuffer = 16               // pending replies to client requests
+)
+
+// WebSocket client actions.
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// WebSocket reply types, next to the parser event types.
+const (
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsError        = "error"
+)
+
+// WSRequest is a message sent by a WebSocket client to change what the connection follows.
+type WSRequest struct {
+	Action    string   `json:"action"`
+	Addresses []string `json:"addresses"`
+	Heads     bool     `json:"heads"`
+}
+
+// WSMessage is a message pushed to a WebSocket client, either a parser event or a reply to a request.
+type WSMessage struct {
+	Type      string        `json:"type"`
+	Seq       uint64        `json:"seq,omitempty"`
+	Event     *parser.Event `json:"event,omitempty"`
+	Addresses []string      `json:"addresses,omitempty"`
+	Heads     bool          `json:"heads,omitempty"`
+	Message   string        `json:"message,omitempty"`
+}
+
+// WebSocket lets a client follow the events of many addresses, and new heads, over a single connection.
+// Clients send WSRequest messages to subscribe and unsubscribe, and receive WSMessage events. The server pings
+// the client periodically and closes connections that stop answering or fall too far behind. An address the tenant
+// unsubscribes from is no longer followed, and the client gets an unsubscribed message for it.
+func (h Handler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     h.CORS.CheckOrigin,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an HTTP error
+		h.logFor(r).Debugw("websocket", "status", "upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	sub, _ := h.Events.Subscribe(0, wsBuffer)
+	defer h.Events.Unsubscribe(sub)
+
+	replies := make(chan WSMessage, wsRepliesBuffer)
+	done := make(chan struct{})
+
+	// Read client requests until the connection fails
+	go func() {
+		defer close(done)
+
+		conn.SetReadLimit(wsMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			reply := WSMessage{Type: wsError, Message: "message is invalid"}
+			var req WSRequest
+			if err = json.Unmarshal(data, &req); err == nil {
+				reply = wsHandle(h.Parser, auth.Tenant(r.Context()), sub, req)
+			}
+
+			select {
+			case replies <- reply:
+			default:
+				// The client sends requests faster than it reads the replies
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-ping.C:
+			if err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+
+		case msg := <-replies:
+			if err = wsWrite(conn, msg); err != nil {
+				return
+			}
+
+		case msg, ok := <-sub.C:
+			if !ok {
+				closing := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow")
+				conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(wsWriteWait))
+				return
+			}
+			e := msg.Event
+			// The tenant unsubscribed from the address since it followed it: drop its events and tell the client once
+			if e.Address != "" && !h.Parser.IsSubscribed(auth.Tenant(r.Context()), e.Address) {
+				if !sub.Follows(e.Address) {
+					continue
+				}
+				sub.Unfollow(e.Address)
+				msg := WSMessage{Type: wsUnsubscribed, Addresses: []string{e.Address}, Message: "address is no longer subscribed"}
+				if err = wsWrite(conn, msg); err != nil {
+					return
+				}
+				continue
+			}
+			if err = wsWrite(conn, WSMessage{Type: string(e.Type), Seq: msg.Seq, Event: &e}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wsHandle applies a client request of a tenant to the subscription and builds the reply. Tenants can only
+// follow the addresses they are subscribed to.
+func wsHandle(p Parser, tenant string, sub *events.Subscription, req WSRequest) WSMessage {
+	for _, address := range req.Addresses {
+		if address == "" || address == "unknown" {
+			return WSMessage{Type: wsError, Message: "address is invalid"}
+		}
+	}
+
+	switch req.Action {
+	case wsSubscribe:
+		if sub.Addresses()+len(req.Addresses) > wsMaxAddresses {
+			return WSMessage{Type: wsError, Message: "too many addresses"}
+		}
+		for _, address := range req.Addresses {
+			if !p.IsSubscribed(tenant, address) {
+				return WSMessage{Type: wsError, Message: "address " + address + " is not subscribed"}
+			}
+		}
+		sub.Follow(req.Addresses...)
+		if req.Heads {
+			sub.FollowHeads(true)
+		}
+		return WSMessage{Type: wsSubscribed, Addresses: req.Addresses, Heads: req.Heads}
+
+	case wsUnsubscribe:
+		sub.Unfollow(req.Addresses...)
+		if req.Heads {
+			sub.FollowHeads(false)
+		}
+		return WSMessage{Type: wsUnsubscribed, Addresses: req.Addresses, Heads: req.Heads}
+	}
+
+	return WSMessage{Type: wsError, Message: "action is invalid"}
+}
+
+// wsWrite writes a JSON message within the write deadline.
+func wsWrite(conn *websocket.Conn, msg WSMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(msg)
+}
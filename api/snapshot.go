@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"trustwallet/api/server"
+	"trustwallet/business/parser"
+	"trustwallet/business/snapshot"
+	"trustwallet/business/storage"
+)
+
+// exportCmd downloads a snapshot of the storage of a running server, through its admin API, into a file.
+func exportCmd(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := flags.String("out", "export.ndjson.gz", "snapshot file to write, which must not exist yet")
+	serverURL := flags.String("server", "http://127.0.0.1:8080", "base URL of the running server to export")
+	log, err := load(flags, args, false, "stderr")
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	if cfg.Auth.AdminKey == "" {
+		return errors.New("auth.admin_key is required to export a running server, set ADMIN_API_KEY or --auth-admin-key")
+	}
+	if _, err = os.Stat(*out); err == nil {
+		return fmt.Errorf("%s already exists, remove it or choose another -out", *out)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(*serverURL, "/")+server.APIVersion+"/admin/snapshot", nil)
+	if err != nil {
+		return fmt.Errorf("invalid server URL: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.Auth.AdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// The snapshot is read back while it is written, so a truncated download never replaces anything
+	var stats snapshot.Stats
+	err = writeAtomically(*out, func(w io.Writer) error {
+		body := io.TeeReader(resp.Body, w)
+		if stats, err = snapshot.Import(body, storage.NewMemoryStorage()); err != nil {
+			return fmt.Errorf("downloading snapshot: %w", err)
+		}
+		if _, err = io.Copy(io.Discard, body); err != nil {
+			return fmt.Errorf("downloading snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infow("snapshot", "status", "exported", "server", *serverURL, "file", *out, "stats", stats)
+	return nil
+}
+
+// importCmd loads a snapshot file into a new state file, which the maintenance commands work on and serve
+// --restore starts from.
+func importCmd(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := flags.String("in", "export.ndjson.gz", "snapshot file to read")
+	state := stateFlag(flags)
+	log, err := load(flags, args, false, "stderr")
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	if _, err = os.Stat(*state); err == nil {
+		return fmt.Errorf("%s already exists, remove it or choose another -state", *state)
+	}
+
+	store := newStorage()
+	if err = restoreSnapshot(log, store, *in); err != nil {
+		return err
+	}
+	return dumpSnapshot(log, store, *state)
+}
+
+// dumpSnapshot exports the storage into the named file, replacing it only once the snapshot is complete.
+func dumpSnapshot(log *zap.SugaredLogger, store parser.Storage, path string) error {
+	var stats snapshot.Stats
+	err := writeAtomically(path, func(w io.Writer) error {
+		var err error
+		if stats, err = snapshot.Export(w, store); err != nil {
+			return fmt.Errorf("exporting snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infow("snapshot", "status", "exported", "file", path, "stats", stats)
+	return nil
+}
+
+// writeAtomically writes a file through write, into a temporary file of the same directory that is synced then
+// renamed over path, so a failure partway never leaves path truncated.
+func writeAtomically(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = write(f); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("replacing snapshot: %w", err)
+	}
+	return nil
+}
+
+// restoreSnapshot imports the named file into the storage.
+func restoreSnapshot(log *zap.SugaredLogger, store parser.Storage, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer f.Close()
+
+	stats, err := snapshot.Import(f, store)
+	if err != nil {
+		return fmt.Errorf("importing snapshot: %w", err)
+	}
+
+	log.Infow("snapshot", "status", "imported", "file", path, "stats", stats)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"trustwallet/api/server"
+	"trustwallet/business/auth"
+	"trustwallet/business/parser"
+	"trustwallet/business/storage"
+)
+
+// Define a test of a snapshot exported from a running server, imported then restored by a fresh process
+func TestExportImport(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	store := storage.NewMemoryStorage()
+	store.Subscribe("acme", "0x123")
+	tx := parser.Transaction{Hash: "0xaaa", From: "0x123", To: "0x789", Value: "0x1", BlockNumber: big.NewInt(7)}
+	store.CommitBlock(7, map[string][]parser.Transaction{"0x123": {tx}})
+
+	srv := httptest.NewServer(server.APIMux(server.APIMuxConfig{
+		Log:      log,
+		Parser:   parser.NewIdleEthereumParser(store, "", log),
+		Keys:     auth.NewKeys(),
+		AdminKey: "admin-secret",
+		Storage:  store,
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	out, state := filepath.Join(dir, "export.ndjson.gz"), filepath.Join(dir, "state.ndjson.gz")
+
+	if err := exportCmd([]string{"-server", srv.URL, "-out", out, "--auth-admin-key", "wrong"}); err == nil {
+		t.Fatalf("exportCmd succeeded with the wrong admin key")
+	}
+	if err := exportCmd([]string{"-server", srv.URL, "-out", out, "--auth-admin-key", "admin-secret"}); err != nil {
+		t.Fatalf("exportCmd returned error: %v", err)
+	}
+	if err := exportCmd([]string{"-server", srv.URL, "-out", out, "--auth-admin-key", "admin-secret"}); err == nil {
+		t.Errorf("exportCmd overwrote an existing file")
+	}
+
+	if err := importCmd([]string{"-in", out, "-state", state}); err != nil {
+		t.Fatalf("importCmd returned error: %v", err)
+	}
+	if err := importCmd([]string{"-in", out, "-state", state}); err == nil {
+		t.Errorf("importCmd overwrote an existing state")
+	}
+
+	// serve --restore loads the state the same way
+	restored := storage.NewMemoryStorage()
+	if err := restoreSnapshot(log, restored, state); err != nil {
+		t.Fatalf("restoreSnapshot returned error: %v", err)
+	}
+	if got := restored.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{tx}) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, []parser.Transaction{tx})
+	}
+	if got := restored.Owners("0x123"); !reflect.DeepEqual(got, []string{"acme"}) || restored.Checkpoint() != 7 {
+		t.Errorf("restored owners %v at checkpoint %d, expected [acme] at 7", got, restored.Checkpoint())
+	}
+}
@@ -0,0 +1,198 @@
+// Package auth issues the API keys clients authenticate with, and carries the tenant a key belongs to through
+// request contexts.
+//
+// Only the SHA-256 digest of a key is kept, so the key itself is shown once, when it is issued.
+//
+// Example usage:
+//
+//	keys := auth.NewKeys()
+//	key, secret, err := keys.Issue("acme")
+//
+//	// Later, on every request
+//	key, ok := keys.Authenticate(secret)
+//	ctx := auth.WithTenant(ctx, key.Tenant)
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// keyPrefix starts every issued key, so leaked keys are easy to recognise.
+const keyPrefix = "ethp_"
+
+var (
+	// ErrInvalidTenant is returned when a key is issued for an empty tenant.
+	ErrInvalidTenant = errors.New("tenant is invalid")
+
+	// ErrKeyExists is returned when a key is added twice.
+	ErrKeyExists = errors.New("key already exists")
+)
+
+// Key describes an API key, without the key itself.
+type Key struct {
+	ID        string     `json:"id"`
+	Tenant    string     `json:"tenant"`
+	Hint      string     `json:"hint"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Keys keeps the issued API keys. It is safe for concurrent use.
+type Keys struct {
+	lock   sync.RWMutex
+	byHash map[string]*Key
+	byID   map[string]*Key
+}
+
+// NewKeys creates an empty key set.
+func NewKeys() *Keys {
+	return &Keys{
+		byHash: make(map[string]*Key),
+		byID:   make(map[string]*Key),
+	}
+}
+
+// Issue generates a new key for a tenant. The returned secret is what clients send, it cannot be recovered later.
+func (k *Keys) Issue(tenant string) (Key, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, "", err
+	}
+	secret := keyPrefix + hex.EncodeToString(b)
+
+	key, err := k.Add(tenant, secret)
+	return key, secret, err
+}
+
+// Add registers a key chosen by the operator for a tenant, for instance one provisioned through the environment.
+func (k *Keys) Add(tenant, secret string) (Key, error) {
+	if tenant == "" {
+		return Key{}, ErrInvalidTenant
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, err
+	}
+	key := &Key{ID: hex.EncodeToString(b), Tenant: tenant, Hint: hint(secret), CreatedAt: time.Now().UTC()}
+
+	digest := hash(secret)
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if _, ok := k.byHash[digest]; ok {
+		return Key{}, ErrKeyExists
+	}
+	k.byHash[digest] = key
+	k.byID[key.ID] = key
+
+	return *key, nil
+}
+
+// Revoke disables a key. It reports whether the key existed and was active.
+func (k *Keys) Revoke(id string) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	key, ok := k.byID[id]
+	if !ok || key.RevokedAt != nil {
+		return false
+	}
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	return true
+}
+
+// List returns every key, revoked ones included, oldest first.
+func (k *Keys) List() []Key {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	keys := make([]Key, 0, len(k.byID))
+	for _, key := range k.byID {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// Authenticate returns the active key matching a secret.
+func (k *Keys) Authenticate(secret string) (Key, bool) {
+	if secret == "" {
+		return Key{}, false
+	}
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	key, ok := k.byHash[hash(secret)]
+	if !ok || key.RevokedAt != nil {
+		return Key{}, false
+	}
+	return *key, true
+}
+
+// Equal compares two secrets in constant time, for the admin key which is not kept in a Keys set.
+func Equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// FromHeader extracts the key of a request from its X-API-Key header, or its bearer Authorization.
+func FromHeader(apiKey, authorization string) string {
+	if apiKey != "" {
+		return apiKey
+	}
+	if scheme, token, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+type (
+	tenantKey struct{}
+	keyIDKey  struct{}
+)
+
+// WithTenant returns a copy of ctx carrying the tenant of the request.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// WithKey returns a copy of ctx carrying the key the request was authenticated with, and its tenant.
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(WithTenant(ctx, key.Tenant), keyIDKey{}, key.ID)
+}
+
+// KeyID returns the ID of the key carried by ctx, empty when authentication is disabled.
+func KeyID(ctx context.Context) string {
+	id, _ := ctx.Value(keyIDKey{}).(string)
+	return id
+}
+
+// Tenant returns the tenant carried by ctx, the default tenant when authentication is disabled.
+func Tenant(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return parser.DefaultTenant
+}
+
+// hash returns the hex SHA-256 digest of a secret. Keys are random, so a plain digest is enough to store them.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// hint keeps the last characters of a secret, so operators can tell keys apart.
+func hint(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return "…" + secret[len(secret)-4:]
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"trustwallet/business/parser"
+)
+
+// Define a test of the key lifecycle
+func TestKeys(t *testing.T) {
+	keys := NewKeys()
+
+	key, secret, err := keys.Issue("acme")
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+	if !strings.HasPrefix(secret, keyPrefix) || strings.Contains(key.Hint, secret) {
+		t.Errorf("Issue returned %+v and %q, expected a prefixed secret only hinted at by the key", key, secret)
+	}
+	if _, _, err = keys.Issue(""); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("Issue returned %v, expected %v", err, ErrInvalidTenant)
+	}
+	if _, err = keys.Add("globex", secret); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Add returned %v, expected %v", err, ErrKeyExists)
+	}
+
+	if got, ok := keys.Authenticate(secret); !ok || got.Tenant != "acme" {
+		t.Errorf("Authenticate returned %+v, %v, expected the key of acme", got, ok)
+	}
+	if _, ok := keys.Authenticate(secret + "x"); ok {
+		t.Errorf("Authenticate accepted an unknown key")
+	}
+
+	if !keys.Revoke(key.ID) || keys.Revoke(key.ID) {
+		t.Errorf("Revoke should succeed once")
+	}
+	if _, ok := keys.Authenticate(secret); ok {
+		t.Errorf("Authenticate accepted a revoked key")
+	}
+	if list := keys.List(); len(list) != 1 || list[0].RevokedAt == nil {
+		t.Errorf("List returned %+v, expected the revoked key", list)
+	}
+}
+
+// Define a test of the tenant carried by contexts
+func TestTenant(t *testing.T) {
+	if got := Tenant(context.Background()); got != parser.DefaultTenant {
+		t.Errorf("Tenant returned %q, expected %q", got, parser.DefaultTenant)
+	}
+	if got := Tenant(WithTenant(context.Background(), "acme")); got != "acme" {
+		t.Errorf("Tenant returned %q, expected acme", got)
+	}
+	ctx := WithKey(context.Background(), Key{ID: "k1", Tenant: "globex"})
+	if Tenant(ctx) != "globex" || KeyID(ctx) != "k1" {
+		t.Errorf("WithKey returned a context of tenant %q and key %q, expected globex and k1", Tenant(ctx), KeyID(ctx))
+	}
+
+	if got := FromHeader("", "Bearer abc"); got != "abc" {
+		t.Errorf("FromHeader returned %q, expected abc", got)
+	}
+	if got := FromHeader("xyz", "Bearer abc"); got != "xyz" {
+		t.Errorf("FromHeader returned %q, expected xyz", got)
+	}
+}
@@ -0,0 +1,266 @@
+// Package broker publishes the events ingested by the parser to a message broker such as NATS or Kafka, so other
+// services can consume the transaction stream without calling the HTTP API.
+//
+// The Outbox receives the parser events and relays them block by block, in the order they were published. A block
+// only counts as published once the broker acknowledged every one of its events, and failed blocks are sent again
+// in full, which gives at-least-once delivery. Every message carries the stable ID of its event so consumers can
+// drop the duplicates. When too many blocks are pending, the parser waits for the broker rather than losing
+// events, and the last acknowledged block is recorded in the storage next to the checkpoint, so a restarted
+// process replays what was not acknowledged.
+//
+// Example usage:
+//
+//	// Relay the parser events to a NATS JetStream stream, after those the broker missed
+//	b, err := broker.NewNATS("nats://127.0.0.1:4222", "ETHPARSER", []string{"ethparser.>"})
+//	outbox := broker.NewOutbox(b, broker.Config{Prefix: "ethparser", Storage: store}, log)
+//	go outbox.Run(ctx)
+//	after, _ := parser.Position(store, broker.Position)
+//	ethereumParser.AddPublisherAfter(outbox, after)
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// Message is an event encoded for a broker.
+type Message struct {
+	// ID is the stable ID of the event, identical every time the same event is sent.
+	ID string
+
+	// Subject is the subject, or topic, the message is published to: the prefix followed by the event type.
+	Subject string
+
+	// Key groups the messages that must keep their order, the address of the event.
+	Key string
+
+	Data []byte
+}
+
+// Position is the name under which the Outbox records the last acknowledged block in the storage.
+const Position = "broker"
+
+// Broker sends messages to a message broker. Send returns only once the broker acknowledged all of them.
+type Broker interface {
+	Send(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// Config tunes an Outbox. Zero values take the defaults noted on each field.
+type Config struct {
+	Prefix      string         // subject prefix, "ethparser" by default
+	MaxPending  int            // blocks waiting to be published before the parser waits, 10000 by default
+	BaseBackoff time.Duration  // delay before resending a failed block, doubled up to MaxBackoff, 1s by default
+	MaxBackoff  time.Duration  // 1m by default
+	Storage     parser.Storage // records the last acknowledged block as the Position, when it implements parser.Positioner
+}
+
+// Outbox buffers the parser events per block and relays them to a broker in the order they were published.
+type Outbox struct {
+	broker Broker
+	cfg    Config
+	notify chan struct{}
+	Log    *zap.SugaredLogger
+
+	lock      sync.Mutex
+	space     *sync.Cond // signalled when a pending block is published or Run stops
+	pending   []*batch
+	seq       int
+	fence     int // the batches up to this one were published before the last reorganisation
+	published int
+	waits     int
+	stopped   bool
+}
+
+// batch holds the pending events of a block, in the order they were published.
+type batch struct {
+	block  int
+	seq    int // position of the batch in the publication order
+	events []parser.Event
+}
+
+// NewOutbox creates a new Outbox instance
+func NewOutbox(broker Broker, cfg Config, logger *zap.SugaredLogger) *Outbox {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "ethparser"
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 10000
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+
+	o := &Outbox{
+		broker: broker,
+		cfg:    cfg,
+		notify: make(chan struct{}, 1),
+		Log:    logger,
+	}
+	o.space = sync.NewCond(&o.lock)
+	if cfg.Storage != nil {
+		o.published, _ = parser.Position(cfg.Storage, Position)
+	}
+	return o
+}
+
+// Publish adds an event to the pending block it belongs to. When too many blocks are pending because the broker
+// is unreachable, it blocks the parser until the broker catches up. Events published once Run stopped are
+// dropped, the process is shutting down and replays them from the recorded position on its next start.
+//
+// The reorg event announcing a reorganisation moves the recorded position back to the fork, so the blocks of the
+// new chain are replayed unless the broker acknowledged them.
+func (o *Outbox) Publish(e parser.Event) {
+	reorg := e.Type == parser.EventReorg && e.Address == ""
+
+	o.lock.Lock()
+	full := func() bool {
+		n := len(o.pending)
+		return n >= o.cfg.MaxPending && (reorg || o.pending[n-1].block != e.Block) && !o.stopped
+	}
+	if full() {
+		o.waits++
+		o.Log.Warnw("outbox", "status", "waiting", "block", e.Block, "pending", len(o.pending))
+		for full() {
+			o.space.Wait()
+		}
+	}
+	if o.stopped {
+		o.lock.Unlock()
+		return
+	}
+
+	if reorg {
+		// the blocks acknowledged or pending so far left the chain after the fork
+		o.fence = o.seq
+		if e.Fork < o.published {
+			o.setPublished(e.Fork)
+		}
+	}
+	if n := len(o.pending); n > 0 && o.pending[n-1].block == e.Block && !reorg {
+		o.pending[n-1].events = append(o.pending[n-1].events, e)
+	} else {
+		o.seq++
+		o.pending = append(o.pending, &batch{block: e.Block, seq: o.seq, events: []parser.Event{e}})
+	}
+	o.lock.Unlock()
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Published returns the last block whose events were all acknowledged by the broker.
+func (o *Outbox) Published() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.published
+}
+
+// Stats returns the number of pending blocks and of times the parser waited because too many blocks were pending.
+func (o *Outbox) Stats() (pending, waits int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.pending), o.waits
+}
+
+// Run relays the pending blocks to the broker, in the order they were published, until the context is cancelled.
+// The parser stops waiting for it then.
+func (o *Outbox) Run(ctx context.Context) {
+	defer func() {
+		o.lock.Lock()
+		o.stopped = true
+		o.space.Broadcast()
+		o.lock.Unlock()
+	}()
+
+	backoff := o.cfg.BaseBackoff
+	for {
+		b, events, ok := o.oldest()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-o.notify:
+				continue
+			}
+		}
+
+		if err := o.send(ctx, events); err != nil {
+			o.Log.Errorw("outbox", "status", "send failed", "block", b.block, "events", len(events), "backoff", backoff, "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > o.cfg.MaxBackoff {
+				backoff = o.cfg.MaxBackoff
+			}
+			continue
+		}
+		backoff = o.cfg.BaseBackoff
+
+		o.lock.Lock()
+		// Events of the block may have arrived while sending, keep those for the next round
+		if rest := b.events[len(events):]; len(rest) > 0 {
+			b.events = rest
+		} else {
+			o.pending = o.pending[1:]
+			o.space.Broadcast()
+			// the new head closes the events of a block, and the blocks published before a reorganisation no
+			// longer count
+			if events[len(events)-1].Type == parser.EventNewHead && b.seq > o.fence {
+				o.setPublished(b.block)
+			}
+		}
+		o.lock.Unlock()
+	}
+}
+
+// setPublished records the last acknowledged block. The lock must be held.
+func (o *Outbox) setPublished(block int) {
+	o.published = block
+	if o.cfg.Storage != nil {
+		parser.SetPosition(o.cfg.Storage, Position, block)
+	}
+}
+
+// oldest returns the oldest pending batch, with the events it holds so far.
+func (o *Outbox) oldest() (*batch, []parser.Event, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.pending) == 0 {
+		return nil, nil, false
+	}
+
+	b := o.pending[0]
+	return b, b.events[:len(b.events):len(b.events)], true
+}
+
+// send encodes events and hands them to the broker.
+func (o *Outbox) send(ctx context.Context, events []parser.Event) error {
+	msgs := make([]Message, 0, len(events))
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("encoding event %s: %w", e.Key(), err)
+		}
+		msgs = append(msgs, Message{
+			ID:      e.Key(),
+			Subject: o.cfg.Prefix + "." + string(e.Type),
+			Key:     e.Address,
+			Data:    data,
+		})
+	}
+
+	return o.broker.Send(ctx, msgs)
+}
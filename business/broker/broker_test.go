@@ -0,0 +1,258 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"trustwallet/business/parser"
+	"trustwallet/business/storage"
+)
+
+// flakyBroker fails the first sends, then records the messages
+type flakyBroker struct {
+	lock     sync.Mutex
+	failures int
+	sent     []Message
+}
+
+func (fb *flakyBroker) Send(_ context.Context, msgs []Message) error {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	if fb.failures > 0 {
+		fb.failures--
+		return errors.New("broker unavailable")
+	}
+	fb.sent = append(fb.sent, msgs...)
+	return nil
+}
+
+func (fb *flakyBroker) Close() error {
+	return nil
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Define a test for the ordering and retries of the Outbox
+func TestOutboxRetries(t *testing.T) {
+	fb := &flakyBroker{failures: 2}
+	o := NewOutbox(fb, Config{BaseBackoff: time.Millisecond}, zap.NewNop().Sugar())
+
+	o.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 1, Transaction: &parser.Transaction{Hash: "0xa"}})
+	o.Publish(parser.Event{Type: parser.EventNewHead, Block: 1})
+	o.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 2, Transaction: &parser.Transaction{Hash: "0xb"}})
+	o.Publish(parser.Event{Type: parser.EventNewHead, Block: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	waitFor(t, func() bool { return o.Published() == 2 })
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	if len(fb.sent) != 4 {
+		t.Fatalf("broker received %d messages, expected 4", len(fb.sent))
+	}
+	if fb.sent[0].ID != "transaction:1:0xa:0x123" || fb.sent[0].Subject != "ethparser.transaction" {
+		t.Errorf("first message is %+v, expected the transaction of block 1", fb.sent[0])
+	}
+	if fb.sent[3].Subject != "ethparser.new_head" {
+		t.Errorf("last message is %+v, expected the new head of block 2", fb.sent[3])
+	}
+}
+
+// Define a test for the events of a reorganisation going through the Outbox
+func TestOutboxReorg(t *testing.T) {
+	fb := &flakyBroker{}
+	store := storage.NewMemoryStorage()
+	store.SetPosition(Position, 3)
+	o := NewOutbox(fb, Config{Storage: store}, zap.NewNop().Sugar())
+
+	// Block 4 of the old chain is still pending when block 5 forks from block 2
+	o.Publish(parser.Event{Type: parser.EventNewHead, Block: 4})
+	o.Publish(parser.Event{Type: parser.EventReorg, Block: 5, Fork: 2})
+	o.Publish(parser.Event{Type: parser.EventReorg, Address: "0x123", Block: 5, Fork: 2, Transaction: &parser.Transaction{Hash: "0xa"}})
+	if got, _ := parser.Position(store, Position); got != 2 {
+		t.Errorf("Position returned %d once the reorganisation was published, expected the fork 2", got)
+	}
+	o.Publish(parser.Event{Type: parser.EventNewHead, Block: 3})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	waitFor(t, func() bool {
+		pending, _ := o.Stats()
+		return pending == 0
+	})
+	if got := o.Published(); got != 3 {
+		t.Errorf("Published returned %d, expected block 3 of the new chain rather than block 4 of the old one", got)
+	}
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	var ids []string
+	for _, msg := range fb.sent {
+		ids = append(ids, msg.ID)
+	}
+	expected := []string{"new_head:4:", "reorg:5:", "reorg:5:0xa:0x123", "new_head:3:"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("broker received %v, expected %v", ids, expected)
+	}
+}
+
+// Define a test for the backpressure of the Outbox and the block it records
+func TestOutboxBackpressure(t *testing.T) {
+	fb := &flakyBroker{}
+	store := storage.NewMemoryStorage()
+	store.SetPosition(Position, 3)
+	o := NewOutbox(fb, Config{MaxPending: 1, Storage: store}, zap.NewNop().Sugar())
+	if got := o.Published(); got != 3 {
+		t.Errorf("Published returned %d, expected the recorded block 3", got)
+	}
+
+	o.Publish(parser.Event{Type: parser.EventNewHead, Block: 4})
+	done := make(chan struct{})
+	go func() {
+		o.Publish(parser.Event{Type: parser.EventNewHead, Block: 5})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Publish returned while too many blocks were pending")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, waits := o.Stats(); waits != 1 {
+		t.Errorf("Stats returned %d waits, expected 1", waits)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	<-done
+	waitFor(t, func() bool { return o.Published() == 5 })
+	if got, _ := parser.Position(store, Position); got != 5 {
+		t.Errorf("Position returned %d, expected 5", got)
+	}
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	if len(fb.sent) != 2 {
+		t.Errorf("broker received %d messages, expected 2", len(fb.sent))
+	}
+}
+
+// Define a test for the NATS broker against an embedded server
+func TestNATS(t *testing.T) {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("creating NATS server: %v", err)
+	}
+	go srv.Start()
+	defer srv.Shutdown()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	consumer, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connecting consumer: %v", err)
+	}
+	defer consumer.Close()
+	received := make(chan *nats.Msg, 1)
+	if _, err = consumer.ChanSubscribe("ethparser.>", received); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	consumer.Flush()
+
+	b, err := NewNATS(srv.ClientURL(), "ETHPARSER", []string{"ethparser.>"})
+	if err != nil {
+		t.Fatalf("NewNATS returned error: %v", err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := NewOutbox(b, Config{}, zap.NewNop().Sugar())
+	go o.Run(ctx)
+
+	e := parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 7, Transaction: &parser.Transaction{Hash: "0xaaa"}}
+	o.Publish(e)
+
+	select {
+	case msg := <-received:
+		var got parser.Event
+		if err = json.Unmarshal(msg.Data, &got); err != nil || got.Transaction.Hash != "0xaaa" {
+			t.Errorf("received %s, expected the transaction event", msg.Data)
+		}
+		if msg.Subject != "ethparser.transaction" || msg.Header.Get(nats.MsgIdHdr) != e.Key() {
+			t.Errorf("received %s with id %q, expected ethparser.transaction with id %q", msg.Subject, msg.Header.Get(nats.MsgIdHdr), e.Key())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	// The stream acknowledged the event, and drops it when resent
+	if err = b.Send(ctx, []Message{{ID: e.Key(), Subject: "ethparser.transaction", Data: []byte("{}")}}); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	js, _ := consumer.JetStream()
+	info, err := js.StreamInfo("ETHPARSER")
+	if err != nil {
+		t.Fatalf("StreamInfo returned error: %v", err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("stream holds %d messages, expected 1", info.State.Msgs)
+	}
+}
+
+// kafkaStub records the messages written to it
+type kafkaStub struct {
+	msgs []kafka.Message
+}
+
+func (ks *kafkaStub) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	ks.msgs = append(ks.msgs, msgs...)
+	return nil
+}
+
+func (ks *kafkaStub) Close() error {
+	return nil
+}
+
+// Define a test for the encoding of the Kafka broker
+func TestKafka(t *testing.T) {
+	stub := &kafkaStub{}
+	k := NewKafkaWriter(stub)
+
+	err := k.Send(context.Background(), []Message{{ID: "transaction:7:0xaaa:0x123", Subject: "ethparser.transaction", Key: "0x123", Data: []byte("{}")}})
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if len(stub.msgs) != 1 {
+		t.Fatalf("writer received %d messages, expected 1", len(stub.msgs))
+	}
+	msg := stub.msgs[0]
+	if msg.Topic != "ethparser-transaction" || string(msg.Key) != "0x123" || string(msg.Headers[0].Value) != "transaction:7:0xaaa:0x123" {
+		t.Errorf("writer received %+v, expected topic ethparser-transaction keyed by address", msg)
+	}
+}
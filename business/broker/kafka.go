@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"strings"
+)
+
+// KafkaWriter is the part of a kafka.Writer the Kafka broker uses.
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Kafka publishes messages to Kafka, or any broker speaking its protocol. The subject becomes the topic, with
+// dots replaced by dashes, the address is the message key so the events of an address stay ordered within a
+// partition, and the event ID is sent as the event-id header.
+type Kafka struct {
+	writer KafkaWriter
+}
+
+// NewKafka creates a broker writing to the given bootstrap servers, waiting for every in-sync replica.
+func NewKafka(brokers []string) *Kafka {
+	return NewKafkaWriter(&kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	})
+}
+
+// NewKafkaWriter creates a broker over an existing writer.
+func NewKafkaWriter(writer KafkaWriter) *Kafka {
+	return &Kafka{writer: writer}
+}
+
+func (k *Kafka) Send(ctx context.Context, msgs []Message) error {
+	kmsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kmsgs = append(kmsgs, kafka.Message{
+			Topic:   strings.ReplaceAll(msg.Subject, ".", "-"),
+			Key:     []byte(msg.Key),
+			Value:   msg.Data,
+			Headers: []kafka.Header{{Key: "event-id", Value: []byte(msg.ID)}},
+		})
+	}
+	return k.writer.WriteMessages(ctx, kmsgs...)
+}
+
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes messages to a NATS JetStream stream and waits for the stream to acknowledge them. The event ID is
+// set as the Nats-Msg-Id header, so the stream drops the events resent within its duplicate window.
+type NATS struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// NewNATS connects to the NATS server at url and makes sure the JetStream stream exists, creating it on the
+// given subjects when it is missing.
+func NewNATS(url, stream string, subjects []string, options ...nats.Option) (*NATS, error) {
+	conn, err := nats.Connect(url, options...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, err = js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{Name: stream, Subjects: subjects})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("stream %s: %w", stream, err)
+	}
+	return &NATS{conn: conn, js: js}, nil
+}
+
+// Send publishes the messages to the stream and returns once it acknowledged all of them.
+func (n *NATS) Send(ctx context.Context, msgs []Message) error {
+	acks := make([]nats.PubAckFuture, 0, len(msgs))
+	for _, msg := range msgs {
+		m := nats.NewMsg(msg.Subject)
+		m.Header.Set(nats.MsgIdHdr, msg.ID)
+		m.Data = msg.Data
+		ack, err := n.js.PublishMsgAsync(m)
+		if err != nil {
+			return err
+		}
+		acks = append(acks, ack)
+	}
+
+	for _, ack := range acks {
+		select {
+		case <-ack.Ok():
+		case err := <-ack.Err():
+			return fmt.Errorf("message %s: %w", ack.Msg().Header.Get(nats.MsgIdHdr), err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
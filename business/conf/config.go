@@ -0,0 +1,309 @@
+// Package conf loads the settings of a command from, in increasing order of precedence, their defaults, a YAML
+// file, the environment and the command line flags.
+//
+// Settings are the fields of a struct, grouped in nested structs and described by their tags:
+//
+//	type Config struct {
+//		HTTP struct {
+//			Addr string `yaml:"addr" env:"HTTP_ADDR" usage:"listen address of the HTTP API"`
+//		} `yaml:"http"`
+//	}
+//
+// The YAML key of a setting is the path of its yaml tags, here http.addr, and its flag is the same path joined by
+// dashes, --http-addr. The env tag may list several variables separated by commas, the first one set wins. The
+// values of the struct passed to Parse are the defaults.
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileFlag names the flag, and FileEnv the environment variable, giving the YAML file to read.
+const (
+	FileFlag = "config"
+	FileEnv  = "CONFIG_FILE"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is a field of the configuration struct.
+type setting struct {
+	key   string   // YAML path, such as http.addr
+	flag  string   // flag name, such as http-addr
+	env   []string // environment variables, by precedence
+	usage string
+	value reflect.Value
+}
+
+// Parse fills cfg, a pointer to a struct, from the YAML file named by the --config flag or the CONFIG_FILE
+// variable, then the environment read through lookupEnv, then args. The flags of the settings are registered on
+// fs, which may hold flags of its own, and which prints their help when args ask for it. Empty environment
+// variables are ignored, like unset ones.
+func Parse(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool), cfg any) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("conf: cfg must be a pointer to a struct")
+	}
+	settings, err := collect(v.Elem(), "")
+	if err != nil {
+		return err
+	}
+
+	// Flags are only recorded while parsing, and applied last
+	var flagged []*flagValue
+	for _, s := range settings {
+		fv := &flagValue{setting: s, def: format(s.value)}
+		fs.Var(fv, s.flag, s.help())
+		flagged = append(flagged, fv)
+	}
+	file := fs.String(FileFlag, "", "YAML file of the settings (env "+FileEnv+")")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := *file
+	if path == "" {
+		path, _ = lookupEnv(FileEnv)
+	}
+	if path != "" {
+		if err = readFile(path, cfg); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range settings {
+		for _, env := range s.env {
+			value, ok := lookupEnv(env)
+			if !ok || value == "" {
+				continue
+			}
+			if err = set(s.value, value); err != nil {
+				return fmt.Errorf("conf: %s: %w", env, err)
+			}
+			break
+		}
+	}
+
+	for _, fv := range flagged {
+		if !fv.set {
+			continue
+		}
+		if err = set(fv.setting.value, fv.raw); err != nil {
+			return fmt.Errorf("conf: --%s: %w", fv.setting.flag, err)
+		}
+	}
+
+	return nil
+}
+
+// readFile decodes a YAML file over cfg, rejecting the keys that match no setting.
+func readFile(path string, cfg any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("conf: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(cfg)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	// The nested structs are anonymous, so their type only makes the errors unreadable
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for i, e := range typeErr.Errors {
+			typeErr.Errors[i], _, _ = strings.Cut(e, " in type ")
+		}
+	}
+	return fmt.Errorf("conf: %s: %w", path, err)
+}
+
+// collect lists the settings of a struct, descending into the nested structs.
+func collect(v reflect.Value, prefix string) ([]*setting, error) {
+	var settings []*setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		key := prefix + name
+
+		if field.Type.Kind() == reflect.Struct {
+			nested, err := collect(v.Field(i), key+".")
+			if err != nil {
+				return nil, err
+			}
+			settings = append(settings, nested...)
+			continue
+		}
+
+		if _, err := parse(field.Type, ""); errors.Is(err, errUnsupported) {
+			return nil, fmt.Errorf("conf: %s: unsupported type %s", key, field.Type)
+		}
+		s := &setting{
+			key:   key,
+			flag:  strings.NewReplacer(".", "-", "_", "-").Replace(key),
+			usage: field.Tag.Get("usage"),
+			value: v.Field(i),
+		}
+		if env := field.Tag.Get("env"); env != "" {
+			s.env = strings.Split(env, ",")
+		}
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+// help is the flag usage of a setting, telling where else it can be set. The type of the value is quoted for the
+// flag package to show it in place of "value".
+func (s *setting) help() string {
+	where := "yaml " + s.key
+	if len(s.env) > 0 {
+		where = "env " + strings.Join(s.env, " or ") + ", " + where
+	}
+	switch t := s.value.Type(); {
+	case t == durationType:
+		where = "`duration`, " + where
+	case t.Kind() == reflect.Slice:
+		where = "comma separated `list`, " + where
+	case t.Kind() != reflect.Bool:
+		where = "`" + t.Kind().String() + "`, " + where
+	}
+	return s.usage + " (" + where + ")"
+}
+
+var errUnsupported = errors.New("unsupported type")
+
+// parse converts the text of a setting into a value of type t. Lists are comma separated.
+func parse(t reflect.Type, text string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case t == durationType:
+		if text == "" {
+			return v, nil
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(d))
+	case t.Kind() == reflect.String:
+		v.SetString(text)
+	case t.Kind() == reflect.Bool:
+		if text == "" {
+			return v, nil
+		}
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		if text == "" {
+			return v, nil
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case t.Kind() == reflect.Float64:
+		if text == "" {
+			return v, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(t))
+	default:
+		return v, errUnsupported
+	}
+	return v, nil
+}
+
+// set parses text into the field v.
+func set(v reflect.Value, text string) error {
+	parsed, err := parse(v.Type(), text)
+	if err != nil {
+		return err
+	}
+	v.Set(parsed)
+	return nil
+}
+
+// format writes the value of a setting the way parse reads it.
+func format(v reflect.Value) string {
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// flagValue records the text of a setting given on the command line, so it can be applied after the file and
+// the environment.
+type flagValue struct {
+	setting *setting
+	def     string
+	raw     string
+	set     bool
+}
+
+func (fv *flagValue) String() string {
+	if fv == nil || fv.setting == nil {
+		return ""
+	}
+	if fv.set {
+		return fv.raw
+	}
+	return fv.def
+}
+
+// Set checks the text parses, reporting invalid flags along with the help.
+func (fv *flagValue) Set(text string) error {
+	if _, err := parse(fv.setting.value.Type(), text); err != nil {
+		return err
+	}
+	fv.raw, fv.set = text, true
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be switched on by their flag alone, such as --features-graphql.
+func (fv *flagValue) IsBoolFlag() bool {
+	return fv.setting != nil && fv.setting.value.Kind() == reflect.Bool
+}
@@ -0,0 +1,143 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig holds a setting of every supported type
+type testConfig struct {
+	Node struct {
+		URL      string        `yaml:"url" env:"NODE_URL,LEGACY_NODE_URL" usage:"node endpoint"`
+		Interval time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" usage:"polling interval"`
+	} `yaml:"node"`
+	Workers int      `yaml:"workers" env:"WORKERS" usage:"number of workers"`
+	Ratio   float64  `yaml:"ratio" usage:"sample ratio"`
+	Enabled bool     `yaml:"enabled" env:"ENABLED" usage:"feature toggle"`
+	Origins []string `yaml:"origins" env:"ORIGINS" usage:"allowed origins"`
+}
+
+// env returns a lookup function reading the given variables
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+// writeFile writes a YAML configuration file in a temporary directory
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Define a test of the precedence of the defaults, the file, the environment and the flags
+func TestParsePrecedence(t *testing.T) {
+	path := writeFile(t, "node:\n  url: http://file\n  poll_interval: 3s\nworkers: 2\nratio: 0.5\norigins: [https://a.example]\n")
+
+	var cfg testConfig
+	cfg.Node.Interval = time.Second
+	cfg.Workers = 1
+	cfg.Enabled = true
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	args := []string{"--config", path, "--workers", "4", "--enabled=false"}
+	if err := Parse(fs, args, env(map[string]string{"LEGACY_NODE_URL": "http://env", "WORKERS": "3", "ORIGINS": "https://b.example, https://c.example", "POLL_INTERVAL": ""}), &cfg); err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	if cfg.Node.URL != "http://env" {
+		t.Errorf("node.url is %q, expected the environment to override the file", cfg.Node.URL)
+	}
+	if cfg.Node.Interval != 3*time.Second {
+		t.Errorf("node.poll_interval is %v, expected the file to override the default, and empty variables ignored", cfg.Node.Interval)
+	}
+	if cfg.Workers != 4 {
+		t.Errorf("workers is %d, expected the flag to override the environment", cfg.Workers)
+	}
+	if cfg.Ratio != 0.5 {
+		t.Errorf("ratio is %v, expected 0.5 from the file", cfg.Ratio)
+	}
+	if cfg.Enabled {
+		t.Errorf("enabled is true, expected the flag to switch it off")
+	}
+	if want := []string{"https://b.example", "https://c.example"}; !reflect.DeepEqual(cfg.Origins, want) {
+		t.Errorf("origins is %q, expected %q", cfg.Origins, want)
+	}
+}
+
+// Define a test of the file given by the environment
+func TestParseFileEnv(t *testing.T) {
+	path := writeFile(t, "workers: 7\n")
+
+	var cfg testConfig
+	if err := Parse(flag.NewFlagSet("test", flag.ContinueOnError), nil, env(map[string]string{FileEnv: path}), &cfg); err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if cfg.Workers != 7 {
+		t.Errorf("workers is %d, expected 7 from the file", cfg.Workers)
+	}
+}
+
+// Define a test of the invalid settings
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown key", file: "node:\n  uri: http://file\n", want: "field uri not found"},
+		{name: "file type", file: "workers: many\n", want: "cannot unmarshal"},
+		{name: "env", env: map[string]string{"WORKERS": "many"}, want: "WORKERS"},
+		{name: "flag", args: []string{"--node-poll-interval", "often"}, want: "node-poll-interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "--config", writeFile(t, tt.file))
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(&bytes.Buffer{})
+
+			var cfg testConfig
+			err := Parse(fs, args, env(tt.env), &cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse returned %v, expected an error about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Define a test of the help listing every setting
+func TestParseHelp(t *testing.T) {
+	var cfg testConfig
+	cfg.Workers = 1
+
+	var out bytes.Buffer
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&out)
+	if err := Parse(fs, []string{"--help"}, env(nil), &cfg); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("Parse returned %v, expected %v", err, flag.ErrHelp)
+	}
+
+	help := out.String()
+	for _, want := range []string{"-node-url", "env NODE_URL or LEGACY_NODE_URL, yaml node.url", "-workers", "(default 1)", "-ratio", "-config"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help does not mention %q:\n%s", want, help)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package events provides an in-process bus fanning out the events published by the parser to live consumers
+// such as the streaming endpoints of the API.
+//
+// Every event gets a sequence number, and the bus keeps the most recent ones so a consumer that reconnects can
+// resume right after the last sequence it saw.
+//
+// Example usage:
+//
+//	// Create a bus remembering the last 1000 events and feed it from the parser
+//	bus := events.NewBus(1000)
+//	ethereumParser.AddPublisher(bus)
+//
+//	// Follow an address, replaying what was missed after sequence 42
+//	sub, missed := bus.Subscribe(42, 64, "0x123abc")
+//	defer bus.Unsubscribe(sub)
+//	for msg := range sub.C { ... }
+package events
+
+import (
+	"sync"
+	"trustwallet/business/parser"
+)
+
+// Message is an event along with its sequence number on the bus.
+type Message struct {
+	Seq   uint64
+	Event parser.Event
+}
+
+// Subscription receives the messages of the addresses it follows on C. The bus closes C when the subscription
+// is removed or when the consumer falls too far behind and its buffer fills up.
+type Subscription struct {
+	C <-chan Message
+
+	c         chan Message
+	lock      sync.Mutex
+	addresses map[string]bool
+	heads     bool
+}
+
+// FollowHeads sets whether the subscription receives new head events.
+func (s *Subscription) FollowHeads(on bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.heads = on
+}
+
+// Follow adds addresses to the subscription.
+func (s *Subscription) Follow(addresses ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, address := range addresses {
+		s.addresses[address] = true
+	}
+}
+
+// Unfollow removes addresses from the subscription.
+func (s *Subscription) Unfollow(addresses ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, address := range addresses {
+		delete(s.addresses, address)
+	}
+}
+
+// Follows reports whether the subscription follows an address.
+func (s *Subscription) Follows(address string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addresses[address]
+}
+
+// Addresses returns the number of addresses the subscription follows.
+func (s *Subscription) Addresses() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.addresses)
+}
+
+// wants reports whether the subscription follows the address of an event, or the events of the chain itself such
+// as new heads.
+func (s *Subscription) wants(e parser.Event) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e.Address == "" {
+		return s.heads
+	}
+	return s.addresses[e.Address]
+}
+
+// Bus fans out published events to subscriptions and keeps a bounded history for resuming.
+type Bus struct {
+	lock    sync.Mutex
+	seq     uint64
+	history []Message
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+// NewBus creates a bus remembering the last size events.
+func NewBus(size int) *Bus {
+	return &Bus{
+		size: size,
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the next sequence number to an event and delivers it to the matching subscriptions
+// without blocking. Subscriptions with a full buffer are dropped.
+func (b *Bus) Publish(e parser.Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.seq++
+	msg := Message{Seq: b.seq, Event: e}
+	if b.size > 0 {
+		if len(b.history) == b.size {
+			b.history = b.history[1:]
+		}
+		b.history = append(b.history, msg)
+	}
+
+	for sub := range b.subs {
+		if !sub.wants(e) {
+			continue
+		}
+		select {
+		case sub.c <- msg:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscription following the given addresses with room for buffer pending messages.
+// It also returns the remembered messages of those addresses published after sequence after, so the caller
+// can send them before reading from C. An after of 0 skips the replay.
+func (b *Bus) Subscribe(after uint64, buffer int, addresses ...string) (*Subscription, []Message) {
+	c := make(chan Message, buffer)
+	sub := &Subscription{C: c, c: c, addresses: make(map[string]bool)}
+	sub.Follow(addresses...)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var missed []Message
+	if after > 0 {
+		for _, msg := range b.history {
+			if msg.Seq > after && sub.wants(msg.Event) {
+				missed = append(missed, msg)
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub, missed
+}
+
+// Unsubscribe removes a subscription and closes its channel. It is safe to call more than once.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.remove(sub)
+}
+
+// Seq returns the sequence number of the last published event.
+func (b *Bus) Seq() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.seq
+}
+
+// remove drops a subscription. The caller must hold the lock.
+func (b *Bus) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.c)
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"testing"
+	"trustwallet/business/parser"
+)
+
+// Define a test for delivery, replay and backpressure of the Bus
+func TestBus(t *testing.T) {
+	bus := NewBus(2)
+
+	sub, missed := bus.Subscribe(0, 1, "0x123")
+	if len(missed) != 0 {
+		t.Errorf("Subscribe replayed %d messages, expected none", len(missed))
+	}
+
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x456", Block: 1})
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 2})
+	if msg := <-sub.C; msg.Seq != 2 || msg.Event.Block != 2 {
+		t.Errorf("received %+v, expected sequence 2 for block 2", msg)
+	}
+
+	// The second message for the address overflows the buffer of 1 and drops the subscription
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 3})
+	bus.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 4})
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Errorf("subscription should be closed once its buffer overflows")
+	}
+	bus.Unsubscribe(sub)
+
+	// Resuming after sequence 2 replays what the history still holds
+	_, missed = bus.Subscribe(2, 1, "0x123")
+	if len(missed) != 2 || missed[0].Seq != 3 || missed[1].Seq != 4 {
+		t.Errorf("Subscribe replayed %+v, expected sequences 3 and 4", missed)
+	}
+}
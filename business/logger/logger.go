@@ -3,14 +3,62 @@
 package logger
 
 import (
+	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"time"
 )
 
+// Config selects how a logger filters, encodes and throttles its entries.
+type Config struct {
+	// Level is the lowest level logged. It is shared with the logger, so setting it changes the level of the
+	// running logger, for instance from an admin endpoint.
+	Level zap.AtomicLevel
+
+	// Encoding is json, the default, or console for human readers.
+	Encoding string
+
+	// Of the entries with the same level and message logged within a second, the first SampleInitial are kept,
+	// then one in every SampleThereafter. Sampling is disabled when SampleInitial is 0.
+	SampleInitial    int
+	SampleThereafter int
+
+	// ErrorInterval is the time an error is not logged again for once logged, when it repeats the same message
+	// and error. The next one logged reports how many were dropped. 0 logs every error.
+	ErrorInterval time.Duration
+}
+
 // New constructs a Sugared Logger that writes to stdout and
 // provides human-readable timestamps.
 func New(service string, outputPaths ...string) (*zap.SugaredLogger, error) {
+	return NewAt(service, zapcore.InfoLevel, outputPaths...)
+}
+
+// NewAt constructs a logger like New, that drops the entries below level.
+func NewAt(service string, level zapcore.Level, outputPaths ...string) (*zap.SugaredLogger, error) {
+	return NewWith(service, Config{Level: zap.NewAtomicLevelAt(level), SampleInitial: 100, SampleThereafter: 100}, outputPaths...)
+}
+
+// NewWith constructs a logger like New, configured by cfg.
+func NewWith(service string, cfg Config, outputPaths ...string) (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
+	config.Level = cfg.Level
+	if config.Level == (zap.AtomicLevel{}) {
+		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	}
+
+	switch cfg.Encoding {
+	case "", "json":
+	case "console":
+		config.Encoding = "console"
+	default:
+		return nil, fmt.Errorf("unknown encoding %q, expected json or console", cfg.Encoding)
+	}
+
+	config.Sampling = nil
+	if cfg.SampleInitial > 0 {
+		config.Sampling = &zap.SamplingConfig{Initial: cfg.SampleInitial, Thereafter: cfg.SampleThereafter}
+	}
 
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	config.DisableStacktrace = true
@@ -23,7 +71,14 @@ func New(service string, outputPaths ...string) (*zap.SugaredLogger, error) {
 		config.OutputPaths = outputPaths
 	}
 
-	log, err := config.Build(zap.WithCaller(true))
+	options := []zap.Option{zap.WithCaller(true)}
+	if cfg.ErrorInterval > 0 {
+		options = append(options, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newThrottledCore(core, cfg.ErrorInterval)
+		}))
+	}
+
+	log, err := config.Build(options...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Define a test of the repeated errors dropped within the interval
+func TestThrottledErrors(t *testing.T) {
+	observed, logs := observer.New(zapcore.DebugLevel)
+	core := newThrottledCore(observed, time.Minute)
+	now := time.Unix(1700000000, 0)
+	core.state.now = func() time.Time { return now }
+	log := zap.New(core).Sugar()
+
+	outage := errors.New("connection refused")
+	for i := 0; i < 5; i++ {
+		log.With("address", i).Errorw("fetching block", "error", outage)
+		log.Warnw("fetching block", "error", outage)
+	}
+	log.Errorw("fetching block", "error", errors.New("timeout"))
+
+	if got := logs.FilterLevelExact(zapcore.ErrorLevel).Len(); got != 2 {
+		t.Errorf("logged %d errors, expected the first of each distinct error", got)
+	}
+	if got := logs.FilterLevelExact(zapcore.WarnLevel).Len(); got != 5 {
+		t.Errorf("logged %d warnings, expected all of them", got)
+	}
+
+	now = now.Add(time.Minute)
+	log.Errorw("fetching block", "error", outage)
+	last := logs.All()[logs.Len()-1]
+	if last.ContextMap()["repeated"] != int64(4) {
+		t.Errorf("logged %v, expected the 4 dropped errors reported", last.ContextMap())
+	}
+}
+
+// Define a test of the level changed while the logger runs, and of the console encoding
+func TestNewWith(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	level := zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	log, err := NewWith("test", Config{Level: level, Encoding: "console"}, path)
+	if err != nil {
+		t.Fatalf("NewWith returned error: %v", err)
+	}
+
+	log.Infow("dropped")
+	level.SetLevel(zapcore.InfoLevel)
+	log.Infow("kept")
+	log.Sync()
+
+	out, _ := os.ReadFile(path)
+	if strings.Contains(string(out), "dropped") || !strings.Contains(string(out), "\tinfo\t") || !strings.Contains(string(out), "\tkept\t") {
+		t.Errorf("logged %q, expected only the entry after the level was lowered, in console encoding", out)
+	}
+
+	if _, err = NewWith("test", Config{Encoding: "xml"}); err == nil {
+		t.Errorf("NewWith accepted an unknown encoding")
+	}
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"time"
+)
+
+// maxThrottled bounds the distinct errors remembered, the oldest ones are forgotten past it.
+const maxThrottled = 1000
+
+// throttledCore drops the error entries repeating one logged less than an interval ago, so a failing
+// dependency logs its error once per interval instead of once per caller. Entries below the error level pass
+// through unchanged.
+type throttledCore struct {
+	zapcore.Core
+	interval time.Duration
+	state    *throttleState
+}
+
+// throttleState is shared by a core and the ones derived from it with With.
+type throttleState struct {
+	sync.Mutex
+	now  func() time.Time
+	seen map[string]*occurrence
+}
+
+// occurrence is when an error was last logged, and how many times it was dropped since.
+type occurrence struct {
+	logged  time.Time
+	dropped int
+}
+
+func newThrottledCore(core zapcore.Core, interval time.Duration) *throttledCore {
+	return &throttledCore{
+		Core:     core,
+		interval: interval,
+		state:    &throttleState{now: time.Now, seen: make(map[string]*occurrence)},
+	}
+}
+
+func (c *throttledCore) With(fields []zapcore.Field) zapcore.Core {
+	return &throttledCore{Core: c.Core.With(fields), interval: c.interval, state: c.state}
+}
+
+func (c *throttledCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < zapcore.ErrorLevel {
+		return c.Core.Check(ent, ce)
+	}
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *throttledCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	dropped, ok := c.state.allow(ent.Level.String()+"\x00"+ent.Message+"\x00"+errorOf(fields), c.interval)
+	if !ok {
+		return nil
+	}
+	if dropped > 0 {
+		fields = append(fields[:len(fields):len(fields)], zap.Int("repeated", dropped))
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// allow reports whether the error identified by key is logged, along with the times it was dropped since it
+// last was.
+func (s *throttleState) allow(key string, interval time.Duration) (int, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	if o, ok := s.seen[key]; ok && now.Sub(o.logged) < interval {
+		o.dropped++
+		return 0, false
+	}
+
+	dropped := 0
+	if o, ok := s.seen[key]; ok {
+		dropped = o.dropped
+	}
+	if len(s.seen) >= maxThrottled {
+		s.forget(now, interval)
+	}
+	s.seen[key] = &occurrence{logged: now}
+	return dropped, true
+}
+
+// forget drops the errors whose interval is over, or every one if none is.
+func (s *throttleState) forget(now time.Time, interval time.Duration) {
+	for key, o := range s.seen {
+		if now.Sub(o.logged) >= interval {
+			delete(s.seen, key)
+		}
+	}
+	if len(s.seen) >= maxThrottled {
+		s.seen = make(map[string]*occurrence)
+	}
+}
+
+// errorOf returns the text of the error field of an entry, empty when it has none.
+func errorOf(fields []zapcore.Field) string {
+	for _, f := range fields {
+		if f.Key != "error" {
+			continue
+		}
+		if err, ok := f.Interface.(error); ok {
+			return err.Error()
+		}
+		return f.String
+	}
+	return ""
+}
@@ -0,0 +1,18 @@
+package logger
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// WithTrace returns a logger adding the trace and span IDs of the span in ctx to its entries, so they can be
+// looked up from a trace. It returns log unchanged when ctx carries no span.
+func WithTrace(ctx context.Context, log *zap.SugaredLogger) *zap.SugaredLogger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return log
+	}
+
+	return log.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+}
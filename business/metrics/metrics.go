@@ -0,0 +1,120 @@
+// Package metrics defines the Prometheus metrics of the service and the registry they are served from.
+//
+// The collectors are package level, so any package can record into them without threading a handle around.
+// Blocks per second is the rate of BlocksProcessed, for instance rate(ethparser_blocks_processed_total[5m]).
+//
+// Example usage:
+//
+//	start := time.Now()
+//	// call the node
+//	metrics.RPCDuration.WithLabelValues("eth_blockNumber", host).Observe(time.Since(start).Seconds())
+//
+//	http.Handle("/metrics", metrics.Handler())
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// namespace prefixes every metric of the service.
+const namespace = "ethparser"
+
+// Registry holds the metrics of the service, along with the Go runtime and process ones.
+var Registry = prometheus.NewRegistry()
+
+// Ingestion metrics.
+var (
+	HeadBlock = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "head_block",
+		Help:      "Latest block number reported by the Ethereum node.",
+	})
+
+	ProcessedBlock = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "processed_block",
+		Help:      "Last block number committed by the parser.",
+	})
+
+	BlockLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "block_lag",
+		Help:      "Number of blocks the parser is behind the head of the node.",
+	})
+
+	BlocksProcessed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blocks_processed_total",
+		Help:      "Blocks committed by the parser.",
+	})
+
+	MatchedTransactions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matched_transactions_total",
+		Help:      "Transactions stored for a subscribed address, counted once per address.",
+	})
+
+	Reorgs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reorgs_total",
+		Help:      "Chain reorganisations that made the parser drop committed blocks.",
+	})
+
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of the JSON-RPC calls to the Ethereum node.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "JSON-RPC calls to the Ethereum node that failed.",
+	}, []string{"method", "endpoint"})
+)
+
+// Storage and API metrics.
+var (
+	StorageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of the storage operations.",
+		Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the HTTP requests, per route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HeadBlock, ProcessedBlock, BlockLag, BlocksProcessed, MatchedTransactions, Reorgs, RPCDuration, RPCErrors,
+		StorageDuration, HTTPDuration,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at scrape time, for figures other packages already
+// keep, such as the size of a cache.
+func GaugeFunc(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, fn))
+}
+
+// CounterFunc registers a counter whose value is read from fn at scrape time. fn must never decrease.
+func CounterFunc(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, fn))
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// LogNotifier writes notifications to the application log. It needs no recipient.
+type LogNotifier struct {
+	Log *zap.SugaredLogger
+}
+
+// NewLogNotifier creates a new LogNotifier instance
+func NewLogNotifier(logger *zap.SugaredLogger) *LogNotifier {
+	return &LogNotifier{Log: logger}
+}
+
+func (ln *LogNotifier) Notify(_ context.Context, n Notification) error {
+	ln.Log.Infow("notification", "address", n.Address, "recipient", n.Recipient, "subject", n.Subject, "event", n.Event.Key())
+	return nil
+}
+
+// smtpTimeout bounds the delivery of an email when the context has no earlier deadline.
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier emails notifications through an SMTP server, upgrading the connection with STARTTLS when the server
+// offers it. The recipient is an email address.
+type SMTPNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPNotifier creates a new SMTPNotifier instance sending through the server at addr, host:port.
+// auth may be nil for servers that do not require authentication.
+func NewSMTPNotifier(addr, from string, auth smtp.Auth) *SMTPNotifier {
+	return &SMTPNotifier{addr: addr, from: from, auth: auth}
+}
+
+func (sn *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	if strings.ContainsAny(n.Recipient, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", n.Recipient)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", sn.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.Recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprint(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprint(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Body, "\n", "\r\n"))
+
+	return sn.send(ctx, n.Recipient, msg.Bytes())
+}
+
+// send delivers a message like smtp.SendMail does, but gives up once ctx is done or smtpTimeout elapsed.
+func (sn *SMTPNotifier) send(ctx context.Context, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(sn.addr)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", sn.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > smtpTimeout {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	// Unblock the exchange as soon as ctx is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return sn.err(ctx, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return sn.err(ctx, err)
+		}
+	}
+	if sn.auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err = c.Auth(sn.auth); err != nil {
+				return sn.err(ctx, err)
+			}
+		}
+	}
+	if err = c.Mail(sn.from); err != nil {
+		return sn.err(ctx, err)
+	}
+	if err = c.Rcpt(to); err != nil {
+		return sn.err(ctx, err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return sn.err(ctx, err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		return sn.err(ctx, err)
+	}
+	if err = w.Close(); err != nil {
+		return sn.err(ctx, err)
+	}
+	return sn.err(ctx, c.Quit())
+}
+
+// err reports the cancellation of ctx rather than the network error it caused.
+func (sn *SMTPNotifier) err(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// PushNotifier sends notifications to a FCM/APNs-style HTTP push gateway. The recipient is a device token.
+// The HTTP client is pluggable so tests and deployments can provide their own transport.
+type PushNotifier struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+// PushMessage is the JSON body posted to the push gateway.
+type PushMessage struct {
+	To           string            `json:"to"`
+	Notification PushContent       `json:"notification"`
+	Data         map[string]string `json:"data"`
+}
+
+// PushContent is the visible part of a push message.
+type PushContent struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// NewPushNotifier creates a new PushNotifier instance posting to endpoint with the gateway server key.
+// A nil client uses a default one with a 10 seconds timeout.
+func NewPushNotifier(endpoint, key string, client *http.Client) *PushNotifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &PushNotifier{endpoint: endpoint, key: key, client: client}
+}
+
+func (pn *PushNotifier) Notify(ctx context.Context, n Notification) error {
+	msg := PushMessage{
+		To:           n.Recipient,
+		Notification: PushContent{Title: n.Subject, Body: n.Body},
+		Data: map[string]string{
+			"address":  n.Address,
+			"event_id": n.Event.Key(),
+		},
+	}
+	if n.Event.Transaction != nil {
+		msg.Data["hash"] = n.Event.Transaction.Hash
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pn.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+pn.key)
+
+	resp, err := pn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("push gateway returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
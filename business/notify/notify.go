@@ -0,0 +1,247 @@
+// Package notify alerts users about the activity of their addresses through pluggable channels such as email and
+// mobile push.
+//
+// A Service receives the parser events and checks them against the notification preferences registered for each
+// address, which select a channel, a recipient and thresholds such as the direction and a minimum value. Matching
+// events become a Notification handed to the Notifier of the channel.
+//
+// Example usage:
+//
+//	// Create a service with the available channels and feed it from the parser
+//	service := notify.NewService(map[string]notify.Notifier{
+//		notify.ChannelLog: notify.NewLogNotifier(log),
+//		notify.ChannelEmail: notify.NewSMTPNotifier("smtp.example.com:587", "alerts@example.com", auth),
+//	}, 1000, ethereumParser, log)
+//	go service.Run(ctx)
+//	ethereumParser.AddPublisher(service)
+//
+//	// Email about incoming transactions of at least 0.1 ETH
+//	pref, err := service.Add(notify.Preference{
+//		Address:   "0x123abc",
+//		Channel:   notify.ChannelEmail,
+//		Recipient: "user@example.com",
+//		Direction: parser.DirectionIn,
+//		MinValue:  "100000000000000000",
+//	})
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"math/big"
+	"strings"
+	"sync"
+	"trustwallet/business/parser"
+)
+
+// Channels of the bundled notifiers.
+const (
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+	ChannelLog   = "log"
+)
+
+// Errors returned when adding a preference.
+var (
+	ErrUnknownChannel = errors.New("unknown channel")
+	ErrInvalidValue   = errors.New("invalid minimum value")
+	ErrNoRecipient    = errors.New("missing recipient")
+)
+
+// Notification is a message about the activity of an address, ready to be sent to a recipient.
+type Notification struct {
+	Channel   string       `json:"channel"`
+	Address   string       `json:"address"`
+	Recipient string       `json:"recipient"`
+	Subject   string       `json:"subject"`
+	Body      string       `json:"body"`
+	Event     parser.Event `json:"event"`
+}
+
+// Notifier sends notifications through a channel.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Preference selects which activity of an address is notified, to whom and through which channel.
+type Preference struct {
+	ID        string           `json:"id"`
+	Tenant    string           `json:"tenant"`
+	Address   string           `json:"address"`
+	Channel   string           `json:"channel"`
+	Recipient string           `json:"recipient"`
+	Direction parser.Direction `json:"direction,omitempty"`
+	MinValue  string           `json:"min_value,omitempty"`
+
+	query parser.TransactionQuery
+}
+
+// Service routes the parser events to the notifiers according to the preferences of each address.
+type Service struct {
+	notifiers     map[string]Notifier
+	queue         chan Notification
+	subscriptions parser.Subscriptions
+	Log           *zap.SugaredLogger
+
+	lock        sync.RWMutex
+	preferences map[string]Preference
+}
+
+// NewService creates a new Service instance with room for queueSize pending notifications. Preferences of
+// tenants no longer in subscriptions are skipped, all of them apply when it is nil.
+func NewService(notifiers map[string]Notifier, queueSize int, subscriptions parser.Subscriptions, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		notifiers:     notifiers,
+		queue:         make(chan Notification, queueSize),
+		subscriptions: subscriptions,
+		Log:           logger,
+		preferences:   make(map[string]Preference),
+	}
+}
+
+// Add registers a preference and returns it with its ID.
+func (s *Service) Add(pref Preference) (Preference, error) {
+	if _, ok := s.notifiers[pref.Channel]; !ok {
+		return Preference{}, ErrUnknownChannel
+	}
+	if pref.Recipient == "" && pref.Channel != ChannelLog {
+		return Preference{}, ErrNoRecipient
+	}
+	switch pref.Direction {
+	case "", parser.DirectionAll, parser.DirectionIn, parser.DirectionOut:
+	default:
+		return Preference{}, fmt.Errorf("invalid direction %q", pref.Direction)
+	}
+
+	pref.query = parser.TransactionQuery{Direction: pref.Direction}
+	if pref.MinValue != "" {
+		value, ok := new(big.Int).SetString(pref.MinValue, 0)
+		if !ok || value.Sign() < 0 {
+			return Preference{}, ErrInvalidValue
+		}
+		pref.query.MinValue = value
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Preference{}, err
+	}
+	pref.ID = hex.EncodeToString(b)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.preferences[pref.ID] = pref
+
+	return pref, nil
+}
+
+// Remove deletes a preference a tenant set for an address. It reports whether it existed.
+func (s *Service) Remove(tenant, address, id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pref, ok := s.preferences[id]; !ok || pref.Tenant != tenant || pref.Address != address {
+		return false
+	}
+	delete(s.preferences, id)
+	return true
+}
+
+// Preferences lists the preferences a tenant set for an address.
+func (s *Service) Preferences(tenant, address string) []Preference {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	prefs := make([]Preference, 0)
+	for _, pref := range s.preferences {
+		if pref.Tenant == tenant && pref.Address == address {
+			prefs = append(prefs, pref)
+		}
+	}
+	return prefs
+}
+
+// Publish queues a notification for every preference the event matches, as long as its tenant is still subscribed
+// to the address. It never blocks the parser: when the queue is full the notification is dropped and logged.
+func (s *Service) Publish(e parser.Event) {
+	if e.Type != parser.EventTransaction || e.Transaction == nil {
+		return
+	}
+
+	s.lock.RLock()
+	var matched []Preference
+	for _, pref := range s.preferences {
+		if pref.Address == e.Address && pref.query.Match(e.Address, *e.Transaction) &&
+			(s.subscriptions == nil || s.subscriptions.IsSubscribed(pref.Tenant, pref.Address)) {
+			matched = append(matched, pref)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, pref := range matched {
+		n := newNotification(pref, e)
+		select {
+		case s.queue <- n:
+		default:
+			s.Log.Errorw("notify", "status", "queue full", "channel", pref.Channel, "address", e.Address)
+		}
+	}
+}
+
+// Run sends the queued notifications until the context is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-s.queue:
+			if err := s.notifiers[n.Channel].Notify(ctx, n); err != nil {
+				s.Log.Errorw("notify", "channel", n.Channel, "address", n.Address, "recipient", n.Recipient, "error", err)
+			}
+		}
+	}
+}
+
+// newNotification writes the message about a transaction event for a preference.
+func newNotification(pref Preference, e parser.Event) Notification {
+	tx := e.Transaction
+
+	subject := fmt.Sprintf("Outgoing transaction from %s", e.Address)
+	if tx.To == e.Address {
+		subject = fmt.Sprintf("Incoming transaction to %s", e.Address)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\n\n", subject)
+	fmt.Fprintf(&body, "Value: %s ETH\n", FormatEther(tx.Value))
+	fmt.Fprintf(&body, "From: %s\n", tx.From)
+	fmt.Fprintf(&body, "To: %s\n", tx.To)
+	fmt.Fprintf(&body, "Hash: %s\n", tx.Hash)
+	fmt.Fprintf(&body, "Block: %d\n", e.Block)
+
+	return Notification{
+		Channel:   pref.Channel,
+		Address:   e.Address,
+		Recipient: pref.Recipient,
+		Subject:   subject,
+		Body:      body.String(),
+		Event:     e,
+	}
+}
+
+// FormatEther converts a wei quantity, decimal or 0x hex, into a decimal amount of ether.
+func FormatEther(wei string) string {
+	value, ok := new(big.Int).SetString(wei, 0)
+	if !ok {
+		return wei
+	}
+
+	ether, rem := new(big.Int).QuoRem(value, big.NewInt(1e18), new(big.Int))
+	if rem.Sign() == 0 {
+		return ether.String()
+	}
+	decimals := strings.TrimRight(fmt.Sprintf("%018s", rem.String()), "0")
+	return ether.String() + "." + decimals
+}
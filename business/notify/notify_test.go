@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// recordingNotifier collects the notifications it is given
+type recordingNotifier struct {
+	sent chan Notification
+}
+
+func (rn *recordingNotifier) Notify(_ context.Context, n Notification) error {
+	rn.sent <- n
+	return nil
+}
+
+// Define a test for the preference thresholds of the Service
+func TestServiceThresholds(t *testing.T) {
+	rec := &recordingNotifier{sent: make(chan Notification, 10)}
+	s := NewService(map[string]Notifier{ChannelPush: rec}, 10, nil, zap.NewNop().Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// Only incoming transactions of at least 0.1 ETH
+	if _, err := s.Add(Preference{Address: "0x123", Channel: ChannelPush, Recipient: "device", Direction: parser.DirectionIn, MinValue: "100000000000000000"}); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	if _, err := s.Add(Preference{Address: "0x123", Channel: ChannelEmail, Recipient: "user@example.com"}); err != ErrUnknownChannel {
+		t.Errorf("Add returned %v, expected %v", err, ErrUnknownChannel)
+	}
+
+	publish := func(from, to, value string) {
+		s.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 1,
+			Transaction: &parser.Transaction{Hash: "0x" + value, From: from, To: to, Value: value}})
+	}
+	publish("0x456", "0x123", "0x16345785d8a0000")  // 0.1 ETH in
+	publish("0x456", "0x123", "0x1")                // dust in
+	publish("0x123", "0x456", "0x1bc16d674ec80000") // 2 ETH out
+
+	select {
+	case n := <-rec.sent:
+		if n.Recipient != "device" || !strings.Contains(n.Body, "Value: 0.1 ETH") {
+			t.Errorf("sent %+v, expected the 0.1 ETH incoming transaction", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification sent")
+	}
+	select {
+	case n := <-rec.sent:
+		t.Errorf("sent %+v, expected a single notification", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// subscriptions is a fixed set of tenant and address pairs
+type subscriptions map[[2]string]bool
+
+func (s subscriptions) IsSubscribed(tenant, address string) bool {
+	return s[[2]string{tenant, address}]
+}
+
+// Define a test for two tenants with preferences on the same address, one of which unsubscribed
+func TestServiceTenants(t *testing.T) {
+	rec := &recordingNotifier{sent: make(chan Notification, 10)}
+	s := NewService(map[string]Notifier{ChannelPush: rec}, 10, subscriptions{{"acme", "0x123"}: true}, zap.NewNop().Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if _, err := s.Add(Preference{Tenant: tenant, Address: "0x123", Channel: ChannelPush, Recipient: tenant}); err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+	}
+	s.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 1,
+		Transaction: &parser.Transaction{Hash: "0xaaa", From: "0x456", To: "0x123", Value: "0x1"}})
+
+	select {
+	case n := <-rec.sent:
+		if n.Recipient != "acme" {
+			t.Errorf("sent %+v, expected the notification of acme", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification sent")
+	}
+	select {
+	case n := <-rec.sent:
+		t.Errorf("sent %+v to globex, which is no longer subscribed", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Define a test for the SMTPNotifier against a local SMTP stand-in
+func TestSMTPNotifier(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err = r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	sn := NewSMTPNotifier(ln.Addr().String(), "alerts@example.com", nil)
+	n := Notification{Recipient: "user@example.com", Subject: "Incoming transaction to 0x123", Body: "Value: 1 ETH\n"}
+	if err = sn.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+
+	msg := <-received
+	if !strings.Contains(msg, "To: user@example.com") || !strings.Contains(msg, "Subject: Incoming transaction to 0x123") {
+		t.Errorf("server received %q, expected the notification", msg)
+	}
+}
+
+// Define a test of the SMTPNotifier giving up with its context on a server that never answers
+func TestSMTPNotifierTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sn := NewSMTPNotifier(ln.Addr().String(), "alerts@example.com", nil)
+	start := time.Now()
+	if err = sn.Notify(ctx, Notification{Recipient: "user@example.com"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Notify returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Notify returned after %v, expected it to give up with its context", elapsed)
+	}
+}
+
+// roundTripFunc is a pluggable HTTP transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Define a test for the PushNotifier with a stub transport
+func TestPushNotifier(t *testing.T) {
+	var got PushMessage
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") != "key=server-key" {
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}
+
+	pn := NewPushNotifier("https://push.example.com/send", "server-key", client)
+	n := Notification{Address: "0x123", Recipient: "device", Subject: "Incoming transaction to 0x123",
+		Event: parser.Event{Type: parser.EventTransaction, Address: "0x123", Transaction: &parser.Transaction{Hash: "0xaaa"}}}
+	if err := pn.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+	if got.To != "device" || got.Notification.Title != n.Subject || got.Data["hash"] != "0xaaa" {
+		t.Errorf("gateway received %+v, expected the notification", got)
+	}
+}
+
+// Define a test for the FormatEther conversion
+func TestFormatEther(t *testing.T) {
+	for wei, want := range map[string]string{
+		"0x0":                 "0",
+		"1000000000000000000": "1",
+		"0x16345785d8a0000":   "0.1",
+		"1500000000000000001": "1.500000000000000001",
+		"not a number":        "not a number",
+	} {
+		if got := FormatEther(wei); got != want {
+			t.Errorf("FormatEther(%q) returned %q, expected %q", wei, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// EventType identifies the kind of activity an Event reports.
+type EventType string
+
+const (
+	// EventTransaction reports a transaction of a subscribed address stored from a new block.
+	EventTransaction EventType = "transaction"
+
+	// EventTokenTransfer reports a token or NFT transfer from or to a subscribed address, made by a transaction
+	// stored from a new block. It follows the transaction event.
+	EventTokenTransfer EventType = "token_transfer"
+
+	// EventNewHead reports a newly committed block. It carries no address.
+	EventNewHead EventType = "new_head"
+
+	// EventConfirmation reports that a transaction stored earlier got buried under one more block, until it is
+	// final. Its Block is the block that confirmed it and Confirmations counts the blocks since the transaction's.
+	EventConfirmation EventType = "confirmation"
+
+	// EventStatus reports that a transaction changed status, StatusConfirmed once it is final.
+	EventStatus EventType = "status"
+
+	// EventReorg reports a transaction removed from the storage because its block left the chain in a
+	// reorganisation. Its Block is the block of the new chain where the reorganisation was detected, and Fork the
+	// last block both chains share. A reorg event without address announces the reorganisation itself, before the
+	// removed transactions.
+	EventReorg EventType = "reorg"
+)
+
+// StatusConfirmed is the status of a transaction buried under enough blocks to be considered final.
+const StatusConfirmed = "confirmed"
+
+// Event is a piece of activity the parser ingested, as handed to its publishers.
+type Event struct {
+	Type        EventType    `json:"type"`
+	Address     string       `json:"address,omitempty"`
+	Block       int          `json:"block"`
+	BlockHash   string       `json:"block_hash,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+
+	Transfer      *TokenTransfer `json:"transfer,omitempty"`
+	Confirmations int            `json:"confirmations,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	Fork          int            `json:"fork,omitempty"`
+}
+
+// Key returns an identifier of the event that stays the same whenever the same activity is published again,
+// for instance after a restart, so consumers can drop duplicates.
+func (e Event) Key() string {
+	if e.Transfer != nil && e.Transaction != nil {
+		return fmt.Sprintf("%s:%d:%s:%s:%d:%s", e.Type, e.Block, e.Transaction.Hash, e.Address, e.Transfer.LogIndex, e.Transfer.TokenID)
+	}
+	if e.Transaction != nil {
+		return fmt.Sprintf("%s:%d:%s:%s", e.Type, e.Block, e.Transaction.Hash, e.Address)
+	}
+	return fmt.Sprintf("%s:%d:%s", e.Type, e.Block, e.Address)
+}
+
+// Publisher receives the events of the parser once the block they belong to is committed. Publish is called
+// from the polling goroutine, so implementations must not block it for long unless they mean to hold the parser
+// back until they catch up.
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Subscriptions reports whether a tenant is subscribed to an address. Publishers delivering to tenants check it
+// before each delivery, since an address keeps matching as long as any tenant follows it.
+type Subscriptions interface {
+	IsSubscribed(tenant, address string) bool
+}
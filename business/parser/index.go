@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Indexer is implemented by the storages that can rebuild the transactions of past blocks. The backfill and
+// reindex operations fail with ErrIndexUnsupported on the storages that do not implement it.
+type Indexer interface {
+	// Backfill merges transactions of blocks up to the checkpoint into those stored for an address, keeping
+	// them ordered by block and skipping the ones already stored.
+	Backfill(address string, txs []Transaction) error
+
+	// Rewind removes the transactions of the blocks after block and moves the checkpoint back to it, so the
+	// following blocks are processed again.
+	Rewind(block int) error
+}
+
+// ErrIndexUnsupported is returned when rebuilding past blocks in a storage that does not implement Indexer.
+var ErrIndexUnsupported = errors.New("storage cannot rebuild past blocks")
+
+// AsIndexer returns a storage as an Indexer, or ErrIndexUnsupported when it does not implement it.
+func AsIndexer(s Storage) (Indexer, error) {
+	if indexer, ok := as[Indexer](s); ok {
+		return indexer, nil
+	}
+	return nil, ErrIndexUnsupported
+}
+
+// BackfillStats reports what a backfill stored.
+type BackfillStats struct {
+	Blocks       int `json:"blocks"`
+	Transactions int `json:"transactions"`
+}
+
+// Backfill Stores the transactions of addresses found in blocks from to to, inclusive, for addresses subscribed
+// after these blocks were processed. All the subscribed addresses are backfilled when none is given. Blocks after
+// the checkpoint are left to the poller.
+func (p *EthereumParser) Backfill(ctx context.Context, from, to int, addresses []string) (BackfillStats, error) {
+	var stats BackfillStats
+	indexer, err := AsIndexer(p.storage)
+	if err != nil {
+		return stats, err
+	}
+	if checkpoint := p.storage.Checkpoint(); to > checkpoint {
+		return stats, fmt.Errorf("block %d is after the checkpoint %d, the poller will process it", to, checkpoint)
+	}
+	if from < 1 || from > to {
+		return stats, fmt.Errorf("invalid block range %d to %d", from, to)
+	}
+	if len(addresses) == 0 {
+		addresses = p.storage.Subscribers()
+	}
+
+	found := make(map[string][]Transaction)
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		block, err := p.fetchBlock(ctx, number)
+		if err != nil {
+			return stats, err
+		}
+		matched, _ := block.match(addresses)
+		for address, txs := range matched {
+			found[address] = append(found[address], txs...)
+		}
+		stats.Blocks++
+	}
+
+	for address, txs := range found {
+		if err := indexer.Backfill(address, txs); err != nil {
+			return stats, fmt.Errorf("backfilling %s: %w", address, err)
+		}
+		stats.Transactions += len(txs)
+	}
+	return stats, nil
+}
+
+// Reindex Drops what was stored for the blocks from from on and processes them again, up to the confirmed head.
+// Events are published again for these blocks.
+func (p *EthereumParser) Reindex(ctx context.Context, from int) error {
+	indexer, err := AsIndexer(p.storage)
+	if err != nil {
+		return err
+	}
+	if from < 1 {
+		return fmt.Errorf("invalid block %d", from)
+	}
+
+	p.syncLock.Lock()
+	err = indexer.Rewind(from - 1)
+	if err == nil {
+		p.lock.Lock()
+		p.currentBlock = p.storage.Checkpoint()
+		p.lock.Unlock()
+		p.forget(from - 1)
+	}
+	p.syncLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("rewinding to block %d: %w", from-1, err)
+	}
+
+	return p.syncBlocks(ctx)
+}
+
+// BlockInspection is what the parser would store of a block, given the current subscriptions.
+type BlockInspection struct {
+	Number       int                      `json:"number"`
+	Hash         string                   `json:"hash"`
+	Timestamp    int                      `json:"timestamp"`
+	Transactions int                      `json:"transactions"`
+	Matched      map[string][]Transaction `json:"matched"`
+}
+
+// InspectBlock Fetches a block and matches it against the subscribed addresses, without storing anything
+func (p *EthereumParser) InspectBlock(ctx context.Context, number int) (BlockInspection, error) {
+	block, err := p.fetchBlock(ctx, number)
+	if err != nil {
+		return BlockInspection{}, err
+	}
+
+	matched, _ := block.match(p.storage.Subscribers())
+	return BlockInspection{
+		Number:       block.Number,
+		Hash:         block.Hash,
+		Timestamp:    block.Timestamp,
+		Transactions: len(block.Transactions),
+		Matched:      matched,
+	}, nil
+}
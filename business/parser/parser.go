@@ -15,7 +15,7 @@
 //	parser := NewEthereumParser()
 //
 //	// Subscribe to updates for a particular address
-//	parser.Subscribe("0x123456789abcdef")
+//	parser.Subscribe(DefaultTenant, "0x123456789abcdef")
 //
 //	// Get the current block number
 //	currentBlock := parser.GetCurrentBlock()
@@ -35,34 +35,195 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"math/big"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
+	"trustwallet/business/logger"
+	"trustwallet/business/metrics"
+	"trustwallet/business/tracing"
 )
 
+// ErrBlockCommitted is returned by Storage.CommitBlock when the block is not newer than the stored checkpoint.
+var ErrBlockCommitted = errors.New("block already committed")
+
+// DefaultTenant owns the subscriptions made while API authentication is disabled, and those restored from
+// snapshots taken before subscriptions had owners.
+const DefaultTenant = "default"
+
+// ErrSubscriptionLimit is returned by EthereumParser.Subscribe when a tenant already has as many subscriptions as
+// it is allowed to.
+var ErrSubscriptionLimit = errors.New("subscription limit reached")
+
+// Storage persists subscriptions, matched transactions and the block checkpoint.
+//
+// Implementations must be safe for concurrent use: the poller commits blocks while HTTP handlers subscribe and
+// query at the same time. Every method must behave as if it ran alone, readers must never observe a partially
+// committed block, and slices returned by Subscribers and GetTransactions must not be modified by the storage
+// afterwards, so callers may keep reading them without holding any lock.
 type Storage interface {
-	Subscribe(address string) bool
+	// Subscribe adds an address to the subscriptions of a tenant. It reports whether the tenant was not
+	// subscribed to it yet.
+	Subscribe(tenant, address string) bool
+
+	// Unsubscribe removes an address from the subscriptions of a tenant and reports whether it was there.
+	// The address is no longer watched once no tenant is subscribed to it, and only then are its stored
+	// transactions removed too when purge is set and no tenant kept them. Storages implementing Keeper let the
+	// tenant keep the history stored so far when purge is not set, and forget it when it is.
+	Unsubscribe(tenant, address string, purge bool) bool
+
+	// Subscribers returns the addresses at least one tenant is subscribed to.
 	Subscribers() []string
+
+	// Subscriptions returns the addresses a tenant is subscribed to, sorted.
+	Subscriptions(tenant string) []string
+
+	// Owners returns the tenants subscribed to an address, sorted.
+	Owners(address string) []string
+
 	AddTransaction(address string, tx Transaction)
 	GetTransactions(address string) []Transaction
+
+	// Prune removes the transactions that the retention policy no longer allows to keep.
+	Prune(policy RetentionPolicy, now time.Time) PruneStats
+
+	// CommitBlock stores all the transactions matched in a block, keyed by address, and advances the
+	// checkpoint to that block. Implementations must apply both or neither.
+	CommitBlock(block int, txs map[string][]Transaction) error
+
+	// Checkpoint returns the number of the last committed block.
+	Checkpoint() int
+}
+
+// Wrapper is implemented by the storages decorating another one, such as a cache. They implement the optional
+// interfaces of this package whatever the storage they wrap, so a storage only counts as implementing one when
+// the storages it wraps do too.
+type Wrapper interface {
+	Unwrap() Storage
+}
+
+// as returns a storage as a T, and whether it and every storage it wraps implement T.
+func as[T any](s Storage) (T, bool) {
+	t, ok := s.(T)
+	if wrapper, wraps := s.(Wrapper); ok && wraps {
+		_, ok = as[T](wrapper.Unwrap())
+	}
+	return t, ok
+}
+
+// Historian is implemented by the storages that can list every address they hold transactions for, including
+// the ones kept after their last tenant unsubscribed. Only the subscribed addresses are known of the others.
+type Historian interface {
+	Addresses() []string
+}
+
+// Addresses returns the addresses a storage holds transactions for, through its Addresses method when it
+// implements Historian.
+func Addresses(s Storage) []string {
+	if historian, ok := as[Historian](s); ok {
+		return historian.Addresses()
+	}
+	return s.Subscribers()
+}
+
+// Keeper is implemented by the storages that remember which tenants kept the history of an address when they
+// unsubscribed from it, so they can still read it. A tenant subscribing again drops its mark.
+type Keeper interface {
+	// Keep lets a tenant read the transactions of an address up to a block.
+	Keep(tenant, address string, block int)
+
+	// Kept returns the tenants that kept the history of an address, with the last block each of them may read.
+	Kept(address string) map[string]int
+}
+
+// Kept returns the tenants that kept the history of an address, through its Kept method when the storage
+// implements Keeper.
+func Kept(s Storage, address string) map[string]int {
+	if keeper, ok := as[Keeper](s); ok {
+		return keeper.Kept(address)
+	}
+	return nil
+}
+
+// Keep lets a tenant read the transactions of an address up to a block, and reports false when the storage does
+// not implement Keeper.
+func Keep(s Storage, tenant, address string, block int) bool {
+	keeper, ok := as[Keeper](s)
+	if ok {
+		keeper.Keep(tenant, address, block)
+	}
+	return ok
+}
+
+// Positioner is implemented by the storages that keep, along with the checkpoint, the last block each consumer of
+// the parser events handled, such as the block a message broker last acknowledged.
+type Positioner interface {
+	// SetPosition records the last block a consumer handled.
+	SetPosition(name string, block int)
+
+	// Positions returns the last block each consumer handled.
+	Positions() map[string]int
+}
+
+// SetPosition records the last block a consumer handled, and reports false when the storage does not implement
+// Positioner.
+func SetPosition(s Storage, name string, block int) bool {
+	positioner, ok := as[Positioner](s)
+	if ok {
+		positioner.SetPosition(name, block)
+	}
+	return ok
+}
+
+// Position returns the last block a consumer handled, and whether the storage recorded one.
+func Position(s Storage, name string) (int, bool) {
+	if positioner, ok := as[Positioner](s); ok {
+		block, ok := positioner.Positions()[name]
+		return block, ok
+	}
+	return 0, false
 }
 
+// Statuses of a transaction, as its receipt reports them.
+const (
+	TransactionSuccess = "success"
+	TransactionFailed  = "failed"
+)
+
 // Transaction represents an Ethereum transaction
 type Transaction struct {
 	Hash        string   `json:"hash"`
 	From        string   `json:"from"`
 	To          string   `json:"to"`
 	Value       string   `json:"value"`
-	Status      string   `json:"status"`
+	Status      string   `json:"status"` // TransactionSuccess or TransactionFailed, empty before the Byzantium fork
 	Gas         string   `json:"gas"`
 	GasPrice    string   `json:"gasPrice"`
 	BlockNumber *big.Int `json:"blockNumber"`
 	BlockHash   string   `json:"blockHash"`
+	Timestamp   int64    `json:"timestamp"`
+
+	Transfers []TokenTransfer `json:"transfers,omitempty"` // token and NFT transfers the transaction made
+}
+
+// TransfersOf returns the token transfers of a transaction an address sent or received.
+func (tx Transaction) TransfersOf(address string) []TokenTransfer {
+	var transfers []TokenTransfer
+	for _, t := range tx.Transfers {
+		if t.Involves(address) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers
 }
 
 type BlockResp struct {
@@ -80,44 +241,132 @@ type BlockResp struct {
 
 // EthereumParser implements the Parser interface
 type EthereumParser struct {
-	httpClient      *http.Client
-	ethNodeURL      string
-	storage         Storage
-	currentBlock    int
-	lastPolledBlock int
-	lock            sync.Mutex
-	pollingInterval time.Duration
-	Log             *zap.SugaredLogger
+	httpClient       *http.Client
+	ethNodeURL       string
+	endpoint         string // host of ethNodeURL, which is safe to label metrics with unlike the URL and its API key
+	storage          Storage
+	currentBlock     int
+	headBlock        int
+	lastPolledBlock  int
+	lastPoll         time.Time // end of the last syncBlocks run that succeeded
+	backfill         *Backfill // the catch up in progress, nil once the parser reached the head
+	confirmations    int       // blocks a block must be buried under before it is processed
+	finality         int       // confirmations after which a transaction is final, 0 when not announced
+	recent           []recentBlock
+	lock             sync.Mutex // guards currentBlock, headBlock, lastPoll, backfill, confirmations, finality and publishers
+	syncLock         sync.Mutex // serializes syncBlocks runs, and guards recent
+	subLock          sync.Mutex // guards maxSubscriptions, and makes the limit check and Subscribe atomic
+	pollingInterval  time.Duration
+	publishers       []Publisher
+	maxSubscriptions int
+	Log              *zap.SugaredLogger
 }
 
 // NewEthereumParser creates a new Ethereum Parser instance
 func NewEthereumParser(storage Storage, nodeEndpoint string, pollingInterval time.Duration, logger *zap.SugaredLogger) *EthereumParser {
-	client := &EthereumParser{
+	client := NewIdleEthereumParser(storage, nodeEndpoint, logger)
+	client.pollingInterval = pollingInterval
+
+	// Start polling Ethereum node
+	go func() {
+		client.pollTransactions()
+	}()
+
+	return client
+}
+
+// NewIdleEthereumParser creates an Ethereum Parser that does not poll the node, for the one-off commands that
+// process blocks on their own
+func NewIdleEthereumParser(storage Storage, nodeEndpoint string, logger *zap.SugaredLogger) *EthereumParser {
+	return &EthereumParser{
 		httpClient:      &http.Client{},
 		ethNodeURL:      nodeEndpoint,
+		endpoint:        endpointHost(nodeEndpoint),
 		storage:         storage,
-		currentBlock:    0,
+		currentBlock:    storage.Checkpoint(),
 		lastPolledBlock: 0,
 		lock:            sync.Mutex{},
-		pollingInterval: pollingInterval * time.Second,
+		syncLock:        sync.Mutex{},
 		Log:             logger,
 	}
+}
 
-	// Start polling Ethereum node
-	go func() {
-		client.pollTransactions()
-	}()
+// AddPublisher Registers a publisher notified of every event from the blocks committed after this call
+func (p *EthereumParser) AddPublisher(pub Publisher) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.publishers = append(p.publishers, pub)
+}
 
-	return client
+// SetConfirmations Makes the parser wait until a block is buried under n others before processing it, so that
+// blocks dropped by a shallow reorganisation are never stored. 0 processes blocks as soon as they are mined.
+func (p *EthereumParser) SetConfirmations(n int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.confirmations = n
+}
+
+// SetSubscriptionLimit Caps the number of addresses each tenant can subscribe to, 0 removes the cap. Existing
+// subscriptions above a lowered cap are kept.
+func (p *EthereumParser) SetSubscriptionLimit(n int) {
+	p.subLock.Lock()
+	defer p.subLock.Unlock()
+	p.maxSubscriptions = n
 }
 
-// Subscribe Creates an address subscription
-func (p *EthereumParser) Subscribe(address string) bool {
-	return p.storage.Subscribe(address)
+// SubscriptionLimit Gets the number of addresses each tenant can subscribe to, 0 when unlimited
+func (p *EthereumParser) SubscriptionLimit() int {
+	p.subLock.Lock()
+	defer p.subLock.Unlock()
+	return p.maxSubscriptions
+}
+
+// Subscribe Creates an address subscription owned by a tenant. It fails with ErrSubscriptionLimit when the
+// tenant reached its limit, unless it is already subscribed to the address.
+func (p *EthereumParser) Subscribe(tenant, address string) (bool, error) {
+	p.subLock.Lock()
+	defer p.subLock.Unlock()
+	if p.maxSubscriptions > 0 && !p.IsSubscribed(tenant, address) && len(p.storage.Subscriptions(tenant)) >= p.maxSubscriptions {
+		return false, ErrSubscriptionLimit
+	}
+	return p.storage.Subscribe(tenant, address), nil
+}
+
+// Unsubscribe Removes the address subscription of a tenant. Once no tenant is left, blocks processed from now
+// on no longer match the address, and its stored transactions are deleted as well when purge is set.
+func (p *EthereumParser) Unsubscribe(tenant, address string, purge bool) bool {
+	return p.storage.Unsubscribe(tenant, address, purge)
+}
+
+// Subscriptions Lists the addresses a tenant is subscribed to
+func (p *EthereumParser) Subscriptions(tenant string) []string {
+	return p.storage.Subscriptions(tenant)
+}
+
+// IsSubscribed Reports whether a tenant is subscribed to an address, and may thus read its activity
+func (p *EthereumParser) IsSubscribed(tenant, address string) bool {
+	for _, owner := range p.storage.Owners(address) {
+		if owner == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// History Reports whether a tenant may read the transactions of an address, and the last block it may read: 0
+// while it is subscribed, or the checkpoint it unsubscribed at when it kept the history.
+func (p *EthereumParser) History(tenant, address string) (int, bool) {
+	if p.IsSubscribed(tenant, address) {
+		return 0, true
+	}
+	block, ok := Kept(p.storage, address)[tenant]
+	return block, ok
 }
 
 // GetCurrentBlock Gets the current block number
 func (p *EthereumParser) GetCurrentBlock() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	return p.currentBlock
 }
 
@@ -130,96 +379,344 @@ func (p *EthereumParser) GetTransactions(address string) []Transaction {
 	return []Transaction{}
 }
 
-// pollTransactions Pools Ethereum gateway for new updates and updates the local storage
+// GetBalance Gets an address's balance in wei from the Ethereum node, as a decimal string
+func (p *EthereumParser) GetBalance(address string) (string, error) {
+	var balance string
+	if err := p.call("eth_getBalance", []any{address, "latest"}, &balance); err != nil {
+		return "", err
+	}
+
+	wei, ok := new(big.Int).SetString(strings.TrimPrefix(balance, "0x"), 16)
+	if !ok {
+		return "", fmt.Errorf("invalid balance %q", balance)
+	}
+
+	return wei.String(), nil
+}
+
+// pollTransactions Polls Ethereum gateway for new blocks and commits them to the local storage
 func (p *EthereumParser) pollTransactions() {
 	for {
 		// Wait for this period
 		time.Sleep(p.pollingInterval)
 
-		// Check for new transactions for each subscribed address
-		for _, address := range p.storage.Subscribers() {
-			// Get the transactions for the address since the last polled block
-			err := p.getTransactionsSinceBlock(address)
-			if err != nil {
-				p.Log.Errorw("marshalling response", "error", err)
-			}
+		ctx, span := tracing.Tracer().Start(context.Background(), "parser.syncBlocks")
+		err := p.syncBlocks(ctx)
+		if err != nil {
+			logger.WithTrace(ctx, p.Log).Errorw("syncing blocks", "error", err)
 		}
+		tracing.End(span, err)
 	}
 }
 
-// GetTransactions returns a list of inbound or outbound transactions for an address
-func (p *EthereumParser) getTransactionsSinceBlock(address string) error {
-	// make a JSONRPC call to get the latest block number
-	reqBody := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`)
-	resp, err := http.Post(p.ethNodeURL, "application/json", strings.NewReader(reqBody))
+// syncBlocks processes every block after the storage checkpoint up to the latest block. The transactions
+// matched in a block are committed together with the checkpoint, so a crash never leaves a block half stored.
+func (p *EthereumParser) syncBlocks(ctx context.Context) error {
+	p.syncLock.Lock()
+	defer p.syncLock.Unlock()
+
+	var head string
+	if err := p.callContext(ctx, "eth_blockNumber", []any{}, &head); err != nil {
+		return err
+	}
+	latest, err := parseQuantity(head)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	var blockNumResp struct {
-		Result string `json:"result"`
+
+	checkpoint := p.storage.Checkpoint()
+	p.lock.Lock()
+	p.headBlock = latest
+	// only the blocks with enough confirmations are processed
+	confirmed := latest - p.confirmations
+	if checkpoint < confirmed {
+		p.backfill = &Backfill{From: checkpoint, To: confirmed, Current: checkpoint}
 	}
-	if err = json.NewDecoder(resp.Body).Decode(&blockNumResp); err != nil {
-		return err
+	p.lock.Unlock()
+	metrics.HeadBlock.Set(float64(latest))
+	if confirmed > checkpoint {
+		metrics.BlockLag.Set(float64(confirmed - checkpoint))
+	} else {
+		metrics.BlockLag.Set(0)
 	}
-	blockNum := new(big.Int)
-	blockNum, _ = blockNum.SetString(blockNumResp.Result[2:], 16)
 
-	// iterate over blocks starting from the last parsed block
-	for i := p.currentBlock + 1; i <= int(blockNum.Int64()); i++ {
-		// make a JSONRPC call to get block data
-		reqBody = fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x%x",true],"id":1}`, i)
-		resp, err = http.Post(p.ethNodeURL, "application/json", strings.NewReader(reqBody))
+	// iterate over blocks starting from the last committed block, going back to the fork after a reorganisation
+	for i := checkpoint + 1; i <= confirmed; i++ {
+		err = p.processBlock(ctx, i)
+		if errors.Is(err, errReorg) {
+			i = p.storage.Checkpoint()
+			continue
+		}
 		if err != nil {
 			return err
 		}
+	}
 
-		defer resp.Body.Close()
-
-		var blockResp struct {
-			Result struct {
-				Transactions []struct {
-					Hash        string   `json:"hash"`
-					From        string   `json:"from"`
-					To          string   `json:"to"`
-					Value       string   `json:"value"`
-					Gas         string   `json:"gas"`
-					GasPrice    string   `json:"gasPrice"`
-					BlockNumber *big.Int `json:"blockNumber"`
-					BlockHash   string   `json:"blockHash"`
-				} `json:"transactions"`
-			} `json:"result"`
-		}
+	p.lock.Lock()
+	p.lastPoll = time.Now()
+	p.backfill = nil
+	p.lock.Unlock()
+
+	return nil
+}
+
+// processBlock fetches a block and commits the transactions of the subscribed addresses found in it.
+func (p *EthereumParser) processBlock(ctx context.Context, number int) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "parser.processBlock", trace.WithAttributes(attribute.Int("block.number", number)))
+	defer func() { tracing.End(span, err) }()
+
+	block, err := p.fetchBlock(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	if err = p.checkFork(ctx, block); err != nil {
+		return err
+	}
+
+	_, storageSpan := tracing.Tracer().Start(ctx, "storage.Subscribers")
+	subscribers := p.storage.Subscribers()
+	storageSpan.End()
 
-		if err = json.NewDecoder(resp.Body).Decode(&blockResp); err != nil {
+	// the receipts are only needed for the transactions of the subscribers
+	if len(subscribers) > 0 {
+		if err = p.fetchReceipts(ctx, &block); err != nil {
 			return err
 		}
+	}
 
-		for _, tx := range blockResp.Result.Transactions {
-			if tx.From == address {
-				p.storage.AddTransaction(tx.From, Transaction{
-					Hash:     tx.Hash,
-					From:     tx.From,
-					To:       tx.To,
-					Value:    tx.Value,
-					Gas:      tx.Gas,
-					GasPrice: tx.GasPrice,
-				})
-			} else if tx.To == address {
-				p.storage.AddTransaction(tx.To, Transaction{
-					Hash:     tx.Hash,
-					From:     tx.From,
-					To:       tx.To,
-					Value:    tx.Value,
-					Gas:      tx.Gas,
-					GasPrice: tx.GasPrice,
-				})
-			}
-		}
+	matched, events := block.match(subscribers)
+
+	_, storageSpan = tracing.Tracer().Start(ctx, "storage.CommitBlock")
+	err = p.storage.CommitBlock(number, matched)
+	tracing.End(storageSpan, err)
+	if err != nil {
+		return fmt.Errorf("committing block %d: %w", number, err)
 	}
 
 	// update the last parsed block number
-	p.currentBlock = int(blockNum.Int64())
+	p.lock.Lock()
+	p.currentBlock = number
+	if p.backfill != nil {
+		p.backfill.Current = number
+	}
+	confirmed := p.headBlock - p.confirmations
+	publishers := p.publishers
+	buried, finality := p.confirmations, p.finality
+	p.lock.Unlock()
+
+	metrics.ProcessedBlock.Set(float64(number))
+	metrics.BlocksProcessed.Inc()
+	metrics.MatchedTransactions.Add(float64(len(events)))
+	span.SetAttributes(attribute.Int("transactions.matched", len(events)))
+	if confirmed > number {
+		metrics.BlockLag.Set(float64(confirmed - number))
+	} else {
+		metrics.BlockLag.Set(0)
+	}
+
+	events = append(events, p.confirm(block, transactionEvents(events), buried, finality)...)
+	events = append(events, Event{Type: EventNewHead, Block: number, BlockHash: block.Hash})
+	for _, e := range events {
+		for _, pub := range publishers {
+			pub.Publish(e)
+		}
+	}
+
+	return nil
+}
+
+// Block is a block of the chain, with the fields of its transactions the parser stores.
+type Block struct {
+	Number       int
+	Hash         string
+	ParentHash   string
+	Timestamp    int
+	Transactions []Transaction
+}
+
+// fetchBlock gets a block and its transactions from the node.
+func (p *EthereumParser) fetchBlock(ctx context.Context, number int) (Block, error) {
+	var resp struct {
+		Hash         string `json:"hash"`
+		ParentHash   string `json:"parentHash"`
+		Timestamp    string `json:"timestamp"`
+		Transactions []struct {
+			Hash     string `json:"hash"`
+			From     string `json:"from"`
+			To       string `json:"to"`
+			Value    string `json:"value"`
+			Gas      string `json:"gas"`
+			GasPrice string `json:"gasPrice"`
+		} `json:"transactions"`
+	}
+	if err := p.callContext(ctx, "eth_getBlockByNumber", []any{fmt.Sprintf("0x%x", number), true}, &resp); err != nil {
+		return Block{}, err
+	}
+	timestamp, err := parseQuantity(resp.Timestamp)
+	if err != nil {
+		return Block{}, fmt.Errorf("block %d timestamp: %w", number, err)
+	}
+
+	b := Block{Number: number, Hash: resp.Hash, ParentHash: resp.ParentHash, Timestamp: timestamp}
+	for _, tx := range resp.Transactions {
+		b.Transactions = append(b.Transactions, Transaction{
+			Hash:        tx.Hash,
+			From:        tx.From,
+			To:          tx.To,
+			Value:       tx.Value,
+			Gas:         tx.Gas,
+			GasPrice:    tx.GasPrice,
+			BlockNumber: big.NewInt(int64(number)),
+			BlockHash:   resp.Hash,
+			Timestamp:   int64(timestamp),
+		})
+	}
+	return b, nil
+}
+
+// fetchReceipts gets the receipts of the transactions of a block from the node, and sets their status and the
+// token transfers they logged.
+func (p *EthereumParser) fetchReceipts(ctx context.Context, block *Block) error {
+	var resp []struct {
+		TransactionHash string       `json:"transactionHash"`
+		Status          string       `json:"status"`
+		Logs            []receiptLog `json:"logs"`
+	}
+	if err := p.callContext(ctx, "eth_getBlockReceipts", []any{fmt.Sprintf("0x%x", block.Number)}, &resp); err != nil {
+		return fmt.Errorf("block %d receipts: %w", block.Number, err)
+	}
 
+	statuses := make(map[string]string, len(resp))
+	transfers := make(map[string][]TokenTransfer)
+	for _, receipt := range resp {
+		switch receipt.Status {
+		case "0x1":
+			statuses[receipt.TransactionHash] = TransactionSuccess
+		case "0x0":
+			statuses[receipt.TransactionHash] = TransactionFailed
+		}
+		transfers[receipt.TransactionHash] = decodeTransfers(receipt.Logs)
+	}
+	for i := range block.Transactions {
+		block.Transactions[i].Status = statuses[block.Transactions[i].Hash]
+		block.Transactions[i].Transfers = transfers[block.Transactions[i].Hash]
+	}
 	return nil
 }
+
+// match returns the transactions of the block sent from or to the given addresses, or making token transfers from
+// or to them, keyed by address, along with their events. A transaction involving several of the addresses is
+// matched for each of them.
+func (b Block) match(addresses []string) (map[string][]Transaction, []Event) {
+	watched := make(map[string]bool)
+	for _, address := range addresses {
+		watched[address] = true
+	}
+
+	matched := make(map[string][]Transaction)
+	var events []Event
+	for i := range b.Transactions {
+		record := b.Transactions[i]
+		involved := []string{record.From, record.To}
+		for _, t := range record.Transfers {
+			involved = append(involved, t.From, t.To)
+		}
+
+		seen := make(map[string]bool)
+		for _, address := range involved {
+			if !watched[address] || seen[address] {
+				continue
+			}
+			seen[address] = true
+			matched[address] = append(matched[address], record)
+			events = append(events, Event{Type: EventTransaction, Address: address, Block: b.Number, Transaction: &record})
+			events = append(events, transferEvents(address, b.Number, &record)...)
+		}
+	}
+	return matched, events
+}
+
+// call makes a JSONRPC call to the Ethereum node and decodes its result into result, recording its latency
+// and failure in the metrics.
+func (p *EthereumParser) call(method string, params []any, result any) error {
+	return p.callContext(context.Background(), method, params, result)
+}
+
+// callContext is call, abandoned once ctx is done, and traced as a child of the span in ctx.
+func (p *EthereumParser) callContext(ctx context.Context, method string, params []any, result any) error {
+	ctx, span := tracing.Tracer().Start(ctx, "rpc "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "jsonrpc"), attribute.String("rpc.method", method), attribute.String("server.address", p.endpoint)))
+	start := time.Now()
+	err := p.roundTrip(ctx, method, params, result)
+	tracing.End(span, err)
+	metrics.RPCDuration.WithLabelValues(method, p.endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues(method, p.endpoint).Inc()
+	}
+
+	return err
+}
+
+// roundTrip sends a JSONRPC request and decodes the result of the response.
+func (p *EthereumParser) roundTrip(ctx context.Context, method string, params []any, result any) error {
+	reqBody, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.ethNodeURL, strings.NewReader(string(reqBody)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("%s: rpc error %d: %s", method, rpcResp.Error.Code, rpcResp.Error.Message)
+	}
+	if len(rpcResp.Result) == 0 || string(rpcResp.Result) == "null" {
+		return fmt.Errorf("%s: empty result", method)
+	}
+
+	return json.Unmarshal(rpcResp.Result, result)
+}
+
+// endpointHost returns the host of a node URL, "unknown" when it has none.
+func endpointHost(nodeURL string) string {
+	u, err := url.Parse(nodeURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+// parseQuantity decodes a hex encoded JSONRPC quantity such as "0x1b4".
+func parseQuantity(s string) (int, error) {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok || !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+
+	return int(n.Int64()), nil
+}
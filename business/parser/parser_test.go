@@ -1,8 +1,24 @@
 package parser
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"trustwallet/business/metrics"
+	"trustwallet/business/tracing"
 )
 
 // Define a mock implementation of the Parser interface
@@ -41,3 +57,724 @@ func TestGetTransactions(t *testing.T) {
 		t.Errorf("GetTransactions returned %+v, expected %+v", transactions, expectedTransactions)
 	}
 }
+
+// testStorage is a minimal in-memory Storage used to exercise the EthereumParser
+type testStorage struct {
+	sync.Mutex
+	subscribers  map[string]map[string]bool
+	transactions map[string][]Transaction
+	checkpoint   int
+}
+
+func newTestStorage(addresses ...string) *testStorage {
+	s := &testStorage{subscribers: make(map[string]map[string]bool), transactions: make(map[string][]Transaction)}
+	for _, address := range addresses {
+		s.subscribers[address] = map[string]bool{DefaultTenant: true}
+	}
+	return s
+}
+
+func (s *testStorage) Subscribe(tenant, address string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.subscribers[address] == nil {
+		s.subscribers[address] = make(map[string]bool)
+	}
+	ok := !s.subscribers[address][tenant]
+	s.subscribers[address][tenant] = true
+	return ok
+}
+
+func (s *testStorage) Unsubscribe(tenant, address string, purge bool) bool {
+	s.Lock()
+	defer s.Unlock()
+	ok := s.subscribers[address][tenant]
+	delete(s.subscribers[address], tenant)
+	if len(s.subscribers[address]) == 0 {
+		delete(s.subscribers, address)
+		if purge {
+			delete(s.transactions, address)
+		}
+	}
+	return ok
+}
+
+func (s *testStorage) Subscribers() []string {
+	s.Lock()
+	defer s.Unlock()
+	var addresses []string
+	for address := range s.subscribers {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+func (s *testStorage) Subscriptions(tenant string) []string {
+	s.Lock()
+	defer s.Unlock()
+	var addresses []string
+	for address, tenants := range s.subscribers {
+		if tenants[tenant] {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func (s *testStorage) Owners(address string) []string {
+	s.Lock()
+	defer s.Unlock()
+	var tenants []string
+	for tenant := range s.subscribers[address] {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+func (s *testStorage) AddTransaction(address string, tx Transaction) {
+	s.Lock()
+	defer s.Unlock()
+	s.transactions[address] = append(s.transactions[address], tx)
+}
+
+func (s *testStorage) GetTransactions(address string) []Transaction {
+	s.Lock()
+	defer s.Unlock()
+	return s.transactions[address]
+}
+
+func (s *testStorage) Prune(policy RetentionPolicy, now time.Time) PruneStats {
+	return PruneStats{}
+}
+
+func (s *testStorage) CommitBlock(block int, txs map[string][]Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+	if block <= s.checkpoint {
+		return ErrBlockCommitted
+	}
+	for address, list := range txs {
+		s.transactions[address] = append(s.transactions[address], list...)
+	}
+	s.checkpoint = block
+	return nil
+}
+
+func (s *testStorage) Checkpoint() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.checkpoint
+}
+
+// testPublisher records the events published by the parser
+type testPublisher struct {
+	events []Event
+}
+
+func (tp *testPublisher) Publish(e Event) {
+	tp.events = append(tp.events, e)
+}
+
+// testBlock is a block served by the fake Ethereum node
+type testBlock struct {
+	Hash         string              `json:"hash"`
+	ParentHash   string              `json:"parentHash"`
+	Timestamp    string              `json:"timestamp"`
+	Transactions []map[string]string `json:"transactions"`
+
+	// Logs are the receipt logs of the transactions, by transaction hash
+	Logs map[string][]map[string]any `json:"-"`
+}
+
+// newTestNode starts a fake Ethereum JSONRPC node serving the given blocks, numbered from 1
+func newTestNode(t *testing.T, blocks []testBlock) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var result any
+		switch req.Method {
+		case "eth_blockNumber":
+			result = fmt.Sprintf("0x%x", len(blocks))
+		case "eth_getBalance":
+			result = "0xde0b6b3a7640000"
+		case "eth_getBlockReceipts":
+			var number int
+			fmt.Sscanf(req.Params[0].(string), "0x%x", &number)
+			if number >= 1 && number <= len(blocks) {
+				// transactions succeed unless a test gives them another status
+				receipts := []map[string]any{}
+				for _, tx := range blocks[number-1].Transactions {
+					status := tx["status"]
+					if status == "" {
+						status = "0x1"
+					}
+					logs := blocks[number-1].Logs[tx["hash"]]
+					if logs == nil {
+						logs = []map[string]any{}
+					}
+					receipts = append(receipts, map[string]any{"transactionHash": tx["hash"], "status": status, "logs": logs})
+				}
+				result = receipts
+			}
+		case "eth_getBlockByNumber":
+			var number int
+			fmt.Sscanf(req.Params[0].(string), "0x%x", &number)
+			if number >= 1 && number <= len(blocks) {
+				// blocks follow each other unless a test forks them
+				block := blocks[number-1]
+				if block.ParentHash == "" && number > 1 {
+					block.ParentHash = blocks[number-2].Hash
+				}
+				result = block
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// newTestParser creates an EthereumParser whose background poller stays idle during the test
+func newTestParser(t *testing.T, storage Storage, nodeURL string) *EthereumParser {
+	t.Helper()
+	return NewEthereumParser(storage, nodeURL, time.Hour, zap.NewNop().Sugar())
+}
+
+// Define a test for the subscription limit of tenants
+func TestSubscriptionLimit(t *testing.T) {
+	p := newTestParser(t, newTestStorage(), "http://127.0.0.1:0")
+	p.SetSubscriptionLimit(2)
+
+	for _, address := range []string{"0x1", "0x2"} {
+		if ok, err := p.Subscribe("acme", address); !ok || err != nil {
+			t.Fatalf("Subscribe returned %v, %v, expected true", ok, err)
+		}
+	}
+	if _, err := p.Subscribe("acme", "0x3"); !errors.Is(err, ErrSubscriptionLimit) {
+		t.Errorf("Subscribe returned %v, expected %v", err, ErrSubscriptionLimit)
+	}
+
+	// Subscribing again, or as another tenant, does not count against the limit
+	if ok, err := p.Subscribe("acme", "0x1"); ok || err != nil {
+		t.Errorf("Subscribe returned %v, %v, expected false for an existing subscription", ok, err)
+	}
+	if ok, err := p.Subscribe("globex", "0x3"); !ok || err != nil {
+		t.Errorf("Subscribe returned %v, %v, expected true for another tenant", ok, err)
+	}
+}
+
+// Define a test of the status of a parser that never reached its node
+func TestStatusUnreachable(t *testing.T) {
+	p := newTestParser(t, newTestStorage(), "http://127.0.0.1:0")
+
+	if status := p.Status(); !status.LastPoll.IsZero() || status.Endpoint != "127.0.0.1:0" {
+		t.Errorf("Status returned %+v, expected no poll yet", status)
+	}
+	if err := p.Ping(context.Background()); err == nil {
+		t.Errorf("Ping returned no error for an unreachable node")
+	}
+}
+
+// Define a test for the progress of a backfill
+func TestBackfillProgress(t *testing.T) {
+	tests := []struct {
+		backfill Backfill
+		want     float64
+	}{
+		{Backfill{From: 10, To: 20, Current: 10}, 0},
+		{Backfill{From: 10, To: 20, Current: 15}, 0.5},
+		{Backfill{From: 10, To: 20, Current: 20}, 1},
+		{Backfill{From: 20, To: 20, Current: 20}, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.backfill.Progress(); got != tt.want {
+			t.Errorf("Progress of %+v returned %v, expected %v", tt.backfill, got, tt.want)
+		}
+	}
+}
+
+// Define a test for the block synchronisation
+func TestSyncBlocks(t *testing.T) {
+	node := newTestNode(t, []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000", Transactions: []map[string]string{
+			{"hash": "0x01", "from": "0x123", "to": "0x456", "value": "0x1"},
+			{"hash": "0x02", "from": "0x789", "to": "0xabc", "value": "0x2"},
+		}},
+		{Hash: "0xb2", Timestamp: "0x6400000c", Transactions: []map[string]string{
+			{"hash": "0x03", "from": "0x456", "to": "0x123", "value": "0x3", "status": "0x0"},
+		}},
+	})
+	storage := newTestStorage("0x123", "0x456")
+	p := newTestParser(t, storage, node.URL)
+	pub := &testPublisher{}
+	p.AddPublisher(pub)
+	processed := testutil.ToFloat64(metrics.BlocksProcessed)
+	matched := testutil.ToFloat64(metrics.MatchedTransactions)
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+	if got := len(pub.events); got != 6 {
+		t.Errorf("published %d events, expected 4 transactions and 2 new heads", got)
+	}
+
+	if got := p.GetCurrentBlock(); got != 2 {
+		t.Errorf("GetCurrentBlock returned %d, expected 2", got)
+	}
+	if got := storage.Checkpoint(); got != 2 {
+		t.Errorf("Checkpoint returned %d, expected 2", got)
+	}
+	txs := p.GetTransactions("0x123")
+	if len(txs) != 2 {
+		t.Fatalf("GetTransactions returned %d transactions for 0x123, expected 2", len(txs))
+	}
+	if txs[0].Status != TransactionSuccess || txs[1].Status != TransactionFailed {
+		t.Errorf("GetTransactions returned the statuses %q and %q, expected success and failed", txs[0].Status, txs[1].Status)
+	}
+	if got, err := p.GetBalance("0x123"); err != nil || got != "1000000000000000000" {
+		t.Errorf("GetBalance returned %q, %v, expected 1000000000000000000", got, err)
+	}
+	if got := len(p.GetTransactions("0x789")); got != 0 {
+		t.Errorf("GetTransactions returned %d transactions for 0x789, expected 0", got)
+	}
+
+	if got := testutil.ToFloat64(metrics.BlocksProcessed) - processed; got != 2 {
+		t.Errorf("blocks_processed_total grew by %v, expected 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.MatchedTransactions) - matched; got != 4 {
+		t.Errorf("matched_transactions_total grew by %v, expected 4", got)
+	}
+	if got := testutil.ToFloat64(metrics.BlockLag); got != 0 {
+		t.Errorf("block_lag is %v, expected 0", got)
+	}
+
+	status := p.Status()
+	if status.HeadBlock != 2 || status.ProcessedBlock != 2 || status.Lag != 0 || status.LastPoll.IsZero() || status.Backfill != nil {
+		t.Errorf("Status returned %+v, expected the parser caught up with block 2", status)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Errorf("Ping returned error: %v", err)
+	}
+
+	// A second run must not store the same blocks again
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+	if got := len(p.GetTransactions("0x456")); got != 2 {
+		t.Errorf("GetTransactions returned %d transactions for 0x456, expected 2", got)
+	}
+}
+
+// Define a test of the blocks held back until they have enough confirmations
+func TestSyncBlocksConfirmations(t *testing.T) {
+	node := newTestNode(t, []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000"},
+		{Hash: "0xb2", Timestamp: "0x6400000c"},
+		{Hash: "0xb3", Timestamp: "0x64000018"},
+	})
+	storage := newTestStorage()
+	p := newTestParser(t, storage, node.URL)
+	p.SetConfirmations(2)
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+	if got := storage.Checkpoint(); got != 1 {
+		t.Errorf("Checkpoint returned %d, expected 1", got)
+	}
+
+	status := p.Status()
+	if status.HeadBlock != 3 || status.ProcessedBlock != 1 || status.Lag != 0 {
+		t.Errorf("Status returned %+v, expected block 1 processed and no lag", status)
+	}
+}
+
+// Define a test of the spans recorded while processing blocks
+func TestSyncBlocksTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.Setup(tracing.Config{ServiceName: "test", SampleRatio: 1}, exporter)
+	defer provider.Shutdown(context.Background())
+
+	node := newTestNode(t, []testBlock{{Hash: "0xb1", Timestamp: "0x64000000", Transactions: []map[string]string{
+		{"hash": "0x01", "from": "0x123", "to": "0x456", "value": "0x1"},
+	}}})
+	p := newTestParser(t, newTestStorage("0x123"), node.URL)
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+	provider.ForceFlush(context.Background())
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	block, ok := spans["parser.processBlock"]
+	if !ok {
+		t.Fatalf("exported %v, expected a parser.processBlock span", exporter.GetSpans())
+	}
+	for _, name := range []string{"rpc eth_getBlockByNumber", "storage.Subscribers", "storage.CommitBlock"} {
+		if span, ok := spans[name]; !ok || span.Parent.SpanID() != block.SpanContext.SpanID() {
+			t.Errorf("exported %s under %v, expected it under the block span", name, span.Parent.SpanID())
+		}
+	}
+}
+
+// Define a test for the RetentionPolicy expiry rules
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tx := Transaction{BlockNumber: big.NewInt(90), Timestamp: now.Add(-2 * time.Hour).Unix()}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   bool
+	}{
+		{"disabled", RetentionPolicy{}, false},
+		{"within age", RetentionPolicy{MaxAge: 3 * time.Hour}, false},
+		{"past age", RetentionPolicy{MaxAge: time.Hour}, true},
+		{"within blocks", RetentionPolicy{MaxBlocks: 20}, false},
+		{"past blocks", RetentionPolicy{MaxBlocks: 10}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Expired(tx, 100, now); got != tt.want {
+			t.Errorf("%s: Expired returned %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Define a stress test of the parser serving queries while it ingests blocks, meant to run under -race
+func TestConcurrentSync(t *testing.T) {
+	blocks := make([]testBlock, 50)
+	for i := range blocks {
+		blocks[i] = testBlock{Hash: fmt.Sprintf("0xb%d", i), Timestamp: "0x64000000", Transactions: []map[string]string{
+			{"hash": fmt.Sprintf("0x%d", i), "from": "0x123", "to": "0x456", "value": "0x1"},
+		}}
+	}
+	node := newTestNode(t, blocks)
+	p := newTestParser(t, newTestStorage("0x123"), node.URL)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := p.syncBlocks(context.Background()); err != nil {
+				t.Errorf("syncBlocks returned error: %v", err)
+			}
+		}()
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				p.Subscribe(DefaultTenant, fmt.Sprintf("0x%d", w))
+				block := p.GetCurrentBlock()
+				if got := len(p.GetTransactions("0x123")); got < block {
+					t.Errorf("GetTransactions returned %d records at block %d", got, block)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if got := p.GetCurrentBlock(); got != len(blocks) {
+		t.Errorf("GetCurrentBlock returned %d, expected %d", got, len(blocks))
+	}
+	if got := len(p.GetTransactions("0x123")); got != len(blocks) {
+		t.Errorf("GetTransactions returned %d records, expected %d", got, len(blocks))
+	}
+}
+
+// indexingStorage is a testStorage that can rebuild past blocks
+type indexingStorage struct {
+	*testStorage
+}
+
+func (s indexingStorage) Backfill(address string, txs []Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+	s.transactions[address] = append(s.transactions[address], txs...)
+	return nil
+}
+
+func (s indexingStorage) Rewind(block int) error {
+	s.Lock()
+	defer s.Unlock()
+	for address, txs := range s.transactions {
+		var kept []Transaction
+		for _, tx := range txs {
+			if blockOf(tx) <= int64(block) {
+				kept = append(kept, tx)
+			}
+		}
+		s.transactions[address] = kept
+	}
+	s.checkpoint = block
+	return nil
+}
+
+// Define a test of the commands rebuilding and inspecting past blocks
+func TestBackfillReindexInspect(t *testing.T) {
+	node := newTestNode(t, []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000", Transactions: []map[string]string{
+			{"hash": "0x01", "from": "0x123", "to": "0x456", "value": "0x1"},
+		}},
+		{Hash: "0xb2", Timestamp: "0x6400000c", Transactions: []map[string]string{
+			{"hash": "0x02", "from": "0x456", "to": "0x789", "value": "0x2"},
+		}},
+	})
+	storage := indexingStorage{newTestStorage("0x123")}
+	p := NewIdleEthereumParser(storage, node.URL, zap.NewNop().Sugar())
+
+	if err := NewIdleEthereumParser(newTestStorage(), node.URL, zap.NewNop().Sugar()).Reindex(context.Background(), 1); !errors.Is(err, ErrIndexUnsupported) {
+		t.Errorf("Reindex returned %v, expected %v", err, ErrIndexUnsupported)
+	}
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+	if got := len(p.GetTransactions("0x456")); got != 0 {
+		t.Errorf("GetTransactions returned %d transactions for 0x456, expected 0", got)
+	}
+
+	// 0x456 subscribed after both blocks were processed
+	p.Subscribe(DefaultTenant, "0x456")
+	inspection, err := p.InspectBlock(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("InspectBlock returned error: %v", err)
+	}
+	if inspection.Hash != "0xb2" || inspection.Transactions != 1 || len(inspection.Matched["0x456"]) != 1 {
+		t.Errorf("InspectBlock returned %+v, expected block 2 matching 0x456", inspection)
+	}
+	if _, err = p.Backfill(context.Background(), 1, 3, nil); err == nil {
+		t.Errorf("Backfill accepted a block after the checkpoint")
+	}
+	stats, err := p.Backfill(context.Background(), 1, 2, []string{"0x456"})
+	if err != nil {
+		t.Fatalf("Backfill returned error: %v", err)
+	}
+	if stats.Blocks != 2 || stats.Transactions != 2 || len(p.GetTransactions("0x456")) != 2 {
+		t.Errorf("Backfill returned %+v, expected both transactions of 0x456 stored", stats)
+	}
+
+	p.Unsubscribe(DefaultTenant, "0x123", false)
+	if err = p.Reindex(context.Background(), 2); err != nil {
+		t.Fatalf("Reindex returned error: %v", err)
+	}
+	if got := len(p.GetTransactions("0x123")); got != 1 {
+		t.Errorf("GetTransactions returned %d transactions for 0x123, expected the one of block 1", got)
+	}
+	if got := p.GetCurrentBlock(); got != 2 || storage.Checkpoint() != 2 {
+		t.Errorf("GetCurrentBlock returned %d, expected 2", got)
+	}
+}
+
+// Define a test of the confirmation and status events announced until a transaction is final
+func TestSyncBlocksFinality(t *testing.T) {
+	node := newTestNode(t, []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000", Transactions: []map[string]string{
+			{"hash": "0x01", "from": "0x123", "to": "0x456", "value": "0x1"},
+		}},
+		{Hash: "0xb2", Timestamp: "0x6400000c"},
+		{Hash: "0xb3", Timestamp: "0x64000018"},
+		{Hash: "0xb4", Timestamp: "0x64000024"},
+	})
+	p := NewIdleEthereumParser(newTestStorage("0x123"), node.URL, zap.NewNop().Sugar())
+	p.SetFinality(3)
+	pub := &testPublisher{}
+	p.AddPublisher(pub)
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+
+	var got []string
+	for _, e := range pub.events {
+		if e.Type != EventNewHead {
+			got = append(got, fmt.Sprintf("%s:%d:%d:%s", e.Type, e.Block, e.Confirmations, e.Status))
+		}
+	}
+	expected := []string{"transaction:1:0:", "confirmation:2:2:", "status:3:3:confirmed"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("published %v, expected %v", got, expected)
+	}
+}
+
+// Define a test of the token transfers decoded from the receipt logs
+func TestSyncBlocksTransfers(t *testing.T) {
+	word := func(s string) string { return fmt.Sprintf("%064s", s) }
+	topic := func(address string) string { return "0x" + word(strings.TrimPrefix(address, "0x")) }
+	alice, bob, carol := "0x"+strings.Repeat("a", 40), "0x"+strings.Repeat("b", 40), "0x"+strings.Repeat("c", 40)
+	node := newTestNode(t, []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000", Transactions: []map[string]string{
+			{"hash": "0x01", "from": bob, "to": "0xc0", "value": "0x0"},
+			{"hash": "0x02", "from": bob, "to": "0xc1", "value": "0x0"},
+		}, Logs: map[string][]map[string]any{
+			"0x01": {
+				// ERC-20 transfer of 0x64 tokens to alice
+				{"address": "0xC0", "logIndex": "0x0", "topics": []string{topicTransfer, topic(bob), topic(alice)}, "data": "0x" + word("64")},
+				// ERC-721 transfer of token 0x7 between other addresses
+				{"address": "0xc2", "logIndex": "0x1", "topics": []string{topicTransfer, topic(bob), topic(carol), "0x" + word("7")}, "data": "0x"},
+			},
+			"0x02": {
+				// ERC-1155 transfer of 0x3 tokens 0x9 from alice
+				{"address": "0xc1", "logIndex": "0x2", "topics": []string{topicTransferSingle, topic(bob), topic(alice), topic(bob)}, "data": "0x" + word("9") + word("3")},
+				// ERC-1155 batch of tokens 0x1 and 0x2 to alice
+				{"address": "0xc1", "logIndex": "0x3", "topics": []string{topicTransferBatch, topic(bob), topic(bob), topic(alice)},
+					"data": "0x" + word("40") + word("a0") + word("2") + word("1") + word("2") + word("2") + word("5") + word("6")},
+			},
+		}},
+	})
+	p := NewIdleEthereumParser(newTestStorage(alice), node.URL, zap.NewNop().Sugar())
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+
+	txs := p.GetTransactions(alice)
+	if len(txs) != 2 {
+		t.Fatalf("GetTransactions returned %d transactions, expected the 2 transferring tokens of the address", len(txs))
+	}
+	expected := []TokenTransfer{
+		{Token: "0xc0", Standard: StandardERC20, From: bob, To: alice, Value: "0x64", LogIndex: 0},
+		{Token: "0xc2", Standard: StandardERC721, From: bob, To: carol, Value: "0x1", TokenID: "0x7", LogIndex: 1},
+	}
+	if !reflect.DeepEqual(txs[0].Transfers, expected) {
+		t.Errorf("the first transaction has the transfers %+v, expected %+v", txs[0].Transfers, expected)
+	}
+	expected = []TokenTransfer{
+		{Token: "0xc1", Standard: StandardERC1155, From: alice, To: bob, Value: "0x3", TokenID: "0x9", LogIndex: 2},
+		{Token: "0xc1", Standard: StandardERC1155, From: bob, To: alice, Value: "0x5", TokenID: "0x1", LogIndex: 3},
+		{Token: "0xc1", Standard: StandardERC1155, From: bob, To: alice, Value: "0x6", TokenID: "0x2", LogIndex: 3},
+	}
+	if !reflect.DeepEqual(txs[1].Transfers, expected) {
+		t.Errorf("the second transaction has the transfers %+v, expected %+v", txs[1].Transfers, expected)
+	}
+}
+
+// Define a test of the events replayed from the storage
+func TestReplay(t *testing.T) {
+	node := newTestNode(t, []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000", Transactions: []map[string]string{
+			{"hash": "0x01", "from": "0x123", "to": "0x456", "value": "0x1"},
+		}},
+		{Hash: "0xb2", Timestamp: "0x6400000c"},
+		{Hash: "0xb3", Timestamp: "0x64000018"},
+		{Hash: "0xb4", Timestamp: "0x64000024"},
+	})
+	p := NewIdleEthereumParser(newTestStorage("0x123"), node.URL, zap.NewNop().Sugar())
+	p.SetFinality(3)
+	pub := &testPublisher{}
+	p.AddPublisher(pub)
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+
+	keys := func(events []Event) []string {
+		var keys []string
+		for _, e := range events {
+			keys = append(keys, e.Key())
+		}
+		return keys
+	}
+
+	// The replay publishes the same events as the sync did
+	replayed := &testPublisher{}
+	if n := p.replay(0, replayed); n != len(pub.events) {
+		t.Errorf("replay returned %d, expected %d", n, len(pub.events))
+	}
+	if got, expected := keys(replayed.events), keys(pub.events); !reflect.DeepEqual(got, expected) {
+		t.Errorf("replayed %v, expected %v", got, expected)
+	}
+
+	// Only the events of the blocks after the given one are published again, before the publisher is added
+	replayed.events = nil
+	if n := p.AddPublisherAfter(replayed, 2); n != 3 {
+		t.Errorf("AddPublisherAfter returned %d, expected 3", n)
+	}
+	expected := []string{"status:3:0x01:0x123", "new_head:3:", "new_head:4:"}
+	if got := keys(replayed.events); !reflect.DeepEqual(got, expected) {
+		t.Errorf("replayed %v, expected %v", got, expected)
+	}
+	if got := len(p.publishers); got != 2 {
+		t.Errorf("the parser has %d publishers, expected 2", got)
+	}
+}
+
+// Define a test of a reorganisation replacing the last blocks processed
+func TestSyncBlocksReorg(t *testing.T) {
+	blocks := []testBlock{
+		{Hash: "0xb1", Timestamp: "0x64000000"},
+		{Hash: "0xb2", Timestamp: "0x6400000c", Transactions: []map[string]string{
+			{"hash": "0x02", "from": "0x123", "to": "0x456", "value": "0x1"},
+		}},
+		{Hash: "0xb3", Timestamp: "0x64000018", Transactions: []map[string]string{
+			{"hash": "0x03", "from": "0x456", "to": "0x123", "value": "0x2"},
+		}},
+		{Hash: "0xb4", Timestamp: "0x64000024"},
+	}
+	node := newTestNode(t, blocks)
+	storage := indexingStorage{newTestStorage("0x123")}
+	p := NewIdleEthereumParser(storage, node.URL, zap.NewNop().Sugar())
+	p.SetConfirmations(1)
+	pub := &testPublisher{}
+	p.AddPublisher(pub)
+	reorgs := testutil.ToFloat64(metrics.Reorgs)
+
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+	if got := len(p.GetTransactions("0x123")); got != 2 {
+		t.Fatalf("GetTransactions returned %d transactions, expected 2", got)
+	}
+
+	// Blocks 2 and 3 are replaced, block 2 of the new chain no longer holding 0x123's transaction
+	blocks[1] = testBlock{Hash: "0xc2", Timestamp: "0x6400000c"}
+	blocks[2] = testBlock{Hash: "0xc3", Timestamp: "0x64000018", Transactions: blocks[2].Transactions}
+	pub.events = nil
+	p.SetConfirmations(0)
+	if err := p.syncBlocks(context.Background()); err != nil {
+		t.Fatalf("syncBlocks returned error: %v", err)
+	}
+
+	// The reorganisation is announced before the removals, all of them with the fork
+	var removed []string
+	for _, e := range pub.events {
+		if e.Type != EventReorg {
+			continue
+		}
+		if e.Fork != 1 {
+			t.Errorf("published %s with the fork %d, expected 1", e.Key(), e.Fork)
+		}
+		if e.Transaction == nil {
+			removed = append(removed, "chain")
+			continue
+		}
+		removed = append(removed, e.Transaction.Hash)
+	}
+	if !reflect.DeepEqual(removed, []string{"chain", "0x02", "0x03"}) {
+		t.Errorf("published the removal of %v, expected [chain 0x02 0x03]", removed)
+	}
+	txs := p.GetTransactions("0x123")
+	if len(txs) != 1 || txs[0].Hash != "0x03" || txs[0].BlockHash != "0xc3" {
+		t.Errorf("GetTransactions returned %+v, expected 0x03 of the new block 3", txs)
+	}
+	if got := storage.Checkpoint(); got != 4 {
+		t.Errorf("Checkpoint returned %d, expected 4", got)
+	}
+	if got := testutil.ToFloat64(metrics.Reorgs) - reorgs; got != 1 {
+		t.Errorf("reorgs_total grew by %v, expected 1", got)
+	}
+}
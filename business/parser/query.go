@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxQueryLimit caps the page size a client can ask for.
+const MaxQueryLimit = 1000
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Direction selects transactions by the side the queried address is on.
+type Direction string
+
+const (
+	DirectionAll Direction = "all"
+	DirectionIn  Direction = "in"
+	DirectionOut Direction = "out"
+)
+
+// TransactionQuery filters and paginates the transactions of an address. Zero values disable the
+// corresponding filter, and a zero Limit returns every remaining transaction.
+type TransactionQuery struct {
+	Limit     int
+	Cursor    string
+	Direction Direction
+	FromBlock int64
+	ToBlock   int64
+	Since     int64
+	Until     int64
+	MinValue  *big.Int
+	Status    string
+}
+
+// UpTo narrows the query to the transactions of the blocks up to block, the whole query being kept when block is 0.
+func (q TransactionQuery) UpTo(block int) TransactionQuery {
+	if block > 0 && (q.ToBlock == 0 || q.ToBlock > int64(block)) {
+		q.ToBlock = int64(block)
+	}
+	return q
+}
+
+// Match reports whether a transaction of address satisfies the filters of the query.
+func (q TransactionQuery) Match(address string, tx Transaction) bool {
+	switch q.Direction {
+	case DirectionIn:
+		if tx.To != address && !tx.receives(address) {
+			return false
+		}
+	case DirectionOut:
+		if tx.From != address && !tx.sends(address) {
+			return false
+		}
+	}
+	if !q.inRange(tx) {
+		return false
+	}
+	if q.Status != "" && tx.Status != q.Status {
+		return false
+	}
+	if q.MinValue != nil {
+		value, ok := new(big.Int).SetString(tx.Value, 0)
+		if !ok || value.Cmp(q.MinValue) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inRange reports whether a transaction was made within the block and time ranges of the query.
+func (q TransactionQuery) inRange(tx Transaction) bool {
+	block := blockOf(tx)
+	if q.FromBlock > 0 && block < q.FromBlock {
+		return false
+	}
+	if q.ToBlock > 0 && block > q.ToBlock {
+		return false
+	}
+	if q.Since > 0 && tx.Timestamp < q.Since {
+		return false
+	}
+	if q.Until > 0 && tx.Timestamp > q.Until {
+		return false
+	}
+	return true
+}
+
+// receives reports whether a transaction transferred tokens to an address.
+func (tx Transaction) receives(address string) bool {
+	for _, t := range tx.Transfers {
+		if t.To == address {
+			return true
+		}
+	}
+	return false
+}
+
+// sends reports whether a transaction transferred tokens from an address.
+func (tx Transaction) sends(address string) bool {
+	for _, t := range tx.Transfers {
+		if t.From == address {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryTransactions Gets a page of an address's transactions, oldest first, along with the cursor of the last
+// returned one. Passing that cursor back returns what comes after it, so clients can sync incrementally by
+// polling with the latest cursor they got.
+func (p *EthereumParser) QueryTransactions(address string, q TransactionQuery) ([]Transaction, string, error) {
+	txs := p.storage.GetTransactions(address)
+
+	start := 0
+	if q.Cursor != "" {
+		block, hash, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		start = len(txs)
+		for i, tx := range txs {
+			// The cursor transaction may have been pruned, then resume at the first later block
+			if tx.Hash == hash && blockOf(tx) == block {
+				start = i + 1
+				break
+			}
+			if blockOf(tx) > block {
+				start = i
+				break
+			}
+		}
+	}
+
+	page := []Transaction{}
+	for _, tx := range txs[start:] {
+		if !q.Match(address, tx) {
+			continue
+		}
+		page = append(page, tx)
+		if q.Limit > 0 && len(page) == q.Limit {
+			break
+		}
+	}
+
+	next := q.Cursor
+	if len(page) > 0 {
+		next = CursorOf(page[len(page)-1])
+	}
+
+	return page, next, nil
+}
+
+// Transfer is a token transfer of an address, along with the transaction that made it.
+type Transfer struct {
+	TokenTransfer
+	Transaction Transaction
+	index       int // position of the transfer among the ones of the transaction
+}
+
+// QueryTransfers Gets a page of an address's fungible token transfers, or of its NFT transfers when nft is set,
+// oldest first, along with the cursor of the last returned one. The query filters them like QueryTransactions
+// does transactions: the direction and minimum value apply to the transfers, the status is ignored since failed
+// transactions transfer nothing.
+func (p *EthereumParser) QueryTransfers(address string, nft bool, q TransactionQuery) ([]Transfer, string, error) {
+	txs := p.storage.GetTransactions(address)
+
+	start, from := 0, 0
+	if q.Cursor != "" {
+		block, hash, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		hash, index, ok := strings.Cut(hash, "#")
+		position, err := strconv.Atoi(index)
+		if !ok || err != nil || position < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		start = len(txs)
+		for i, tx := range txs {
+			// The cursor transaction may have been pruned, then resume at the first later block
+			if tx.Hash == hash && blockOf(tx) == block {
+				start, from = i, position+1
+				break
+			}
+			if blockOf(tx) > block {
+				start = i
+				break
+			}
+		}
+	}
+
+	page := []Transfer{}
+	for i, tx := range txs[start:] {
+		if !q.inRange(tx) {
+			continue
+		}
+		for j, t := range tx.Transfers {
+			if (i == 0 && j < from) || t.NFT() != nft || !q.matchTransfer(address, t) {
+				continue
+			}
+			page = append(page, Transfer{TokenTransfer: t, Transaction: tx, index: j})
+			if q.Limit > 0 && len(page) == q.Limit {
+				return page, CursorOfTransfer(page[len(page)-1]), nil
+			}
+		}
+	}
+
+	next := q.Cursor
+	if len(page) > 0 {
+		next = CursorOfTransfer(page[len(page)-1])
+	}
+	return page, next, nil
+}
+
+// matchTransfer reports whether a token transfer of address satisfies the direction and value filters.
+func (q TransactionQuery) matchTransfer(address string, t TokenTransfer) bool {
+	switch q.Direction {
+	case DirectionIn:
+		if t.To != address {
+			return false
+		}
+	case DirectionOut:
+		if t.From != address {
+			return false
+		}
+	default:
+		if !t.Involves(address) {
+			return false
+		}
+	}
+	if q.MinValue != nil {
+		value, ok := new(big.Int).SetString(t.Value, 0)
+		if !ok || value.Cmp(q.MinValue) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// blockOf returns the block number of a transaction, 0 when it is unknown.
+func blockOf(tx Transaction) int64 {
+	if tx.BlockNumber == nil {
+		return 0
+	}
+	return tx.BlockNumber.Int64()
+}
+
+// CursorOf builds the opaque cursor pointing right after a transaction.
+func CursorOf(tx Transaction) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", blockOf(tx), tx.Hash)))
+}
+
+// CursorOfTransfer builds the opaque cursor pointing right after a token transfer.
+func CursorOfTransfer(t Transfer) string {
+	raw := fmt.Sprintf("%d:%s#%d", blockOf(t.Transaction), t.Transaction.Hash, t.index)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor extracts the block number and hash of the transaction a cursor points after.
+func decodeCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	block, hash, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, "", ErrInvalidCursor
+	}
+	number, err := strconv.ParseInt(block, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+
+	return number, hash, nil
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// Define a test for the filters and pagination of QueryTransactions
+func TestQueryTransactions(t *testing.T) {
+	storage := newTestStorage("0x123")
+	for i := 1; i <= 5; i++ {
+		tx := Transaction{
+			Hash:        fmt.Sprintf("0x%d", i),
+			From:        "0x123",
+			To:          "0x456",
+			Value:       fmt.Sprintf("0x%x", i*100),
+			BlockNumber: big.NewInt(int64(i)),
+			Timestamp:   int64(1000 + i),
+		}
+		if i%2 == 0 {
+			tx.From, tx.To = tx.To, tx.From
+		}
+		storage.AddTransaction("0x123", tx)
+	}
+	p := newTestParser(t, storage, "http://127.0.0.1:0")
+
+	tests := []struct {
+		name  string
+		query TransactionQuery
+		want  []string
+	}{
+		{"all", TransactionQuery{}, []string{"0x1", "0x2", "0x3", "0x4", "0x5"}},
+		{"incoming", TransactionQuery{Direction: DirectionIn}, []string{"0x2", "0x4"}},
+		{"outgoing", TransactionQuery{Direction: DirectionOut}, []string{"0x1", "0x3", "0x5"}},
+		{"block range", TransactionQuery{FromBlock: 2, ToBlock: 3}, []string{"0x2", "0x3"}},
+		{"time range", TransactionQuery{Since: 1004, Until: 1005}, []string{"0x4", "0x5"}},
+		{"min value", TransactionQuery{MinValue: big.NewInt(300)}, []string{"0x3", "0x4", "0x5"}},
+		{"status", TransactionQuery{Status: "failed"}, []string{}},
+		{"limit", TransactionQuery{Limit: 2}, []string{"0x1", "0x2"}},
+	}
+	for _, tt := range tests {
+		txs, _, err := p.QueryTransactions("0x123", tt.query)
+		if err != nil {
+			t.Fatalf("%s: QueryTransactions returned error: %v", tt.name, err)
+		}
+		got := make([]string, 0, len(txs))
+		for _, tx := range txs {
+			got = append(got, tx.Hash)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: QueryTransactions returned %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Walking the pages with next cursor visits every transaction once
+	var hashes []string
+	cursor := ""
+	for page := 0; page < 4; page++ {
+		txs, next, err := p.QueryTransactions("0x123", TransactionQuery{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("QueryTransactions returned error: %v", err)
+		}
+		for _, tx := range txs {
+			hashes = append(hashes, tx.Hash)
+		}
+		cursor = next
+	}
+	if fmt.Sprint(hashes) != "[0x1 0x2 0x3 0x4 0x5]" {
+		t.Errorf("paging returned %v, expected every transaction once", hashes)
+	}
+
+	if _, _, err := p.QueryTransactions("0x123", TransactionQuery{Cursor: "!!"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("QueryTransactions returned %v, expected %v", err, ErrInvalidCursor)
+	}
+}
+
+// Define a test for the filters and pagination of QueryTransfers
+func TestQueryTransfers(t *testing.T) {
+	storage := newTestStorage("0x123")
+	for i := 1; i <= 2; i++ {
+		storage.AddTransaction("0x123", Transaction{
+			Hash:        fmt.Sprintf("0x%d", i),
+			From:        "0x999",
+			To:          "0xc0",
+			BlockNumber: big.NewInt(int64(i)),
+			Transfers: []TokenTransfer{
+				{Token: "0xc0", Standard: StandardERC20, From: "0x999", To: "0x123", Value: fmt.Sprintf("0x%d", i), LogIndex: 0},
+				{Token: "0xc0", Standard: StandardERC20, From: "0x123", To: "0x456", Value: "0x9", LogIndex: 1},
+				{Token: "0xc1", Standard: StandardERC721, From: "0x999", To: "0x123", Value: "0x1", TokenID: fmt.Sprintf("0x%d", i), LogIndex: 2},
+				{Token: "0xc0", Standard: StandardERC20, From: "0x999", To: "0x456", Value: "0x8", LogIndex: 3},
+			},
+		})
+	}
+	p := newTestParser(t, storage, "http://127.0.0.1:0")
+
+	tests := []struct {
+		name  string
+		nft   bool
+		query TransactionQuery
+		want  []string
+	}{
+		{"tokens", false, TransactionQuery{}, []string{"0x1", "0x9", "0x2", "0x9"}},
+		{"incoming", false, TransactionQuery{Direction: DirectionIn}, []string{"0x1", "0x2"}},
+		{"min value", false, TransactionQuery{MinValue: big.NewInt(2)}, []string{"0x9", "0x2", "0x9"}},
+		{"block range", false, TransactionQuery{FromBlock: 2}, []string{"0x2", "0x9"}},
+		{"nfts", true, TransactionQuery{}, []string{"0x1", "0x2"}},
+	}
+	for _, tt := range tests {
+		transfers, _, err := p.QueryTransfers("0x123", tt.nft, tt.query)
+		if err != nil {
+			t.Fatalf("%s: QueryTransfers returned error: %v", tt.name, err)
+		}
+		got := make([]string, 0, len(transfers))
+		for _, transfer := range transfers {
+			if tt.nft {
+				got = append(got, transfer.TokenID)
+			} else {
+				got = append(got, transfer.Value)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: QueryTransfers returned %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Walking the pages with next cursor visits every transfer once, even within a transaction
+	var visited []string
+	cursor := ""
+	for page := 0; page < 4; page++ {
+		transfers, next, err := p.QueryTransfers("0x123", false, TransactionQuery{Limit: 1, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("QueryTransfers returned error: %v", err)
+		}
+		for _, transfer := range transfers {
+			visited = append(visited, fmt.Sprintf("%s/%d", transfer.Transaction.Hash, transfer.LogIndex))
+		}
+		cursor = next
+	}
+	if fmt.Sprint(visited) != "[0x1/0 0x1/1 0x2/0 0x2/1]" {
+		t.Errorf("paging returned %v, expected every transfer once", visited)
+	}
+
+	if _, _, err := p.QueryTransfers("0x123", false, TransactionQuery{Cursor: CursorOf(Transaction{Hash: "0x1"})}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("QueryTransfers returned %v, expected %v for a transaction cursor", err, ErrInvalidCursor)
+	}
+}
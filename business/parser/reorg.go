@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"trustwallet/business/metrics"
+)
+
+// reorgDepth is the number of committed blocks whose hash the parser remembers to find where a reorganisation
+// forked. Deeper reorganisations stop the sync until the blocks are reindexed.
+const reorgDepth = 64
+
+// errReorg is returned by processBlock once it rewound the storage to the fork of a reorganisation, for
+// syncBlocks to go on from there.
+var errReorg = errors.New("chain reorganised")
+
+// recentBlock is a committed block still within reorgDepth of the last one, with the transaction events it
+// stored.
+type recentBlock struct {
+	number int
+	hash   string
+	events []Event
+	final  bool // the transactions got their status event, or the parser does not announce confirmations
+}
+
+// SetFinality Makes the parser announce every new confirmation of the stored transactions with confirmation
+// events, until they are buried under n blocks and get a status event. 0 announces nothing.
+func (p *EthereumParser) SetFinality(n int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.finality = n
+}
+
+// checkFork compares the parent of a block with the last committed one. When they differ, it finds the last
+// block both chains share, rewinds the storage to it, publishes the reorganisation and the removal of the
+// transactions stored since, and returns errReorg. Reorganisations happening while the parser is stopped are not detected.
+func (p *EthereumParser) checkFork(ctx context.Context, block Block) error {
+	if len(p.recent) == 0 {
+		return nil
+	}
+	last := p.recent[len(p.recent)-1]
+	if last.number != block.Number-1 || last.hash == block.ParentHash {
+		return nil
+	}
+
+	fork := -1
+	for i := len(p.recent) - 2; i >= 0; i-- {
+		b, err := p.fetchBlock(ctx, p.recent[i].number)
+		if err != nil {
+			return err
+		}
+		if b.Hash == p.recent[i].hash {
+			fork = i
+			break
+		}
+	}
+	if fork < 0 {
+		return fmt.Errorf("block %d forks deeper than the %d blocks remembered, reindex from an earlier block", block.Number, len(p.recent))
+	}
+
+	forkBlock := p.recent[fork].number
+	indexer, err := AsIndexer(p.storage)
+	if err != nil {
+		return fmt.Errorf("reorganisation at block %d: %w", block.Number, err)
+	}
+	if err = indexer.Rewind(forkBlock); err != nil {
+		return fmt.Errorf("rewinding the reorganisation at block %d to block %d: %w", block.Number, forkBlock, err)
+	}
+
+	removed := []Event{{Type: EventReorg, Block: block.Number, BlockHash: block.Hash, Fork: forkBlock}}
+	for _, b := range p.recent[fork+1:] {
+		for _, e := range b.events {
+			removed = append(removed, Event{Type: EventReorg, Address: e.Address, Block: block.Number, BlockHash: block.Hash, Transaction: e.Transaction, Fork: forkBlock})
+		}
+	}
+	p.recent = p.recent[:fork+1]
+
+	p.lock.Lock()
+	p.currentBlock = forkBlock
+	publishers := p.publishers
+	p.lock.Unlock()
+
+	metrics.ProcessedBlock.Set(float64(forkBlock))
+	metrics.Reorgs.Inc()
+	p.Log.Warnw("reorg", "block", block.Number, "fork", forkBlock, "removed", len(removed)-1)
+
+	for _, e := range removed {
+		for _, pub := range publishers {
+			pub.Publish(e)
+		}
+	}
+
+	return errReorg
+}
+
+// confirm remembers a committed block with its transaction events, and returns the confirmation and status
+// events its commit brings to the transactions of the recent blocks, its own included. buried is the number of
+// blocks the block was already buried under when processed.
+func (p *EthereumParser) confirm(block Block, events []Event, buried, finality int) []Event {
+	p.recent = append(p.recent, recentBlock{number: block.Number, hash: block.Hash, events: events, final: finality == 0})
+	if len(p.recent) > reorgDepth {
+		p.recent = p.recent[len(p.recent)-reorgDepth:]
+	}
+
+	var updates []Event
+	for i := range p.recent {
+		b := &p.recent[i]
+		if b.final {
+			continue
+		}
+
+		confirmations := block.Number - b.number + buried + 1
+		update := Event{Type: EventConfirmation, Block: block.Number, BlockHash: block.Hash, Confirmations: confirmations}
+		if confirmations >= finality {
+			update.Type, update.Status = EventStatus, StatusConfirmed
+			b.final = true
+		} else if b.number == block.Number {
+			// the transaction events already announce the first confirmation
+			continue
+		}
+		for _, e := range b.events {
+			update.Address, update.Transaction = e.Address, e.Transaction
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+// forget drops the recent blocks after block, once the storage was rewound to it.
+func (p *EthereumParser) forget(block int) {
+	for len(p.recent) > 0 && p.recent[len(p.recent)-1].number > block {
+		p.recent = p.recent[:len(p.recent)-1]
+	}
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"sort"
+)
+
+// AddPublisherAfter Publishes again to pub the events of the committed blocks after a block, then adds pub to the
+// publishers of the parser. No block is committed in between, so pub gets every event after the block in order.
+// It is meant for a publisher that lost the events it had not delivered yet, for instance a broker outbox after
+// a restart, and returns the number of events replayed.
+func (p *EthereumParser) AddPublisherAfter(pub Publisher, after int) int {
+	p.syncLock.Lock()
+	defer p.syncLock.Unlock()
+
+	replayed := p.replay(after, pub)
+	p.AddPublisher(pub)
+	return replayed
+}
+
+// replay publishes to pub the events of the committed blocks after a block, as the parser published them when
+// processing those blocks: the transaction and token transfer events from the storage, the confirmation and status
+// events their successors brought, and a new head per block.
+//
+// Reorg events cannot be replayed, the storage no longer holds the transactions they removed. The confirmation
+// events follow the current confirmations and finality settings, and the new heads of the blocks without stored
+// transactions carry no hash.
+func (p *EthereumParser) replay(after int, pub Publisher) int {
+	checkpoint := p.storage.Checkpoint()
+	p.lock.Lock()
+	buried, finality := p.confirmations, p.finality
+	p.lock.Unlock()
+
+	transactions := make(map[int][]Event)
+	updates := make(map[int][]Event)
+	hashes := make(map[int]string)
+	for _, address := range Addresses(p.storage) {
+		for _, tx := range p.storage.GetTransactions(address) {
+			tx := tx
+			b := int(blockOf(tx))
+			if b > checkpoint {
+				continue
+			}
+			hashes[b] = tx.BlockHash
+			if b > after {
+				transactions[b] = append(transactions[b], Event{Type: EventTransaction, Address: address, Block: b, Transaction: &tx})
+				transactions[b] = append(transactions[b], transferEvents(address, b, &tx)...)
+			}
+			if finality == 0 {
+				continue
+			}
+
+			// the block where the transaction turns final, as long as it is still a recent one then
+			final := b + finality - buried - 1
+			if final < b {
+				final = b
+			}
+			for n := b; n <= final && n < b+reorgDepth && n <= checkpoint; n++ {
+				if n <= after || (n == b && n < final) {
+					continue
+				}
+				update := Event{Type: EventConfirmation, Address: address, Block: n, Transaction: &tx, Confirmations: n - b + buried + 1}
+				if n == final {
+					update.Type, update.Status = EventStatus, StatusConfirmed
+				}
+				updates[n] = append(updates[n], update)
+			}
+		}
+	}
+
+	replayed := 0
+	publish := func(e Event) {
+		pub.Publish(e)
+		replayed++
+	}
+	for n := after + 1; n <= checkpoint; n++ {
+		for _, e := range transactions[n] {
+			publish(e)
+		}
+		// the updates of the oldest transactions come first
+		sort.SliceStable(updates[n], func(i, j int) bool {
+			return blockOf(*updates[n][i].Transaction) < blockOf(*updates[n][j].Transaction)
+		})
+		for _, e := range updates[n] {
+			e.BlockHash = hashes[n]
+			publish(e)
+		}
+		publish(Event{Type: EventNewHead, Block: n, BlockHash: hashes[n]})
+	}
+	return replayed
+}
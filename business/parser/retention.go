@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy bounds the transaction history kept per address. A zero value disables the
+// corresponding limit, so the zero RetentionPolicy keeps everything.
+type RetentionPolicy struct {
+	// MaxAge drops transactions whose block is older than this duration.
+	MaxAge time.Duration
+
+	// MaxBlocks drops transactions more than this many blocks behind the checkpoint.
+	MaxBlocks int
+
+	// MaxPerAddress keeps only the most recent records of each address.
+	MaxPerAddress int
+}
+
+// Enabled reports whether the policy limits anything at all.
+func (rp RetentionPolicy) Enabled() bool {
+	return rp.MaxAge > 0 || rp.MaxBlocks > 0 || rp.MaxPerAddress > 0
+}
+
+// Expired reports whether a transaction falls outside the age or block window of the policy.
+// MaxPerAddress is applied by the storage on the records left after this check.
+func (rp RetentionPolicy) Expired(tx Transaction, checkpoint int, now time.Time) bool {
+	if rp.MaxAge > 0 && tx.Timestamp > 0 && now.Sub(time.Unix(tx.Timestamp, 0)) > rp.MaxAge {
+		return true
+	}
+	if rp.MaxBlocks > 0 && tx.BlockNumber != nil && tx.BlockNumber.Int64() <= int64(checkpoint-rp.MaxBlocks) {
+		return true
+	}
+
+	return false
+}
+
+// PruneStats reports the outcome of pruning a storage.
+type PruneStats struct {
+	Addresses int `json:"addresses"`
+	Removed   int `json:"removed"`
+}
+
+// PrunerMetrics are the cumulative figures of a Pruner since it was created.
+type PrunerMetrics struct {
+	Runs    int       `json:"runs"`
+	Removed int       `json:"removed"`
+	LastRun time.Time `json:"last_run"`
+}
+
+// Pruner periodically enforces a RetentionPolicy on a Storage
+type Pruner struct {
+	storage  Storage
+	policy   RetentionPolicy
+	interval time.Duration
+	Log      *zap.SugaredLogger
+
+	lock    sync.Mutex
+	metrics PrunerMetrics
+}
+
+// NewPruner creates a new Pruner instance
+func NewPruner(storage Storage, policy RetentionPolicy, interval time.Duration, logger *zap.SugaredLogger) *Pruner {
+	return &Pruner{
+		storage:  storage,
+		policy:   policy,
+		interval: interval,
+		Log:      logger,
+	}
+}
+
+// Run prunes the storage every interval until the context is cancelled
+func (pr *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(pr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pr.Prune()
+		}
+	}
+}
+
+// Prune runs a single pruning pass and records its stats
+func (pr *Pruner) Prune() PruneStats {
+	now := time.Now()
+	stats := pr.storage.Prune(pr.policy, now)
+
+	pr.lock.Lock()
+	pr.metrics.Runs++
+	pr.metrics.Removed += stats.Removed
+	pr.metrics.LastRun = now
+	pr.lock.Unlock()
+
+	if stats.Removed > 0 {
+		pr.Log.Infow("pruning", "addresses", stats.Addresses, "removed", stats.Removed)
+	}
+
+	return stats
+}
+
+// Metrics returns the cumulative pruning figures
+func (pr *Pruner) Metrics() PrunerMetrics {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	return pr.metrics
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Pinger is implemented by the storages that depend on an external system, such as a database, and can tell
+// whether it is reachable. Storages that do not implement it are always considered reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that a storage is reachable, through its Ping method when it implements Pinger.
+func Ping(ctx context.Context, s Storage) error {
+	if pinger, ok := as[Pinger](s); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Backfill is the progress of the parser catching up with the head of the node.
+type Backfill struct {
+	From    int `json:"from"`
+	To      int `json:"to"`
+	Current int `json:"current"`
+}
+
+// Progress returns the share of the backfill already processed, between 0 and 1.
+func (b Backfill) Progress() float64 {
+	if b.To <= b.From {
+		return 1
+	}
+	return float64(b.Current-b.From) / float64(b.To-b.From)
+}
+
+// SyncStatus describes how far the parser is in following the chain.
+type SyncStatus struct {
+	HeadBlock      int
+	ProcessedBlock int
+	Lag            int       // blocks left to process, not counting the ones still waiting for confirmations
+	LastPoll       time.Time // zero until a poll succeeded
+	Endpoint       string    // host of the Ethereum node
+	Backfill       *Backfill // nil unless the parser is catching up
+}
+
+// Status Gets the synchronisation status of the parser, as of its last poll
+func (p *EthereumParser) Status() SyncStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	status := SyncStatus{
+		HeadBlock:      p.headBlock,
+		ProcessedBlock: p.currentBlock,
+		LastPoll:       p.lastPoll,
+		Endpoint:       p.endpoint,
+	}
+	if confirmed := p.headBlock - p.confirmations; confirmed > p.currentBlock {
+		status.Lag = confirmed - p.currentBlock
+	}
+	if p.backfill != nil {
+		backfill := *p.backfill
+		status.Backfill = &backfill
+	}
+
+	return status
+}
+
+// Ping Checks that both the storage and the Ethereum node are reachable
+func (p *EthereumParser) Ping(ctx context.Context) error {
+	if err := Ping(ctx, p.storage); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	var head string
+	if err := p.callContext(ctx, "eth_blockNumber", []any{}, &head); err != nil {
+		return fmt.Errorf("ethereum node: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Token standards of a TokenTransfer.
+const (
+	StandardERC20   = "erc20"
+	StandardERC721  = "erc721"
+	StandardERC1155 = "erc1155"
+)
+
+// Topics of the events token contracts log for their transfers.
+const (
+	// topicTransfer is Transfer(address,address,uint256), logged by ERC-20 contracts with the amount as data and by
+	// ERC-721 contracts with the token ID as a fourth topic.
+	topicTransfer = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	// topicTransferSingle is TransferSingle(address,address,address,uint256,uint256) of ERC-1155 contracts.
+	topicTransferSingle = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+
+	// topicTransferBatch is TransferBatch(address,address,address,uint256[],uint256[]) of ERC-1155 contracts.
+	topicTransferBatch = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+// TokenTransfer is a transfer of fungible tokens or NFTs made by a transaction, as logged by the token contract.
+type TokenTransfer struct {
+	Token    string `json:"token"` // address of the token contract
+	Standard string `json:"standard"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`             // amount in the smallest unit of the token, 0x1 for ERC-721 tokens
+	TokenID  string `json:"tokenId,omitempty"` // ID of the NFT, none for ERC-20 tokens
+	LogIndex int    `json:"logIndex"`
+}
+
+// NFT reports whether the transfer moves a non-fungible, or ERC-1155, token.
+func (t TokenTransfer) NFT() bool {
+	return t.Standard != StandardERC20
+}
+
+// Involves reports whether an address sent or received the tokens.
+func (t TokenTransfer) Involves(address string) bool {
+	return t.From == address || t.To == address
+}
+
+// transferEvents returns the token transfer events of the transfers a transaction made from or to an address.
+func transferEvents(address string, block int, tx *Transaction) []Event {
+	var events []Event
+	for _, t := range tx.TransfersOf(address) {
+		t := t
+		events = append(events, Event{Type: EventTokenTransfer, Address: address, Block: block, Transaction: tx, Transfer: &t})
+	}
+	return events
+}
+
+// transactionEvents returns the transaction events among events.
+func transactionEvents(events []Event) []Event {
+	var transactions []Event
+	for _, e := range events {
+		if e.Type == EventTransaction {
+			transactions = append(transactions, e)
+		}
+	}
+	return transactions
+}
+
+// receiptLog is a log of a transaction receipt, as returned by the node.
+type receiptLog struct {
+	Address  string   `json:"address"`
+	Topics   []string `json:"topics"`
+	Data     string   `json:"data"`
+	LogIndex string   `json:"logIndex"`
+}
+
+// decodeTransfers returns the token transfers logged by a transaction, ignoring the logs of other events and the
+// ones that do not decode.
+func decodeTransfers(logs []receiptLog) []TokenTransfer {
+	var transfers []TokenTransfer
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		index, err := parseQuantity(l.LogIndex)
+		if err != nil {
+			continue
+		}
+		words := dataWords(l.Data)
+		t := TokenTransfer{Token: strings.ToLower(l.Address), LogIndex: index}
+
+		switch {
+		case l.Topics[0] == topicTransfer && len(l.Topics) == 3 && len(words) == 1:
+			t.Standard, t.From, t.To, t.Value = StandardERC20, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), hexWord(words[0])
+			transfers = append(transfers, t)
+		case l.Topics[0] == topicTransfer && len(l.Topics) == 4:
+			t.Standard, t.From, t.To, t.Value, t.TokenID = StandardERC721, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), "0x1", hexWord(l.Topics[3])
+			transfers = append(transfers, t)
+		case l.Topics[0] == topicTransferSingle && len(l.Topics) == 4 && len(words) == 2:
+			t.Standard, t.From, t.To, t.TokenID, t.Value = StandardERC1155, topicAddress(l.Topics[2]), topicAddress(l.Topics[3]), hexWord(words[0]), hexWord(words[1])
+			transfers = append(transfers, t)
+		case l.Topics[0] == topicTransferBatch && len(l.Topics) == 4:
+			ids, values, ok := batchArrays(words)
+			if !ok {
+				continue
+			}
+			t.Standard, t.From, t.To = StandardERC1155, topicAddress(l.Topics[2]), topicAddress(l.Topics[3])
+			for i := range ids {
+				t.TokenID, t.Value = ids[i], values[i]
+				transfers = append(transfers, t)
+			}
+		}
+	}
+	return transfers
+}
+
+// dataWords splits the data of a log into its 32 byte words, nil when it is not made of whole words.
+func dataWords(data string) []string {
+	data = strings.TrimPrefix(data, "0x")
+	if len(data)%64 != 0 {
+		return nil
+	}
+	words := make([]string, 0, len(data)/64)
+	for i := 0; i < len(data); i += 64 {
+		words = append(words, data[i:i+64])
+	}
+	return words
+}
+
+// batchArrays decodes the ABI encoded ids and values arrays of a TransferBatch event.
+func batchArrays(words []string) (ids, values []string, ok bool) {
+	// number reads a word holding an offset or a length, which cannot exceed the data
+	number := func(i int) (int, bool) {
+		n, ok := new(big.Int).SetString(words[i], 16)
+		if !ok || n.Cmp(big.NewInt(int64(len(words)*32))) > 0 {
+			return 0, false
+		}
+		return int(n.Int64()), true
+	}
+	array := func(i int) ([]string, bool) {
+		offset, ok := number(i)
+		if !ok || offset%32 != 0 || offset/32 >= len(words) {
+			return nil, false
+		}
+		at := offset / 32
+		n, ok := number(at)
+		if !ok || at+1+n > len(words) {
+			return nil, false
+		}
+		items := make([]string, n)
+		for j := range items {
+			items[j] = hexWord(words[at+1+j])
+		}
+		return items, true
+	}
+
+	if len(words) < 2 {
+		return nil, nil, false
+	}
+	ids, okIDs := array(0)
+	values, okValues := array(1)
+	return ids, values, okIDs && okValues && len(ids) == len(values)
+}
+
+// topicAddress returns the address held in the last 20 bytes of a topic.
+func topicAddress(topic string) string {
+	topic = strings.ToLower(strings.TrimPrefix(topic, "0x"))
+	if len(topic) < 40 {
+		return "0x" + topic
+	}
+	return "0x" + topic[len(topic)-40:]
+}
+
+// hexWord returns a 32 byte word as a hex quantity without leading zeros, like the node reports values.
+func hexWord(word string) string {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(word, "0x"), 16)
+	if !ok {
+		return "0x0"
+	}
+	return "0x" + n.Text(16)
+}
@@ -0,0 +1,126 @@
+// Package ratelimit provides token bucket rate limiters keyed by client, such as an API key or an IP address.
+//
+// Every key gets a bucket holding up to burst tokens, refilled at rate tokens per second. A request takes one
+// token, and is refused while the bucket is empty.
+//
+// Example usage:
+//
+//	limiter := ratelimit.New(10, 20)
+//	go limiter.Run(ctx, time.Minute)
+//
+//	if ok, retry := limiter.Allow(ip); !ok {
+//		// refuse the request, the next token comes in retry
+//	}
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter rate limits requests per key. It is safe for concurrent use.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket holds the tokens left to a key as of last.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter allowing rate requests per second per key, and bursts of up to burst requests.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Rate returns the requests allowed per second and key.
+func (l *Limiter) Rate() float64 {
+	return l.rate
+}
+
+// Burst returns the requests a key can make at once.
+func (l *Limiter) Burst() int {
+	return int(l.burst)
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it reports false, along with how long
+// until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b := l.refill(key)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Remaining returns the requests key can make right now.
+func (l *Limiter) Remaining(key string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int(l.refill(key).tokens)
+}
+
+// Run drops the buckets of the keys idle long enough to be full again every interval, until ctx is done, so
+// the limiter does not grow with every client ever seen.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.sweep()
+		}
+	}
+}
+
+// sweep drops the full buckets, which behave exactly like missing ones.
+func (l *Limiter) sweep() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for key := range l.buckets {
+		if l.refill(key).tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refill returns the bucket of key with the tokens earned since it was last used. The lock must be held.
+func (l *Limiter) refill(key string) *bucket {
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
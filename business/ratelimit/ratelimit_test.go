@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// Define a test of the token buckets
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("Allow refused request %d of the burst", i)
+		}
+	}
+	ok, retry := l.Allow("a")
+	if ok || retry != 500*time.Millisecond {
+		t.Fatalf("Allow returned %v, %v, expected a refusal for 500ms", ok, retry)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ = l.Allow("b"); !ok {
+		t.Errorf("Allow refused the first request of another key")
+	}
+
+	now = now.Add(time.Second)
+	if got := l.Remaining("a"); got != 2 {
+		t.Errorf("Remaining returned %d, expected 2 after a second", got)
+	}
+
+	// Buckets refilled to the burst are dropped
+	now = now.Add(time.Minute)
+	l.sweep()
+	if len(l.buckets) != 0 {
+		t.Errorf("sweep kept %d buckets, expected none", len(l.buckets))
+	}
+}
@@ -0,0 +1,206 @@
+// Package snapshot exports and restores the parser state held by a parser.Storage.
+//
+// A snapshot is a gzip compressed stream of newline delimited JSON records. The first record is a header carrying
+// the format version, the checkpoint and the last block each consumer of the events handled, followed by one
+// record per tenant subscription, one per history a tenant kept when unsubscribing and one per stored transaction,
+// along with the token and NFT transfers it made. Records are written and read one at a time, so snapshots of any
+// size can be streamed between instances or backends.
+//
+// Example usage:
+//
+//	// Dump a storage into a file
+//	f, _ := os.Create("parser.ndjson.gz")
+//	stats, err := snapshot.Export(f, store)
+//
+//	// Load it into an empty storage
+//	f, _ := os.Open("parser.ndjson.gz")
+//	stats, err := snapshot.Import(f, storage.NewMemoryStorage())
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// Version is the snapshot format version written by Export. Version 2 added the kept records, Import reads both.
+const Version = 2
+
+// Record types of a snapshot stream.
+const (
+	TypeHeader       = "header"
+	TypeSubscription = "subscription"
+	TypeKept         = "kept"
+	TypeTransaction  = "transaction"
+)
+
+// ErrNotEmpty is returned by Import when the target storage already holds a checkpoint.
+var ErrNotEmpty = errors.New("target storage is not empty")
+
+// Record is a single line of a snapshot.
+type Record struct {
+	Type        string              `json:"type"`
+	Version     int                 `json:"version,omitempty"`
+	Checkpoint  int                 `json:"checkpoint,omitempty"`
+	Positions   map[string]int      `json:"positions,omitempty"`
+	Block       int                 `json:"block,omitempty"`
+	CreatedAt   *time.Time          `json:"created_at,omitempty"`
+	Address     string              `json:"address,omitempty"`
+	Tenant      string              `json:"tenant,omitempty"`
+	Transaction *parser.Transaction `json:"transaction,omitempty"`
+}
+
+// Stats counts the records exported or imported.
+type Stats struct {
+	Checkpoint    int `json:"checkpoint"`
+	Subscriptions int `json:"subscriptions"`
+	Transactions  int `json:"transactions"`
+}
+
+// Export writes a snapshot of the subscriptions, checkpoint and transactions of the storage to w. The storage may
+// keep committing blocks meanwhile: the transactions of the blocks after the checkpoint it started from are left
+// out, for the parser to process them again once the snapshot is restored.
+func Export(w io.Writer, storage parser.Storage) (Stats, error) {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+
+	now := time.Now().UTC()
+	stats := Stats{Checkpoint: storage.Checkpoint()}
+	var positions map[string]int
+	if positioner, ok := storage.(parser.Positioner); ok {
+		positions = positioner.Positions()
+		for name, block := range positions {
+			if block > stats.Checkpoint {
+				positions[name] = stats.Checkpoint
+			}
+		}
+	}
+	if err := enc.Encode(Record{Type: TypeHeader, Version: Version, Checkpoint: stats.Checkpoint, Positions: positions, CreatedAt: &now}); err != nil {
+		return stats, fmt.Errorf("writing header: %w", err)
+	}
+
+	for _, address := range storage.Subscribers() {
+		for _, tenant := range storage.Owners(address) {
+			if err := enc.Encode(Record{Type: TypeSubscription, Address: address, Tenant: tenant}); err != nil {
+				return stats, fmt.Errorf("writing subscription %s: %w", address, err)
+			}
+			stats.Subscriptions++
+		}
+	}
+
+	// The history kept after an address was unsubscribed from is exported too, along with the tenants that kept it
+	for _, address := range parser.Addresses(storage) {
+		kept := parser.Kept(storage, address)
+		tenants := make([]string, 0, len(kept))
+		for tenant := range kept {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+		for _, tenant := range tenants {
+			block := kept[tenant]
+			if block > stats.Checkpoint {
+				block = stats.Checkpoint
+			}
+			if err := enc.Encode(Record{Type: TypeKept, Address: address, Tenant: tenant, Block: block}); err != nil {
+				return stats, fmt.Errorf("writing kept history %s: %w", address, err)
+			}
+		}
+
+		for _, tx := range storage.GetTransactions(address) {
+			tx := tx
+			if tx.BlockNumber != nil && tx.BlockNumber.Int64() > int64(stats.Checkpoint) {
+				continue
+			}
+			if err := enc.Encode(Record{Type: TypeTransaction, Address: address, Transaction: &tx}); err != nil {
+				return stats, fmt.Errorf("writing transaction %s: %w", tx.Hash, err)
+			}
+			stats.Transactions++
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return stats, fmt.Errorf("closing snapshot: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Import loads a snapshot read from r into an empty storage. The checkpoint is committed last, so an
+// interrupted import leaves the storage without a checkpoint and the parser never skips blocks over it.
+func Import(r io.Reader, storage parser.Storage) (Stats, error) {
+	var stats Stats
+	if storage.Checkpoint() != 0 {
+		return stats, ErrNotEmpty
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(zr))
+
+	var header Record
+	if err = dec.Decode(&header); err != nil {
+		return stats, fmt.Errorf("reading header: %w", err)
+	}
+	if header.Type != TypeHeader {
+		return stats, fmt.Errorf("unexpected first record %q", header.Type)
+	}
+	if header.Version < 1 || header.Version > Version {
+		return stats, fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	for {
+		var rec Record
+		err = dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("reading record: %w", err)
+		}
+
+		switch rec.Type {
+		case TypeSubscription:
+			// Snapshots taken before subscriptions had owners give them all to the default tenant
+			if rec.Tenant == "" {
+				rec.Tenant = parser.DefaultTenant
+			}
+			storage.Subscribe(rec.Tenant, rec.Address)
+			stats.Subscriptions++
+		case TypeKept:
+			if rec.Tenant == "" || rec.Block <= 0 {
+				return stats, fmt.Errorf("kept record for %s has no tenant or block", rec.Address)
+			}
+			parser.Keep(storage, rec.Tenant, rec.Address, rec.Block)
+		case TypeTransaction:
+			if rec.Transaction == nil {
+				return stats, fmt.Errorf("transaction record for %s has no transaction", rec.Address)
+			}
+			storage.AddTransaction(rec.Address, *rec.Transaction)
+			stats.Transactions++
+		default:
+			return stats, fmt.Errorf("unknown record type %q", rec.Type)
+		}
+	}
+
+	for name, block := range header.Positions {
+		parser.SetPosition(storage, name, block)
+	}
+	if header.Checkpoint > 0 {
+		if err = storage.CommitBlock(header.Checkpoint, nil); err != nil {
+			return stats, fmt.Errorf("restoring checkpoint: %w", err)
+		}
+	}
+	stats.Checkpoint = header.Checkpoint
+
+	return stats, nil
+}
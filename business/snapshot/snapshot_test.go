@@ -0,0 +1,104 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"trustwallet/business/parser"
+	"trustwallet/business/storage"
+)
+
+// Define a test for a snapshot round trip between two storages
+func TestExportImport(t *testing.T) {
+	src := storage.NewMemoryStorage()
+	src.Subscribe("acme", "0x123")
+	src.Subscribe("globex", "0x123")
+	src.Subscribe(parser.DefaultTenant, "0x456")
+	tx := parser.Transaction{Hash: "0xaaa", From: "0x123", To: "0x789", Value: "0x1", BlockNumber: big.NewInt(7), Timestamp: 1700000000, Transfers: []parser.TokenTransfer{
+		{Token: "0xc0", Standard: parser.StandardERC20, From: "0x123", To: "0x789", Value: "0x64", LogIndex: 0},
+		{Token: "0xc1", Standard: parser.StandardERC721, From: "0x789", To: "0x123", Value: "0x1", TokenID: "0x7", LogIndex: 1},
+	}}
+	src.Subscribe("initech", "0x123")
+	if err := src.CommitBlock(7, map[string][]parser.Transaction{"0x123": {tx}}); err != nil {
+		t.Fatalf("CommitBlock returned error: %v", err)
+	}
+	src.Unsubscribe("initech", "0x123", false)
+	src.SetPosition("broker", 6)
+
+	var buf bytes.Buffer
+	exported, err := Export(&buf, src)
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+
+	dst := storage.NewMemoryStorage()
+	imported, err := Import(bytes.NewReader(buf.Bytes()), dst)
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+
+	expected := Stats{Checkpoint: 7, Subscriptions: 3, Transactions: 1}
+	if exported != expected || imported != expected {
+		t.Errorf("Export returned %+v and Import returned %+v, expected %+v", exported, imported, expected)
+	}
+	if got := dst.Checkpoint(); got != 7 {
+		t.Errorf("Checkpoint returned %d, expected 7", got)
+	}
+	if got := len(dst.Subscribers()); got != 2 {
+		t.Errorf("Subscribers returned %d addresses, expected 2", got)
+	}
+	if got := dst.Owners("0x123"); !reflect.DeepEqual(got, []string{"acme", "globex"}) {
+		t.Errorf("Owners returned %v, expected [acme globex]", got)
+	}
+	if got := dst.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{tx}) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, []parser.Transaction{tx})
+	}
+	if got := dst.Kept("0x123"); !reflect.DeepEqual(got, map[string]int{"initech": 7}) {
+		t.Errorf("Kept returned %v, expected map[initech:7]", got)
+	}
+	if got := dst.Positions(); !reflect.DeepEqual(got, map[string]int{"broker": 6}) {
+		t.Errorf("Positions returned %v, expected map[broker:6]", got)
+	}
+
+	// A storage that already has a checkpoint must be refused
+	if _, err = Import(bytes.NewReader(buf.Bytes()), dst); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Import returned %v, expected %v", err, ErrNotEmpty)
+	}
+}
+
+// Define a test of the transactions a snapshot keeps or leaves out
+func TestExportConsistency(t *testing.T) {
+	src := storage.NewMemoryStorage()
+	src.Subscribe("acme", "0x123")
+	src.Subscribe("acme", "0x456")
+	kept := parser.Transaction{Hash: "0xaaa", From: "0x456", To: "0x789", Value: "0x1", BlockNumber: big.NewInt(5)}
+	committed := parser.Transaction{Hash: "0xbbb", From: "0x123", To: "0x789", Value: "0x1", BlockNumber: big.NewInt(7)}
+	src.CommitBlock(5, map[string][]parser.Transaction{"0x456": {kept}})
+	src.CommitBlock(7, map[string][]parser.Transaction{"0x123": {committed}})
+
+	// The history of 0x456 is kept after its last tenant left, and a block after the checkpoint is being stored
+	src.Unsubscribe("acme", "0x456", false)
+	src.AddTransaction("0x123", parser.Transaction{Hash: "0xccc", From: "0x123", To: "0x789", Value: "0x1", BlockNumber: big.NewInt(8)})
+
+	var buf bytes.Buffer
+	if _, err := Export(&buf, src); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	dst := storage.NewMemoryStorage()
+	imported, err := Import(bytes.NewReader(buf.Bytes()), dst)
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+
+	if expected := (Stats{Checkpoint: 7, Subscriptions: 1, Transactions: 2}); imported != expected {
+		t.Errorf("Import returned %+v, expected %+v", imported, expected)
+	}
+	if got := dst.GetTransactions("0x456"); !reflect.DeepEqual(got, []parser.Transaction{kept}) {
+		t.Errorf("GetTransactions returned %+v for the unsubscribed address, expected %+v", got, []parser.Transaction{kept})
+	}
+	if got := dst.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{committed}) {
+		t.Errorf("GetTransactions returned %+v, expected only the transaction up to the checkpoint", got)
+	}
+}
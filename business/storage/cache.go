@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// CacheStats are the cumulative figures of a CachedStorage.
+type CacheStats struct {
+	Hits         int `json:"hits"`
+	Misses       int `json:"misses"`
+	Evictions    int `json:"evictions"`
+	Entries      int `json:"entries"`
+	Transactions int `json:"transactions"`
+}
+
+// CachedStorage is a read-through decorator keeping the transactions of the most recently queried addresses
+// in an LRU cache in front of any parser.Storage. The cache is bounded by the transactions it holds in total, so
+// busy addresses take the room of many quiet ones, and a history larger than the whole cache is never cached.
+// Writes go straight to the wrapped storage and drop the cached entries they affect.
+//
+// Whole histories are cached rather than the pages the API serves: parser.Storage only reads the history of an
+// address as a whole, and the pages are cut from it by the parser, so a cache of pages would have to live above the
+// storage and know every filter. Caching the history serves all the pages and filters of an address from one entry.
+type CachedStorage struct {
+	parser.Storage
+
+	lock       sync.Mutex
+	size       int // transactions held at most
+	cached     int // transactions held
+	entries    map[string]*list.Element
+	order      *list.List
+	generation int
+	stats      CacheStats
+}
+
+// cacheEntry is the value of an element of the LRU list.
+type cacheEntry struct {
+	address string
+	txs     []parser.Transaction
+}
+
+// NewCachedStorage wraps a storage with a cache of up to size transactions.
+func NewCachedStorage(backend parser.Storage, size int) *CachedStorage {
+	return &CachedStorage{
+		Storage: backend,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Unwrap returns the wrapped storage, so the optional interfaces it lacks are not taken for granted.
+func (cs *CachedStorage) Unwrap() parser.Storage {
+	return cs.Storage
+}
+
+func (cs *CachedStorage) Ping(ctx context.Context) error {
+	return parser.Ping(ctx, cs.Storage)
+}
+
+func (cs *CachedStorage) Addresses() []string {
+	return parser.Addresses(cs.Storage)
+}
+
+func (cs *CachedStorage) Keep(tenant, address string, block int) {
+	parser.Keep(cs.Storage, tenant, address, block)
+}
+
+func (cs *CachedStorage) Kept(address string) map[string]int {
+	return parser.Kept(cs.Storage, address)
+}
+
+func (cs *CachedStorage) SetPosition(name string, block int) {
+	parser.SetPosition(cs.Storage, name, block)
+}
+
+func (cs *CachedStorage) Positions() map[string]int {
+	if positioner, ok := cs.Storage.(parser.Positioner); ok {
+		return positioner.Positions()
+	}
+	return nil
+}
+
+func (cs *CachedStorage) GetTransactions(address string) []parser.Transaction {
+	cs.lock.Lock()
+	if el, ok := cs.entries[address]; ok {
+		cs.order.MoveToFront(el)
+		cs.stats.Hits++
+		txs := el.Value.(*cacheEntry).txs
+		cs.lock.Unlock()
+		return copyTransactions(txs)
+	}
+	cs.stats.Misses++
+	generation := cs.generation
+	cs.lock.Unlock()
+
+	txs := cs.Storage.GetTransactions(address)
+
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	// A write that happened during the read may have made txs stale, so only cache it if none did
+	if generation == cs.generation {
+		cs.add(address, copyTransactions(txs))
+	}
+	return txs
+}
+
+func (cs *CachedStorage) Unsubscribe(tenant, address string, purge bool) bool {
+	ok := cs.Storage.Unsubscribe(tenant, address, purge)
+	if purge {
+		cs.invalidate(address)
+	}
+	return ok
+}
+
+func (cs *CachedStorage) AddTransaction(address string, tx parser.Transaction) {
+	cs.Storage.AddTransaction(address, tx)
+	cs.invalidate(address)
+}
+
+func (cs *CachedStorage) CommitBlock(block int, txs map[string][]parser.Transaction) error {
+	err := cs.Storage.CommitBlock(block, txs)
+
+	addresses := make([]string, 0, len(txs))
+	for address := range txs {
+		addresses = append(addresses, address)
+	}
+	cs.invalidate(addresses...)
+
+	return err
+}
+
+func (cs *CachedStorage) Prune(policy parser.RetentionPolicy, now time.Time) parser.PruneStats {
+	stats := cs.Storage.Prune(policy, now)
+	if stats.Removed > 0 {
+		cs.Purge()
+	}
+	return stats
+}
+
+func (cs *CachedStorage) Backfill(address string, txs []parser.Transaction) error {
+	indexer, err := parser.AsIndexer(cs.Storage)
+	if err != nil {
+		return err
+	}
+	err = indexer.Backfill(address, txs)
+	cs.invalidate(address)
+	return err
+}
+
+func (cs *CachedStorage) Rewind(block int) error {
+	indexer, err := parser.AsIndexer(cs.Storage)
+	if err != nil {
+		return err
+	}
+	err = indexer.Rewind(block)
+	cs.Purge()
+	return err
+}
+
+// Purge empties the cache.
+func (cs *CachedStorage) Purge() {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.generation++
+	cs.entries = make(map[string]*list.Element)
+	cs.order.Init()
+	cs.cached = 0
+}
+
+// Stats returns the cumulative hit, miss and eviction counts of the cache.
+func (cs *CachedStorage) Stats() CacheStats {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	stats := cs.stats
+	stats.Entries = cs.order.Len()
+	stats.Transactions = cs.cached
+	return stats
+}
+
+// invalidate drops the cached entries of the given addresses.
+func (cs *CachedStorage) invalidate(addresses ...string) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.generation++
+	for _, address := range addresses {
+		cs.remove(address)
+	}
+}
+
+// remove drops the cached entry of an address, if any. The caller must hold the lock.
+func (cs *CachedStorage) remove(address string) {
+	if el, ok := cs.entries[address]; ok {
+		cs.order.Remove(el)
+		delete(cs.entries, address)
+		cs.cached -= weight(el.Value.(*cacheEntry).txs)
+	}
+}
+
+// add caches the transactions of an address, evicting the least recently used entries over capacity.
+// The caller must hold the lock.
+func (cs *CachedStorage) add(address string, txs []parser.Transaction) {
+	cs.remove(address)
+	if cs.size <= 0 || weight(txs) > cs.size {
+		return
+	}
+	cs.entries[address] = cs.order.PushFront(&cacheEntry{address: address, txs: txs})
+	cs.cached += weight(txs)
+	for cs.cached > cs.size {
+		oldest := cs.order.Back().Value.(*cacheEntry)
+		cs.remove(oldest.address)
+		cs.stats.Evictions++
+	}
+}
+
+// weight is the room an entry takes in the cache, at least one so that empty histories are bounded too.
+func weight(txs []parser.Transaction) int {
+	if len(txs) == 0 {
+		return 1
+	}
+	return len(txs)
+}
+
+// copyTransactions returns a copy of txs that callers may keep regardless of later cache changes.
+func copyTransactions(txs []parser.Transaction) []parser.Transaction {
+	if txs == nil {
+		return nil
+	}
+	return append([]parser.Transaction(nil), txs...)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// Define a test for the CachedStorage hit, miss, invalidation and eviction behaviour
+func TestCachedStorage(t *testing.T) {
+	cache := NewCachedStorage(NewMemoryStorage(), 2)
+
+	tx1 := parser.Transaction{Hash: "0x1", From: "0x123"}
+	tx2 := parser.Transaction{Hash: "0x2", From: "0x123"}
+	cache.AddTransaction("0x123", tx1)
+
+	cache.GetTransactions("0x123")
+	if got := cache.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{tx1}) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, []parser.Transaction{tx1})
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Stats returned %+v, expected 1 hit and 1 miss", stats)
+	}
+
+	// Committing a block for the address must drop its cached entry
+	if err := cache.CommitBlock(1, map[string][]parser.Transaction{"0x123": {tx2}}); err != nil {
+		t.Fatalf("CommitBlock returned error: %v", err)
+	}
+	if got := cache.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{tx1, tx2}) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, []parser.Transaction{tx1, tx2})
+	}
+
+	// Reading a third address evicts the least recently used one
+	cache.GetTransactions("0x456")
+	cache.GetTransactions("0x789")
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Stats returned %+v, expected 1 eviction and 2 entries", stats)
+	}
+
+	// Pruning anything empties the cache
+	cache.Prune(parser.RetentionPolicy{MaxPerAddress: 1}, time.Now())
+	if got := cache.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{tx2}) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, []parser.Transaction{tx2})
+	}
+}
+
+// Define a test of the cache bounded by the transactions it holds rather than by addresses
+func TestCachedStorageBound(t *testing.T) {
+	cache := NewCachedStorage(NewMemoryStorage(), 3)
+	for i := 0; i < 4; i++ {
+		cache.AddTransaction("0xbusy", parser.Transaction{Hash: fmt.Sprintf("0x%d", i), From: "0xbusy"})
+	}
+	cache.AddTransaction("0xa", parser.Transaction{Hash: "0xa1", From: "0xa"})
+	cache.AddTransaction("0xb", parser.Transaction{Hash: "0xb1", From: "0xb"})
+	cache.AddTransaction("0xb", parser.Transaction{Hash: "0xb2", From: "0xb"})
+
+	// A history larger than the whole cache is read through every time
+	cache.GetTransactions("0xbusy")
+	if got := len(cache.GetTransactions("0xbusy")); got != 4 {
+		t.Errorf("GetTransactions returned %d transactions, expected 4", got)
+	}
+	if stats := cache.Stats(); stats.Hits != 0 || stats.Entries != 0 {
+		t.Errorf("Stats returned %+v, expected the busy address never cached", stats)
+	}
+
+	// Caching 0xb after 0xa takes 3 transactions, an empty history one more, which evicts 0xa
+	cache.GetTransactions("0xa")
+	cache.GetTransactions("0xb")
+	cache.GetTransactions("0xnone")
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 || stats.Transactions != 3 {
+		t.Errorf("Stats returned %+v, expected 1 eviction, 2 entries and 3 transactions", stats)
+	}
+}
+
+// plainStorage hides the optional interfaces of the storage it embeds, leaving only parser.Storage.
+type plainStorage struct {
+	parser.Storage
+}
+
+// Define a test of the wrappers serving the optional interfaces only when the wrapped storage implements them
+func TestWrappedInterfaces(t *testing.T) {
+	plain := NewInstrumentedStorage(NewCachedStorage(plainStorage{NewMemoryStorage()}, 10))
+	if parser.Keep(plain, "tenant", "0x123", 1) {
+		t.Errorf("Keep reported true over a storage without Keeper")
+	}
+	if parser.SetPosition(plain, "broker", 1) {
+		t.Errorf("SetPosition reported true over a storage without Positioner")
+	}
+	if _, err := parser.AsIndexer(plain); !errors.Is(err, parser.ErrIndexUnsupported) {
+		t.Errorf("AsIndexer returned %v, expected %v", err, parser.ErrIndexUnsupported)
+	}
+
+	full := NewInstrumentedStorage(NewCachedStorage(NewMemoryStorage(), 10))
+	if !parser.Keep(full, "tenant", "0x123", 1) {
+		t.Errorf("Keep reported false over a storage with Keeper")
+	}
+	if !parser.SetPosition(full, "broker", 1) {
+		t.Errorf("SetPosition reported false over a storage with Positioner")
+	}
+	if block, ok := parser.Position(full, "broker"); !ok || block != 1 {
+		t.Errorf("Position returned %d, %v, expected 1, true", block, ok)
+	}
+	if _, err := parser.AsIndexer(full); err != nil {
+		t.Errorf("AsIndexer returned error: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"time"
+	"trustwallet/business/metrics"
+	"trustwallet/business/parser"
+)
+
+// InstrumentedStorage is a decorator recording the latency of every operation of any parser.Storage in the
+// storage_operation_duration_seconds metric, labelled by method name.
+type InstrumentedStorage struct {
+	backend parser.Storage
+}
+
+// NewInstrumentedStorage wraps a storage so its operations are measured.
+func NewInstrumentedStorage(backend parser.Storage) *InstrumentedStorage {
+	return &InstrumentedStorage{backend: backend}
+}
+
+// Unwrap returns the wrapped storage, so the optional interfaces it lacks are not taken for granted.
+func (is *InstrumentedStorage) Unwrap() parser.Storage {
+	return is.backend
+}
+
+func (is *InstrumentedStorage) Subscribe(tenant, address string) bool {
+	defer observe("Subscribe", time.Now())
+	return is.backend.Subscribe(tenant, address)
+}
+
+func (is *InstrumentedStorage) Unsubscribe(tenant, address string, purge bool) bool {
+	defer observe("Unsubscribe", time.Now())
+	return is.backend.Unsubscribe(tenant, address, purge)
+}
+
+func (is *InstrumentedStorage) Subscribers() []string {
+	defer observe("Subscribers", time.Now())
+	return is.backend.Subscribers()
+}
+
+func (is *InstrumentedStorage) Subscriptions(tenant string) []string {
+	defer observe("Subscriptions", time.Now())
+	return is.backend.Subscriptions(tenant)
+}
+
+func (is *InstrumentedStorage) Addresses() []string {
+	defer observe("Addresses", time.Now())
+	return parser.Addresses(is.backend)
+}
+
+func (is *InstrumentedStorage) Keep(tenant, address string, block int) {
+	defer observe("Keep", time.Now())
+	parser.Keep(is.backend, tenant, address, block)
+}
+
+func (is *InstrumentedStorage) Kept(address string) map[string]int {
+	defer observe("Kept", time.Now())
+	return parser.Kept(is.backend, address)
+}
+
+func (is *InstrumentedStorage) SetPosition(name string, block int) {
+	defer observe("SetPosition", time.Now())
+	parser.SetPosition(is.backend, name, block)
+}
+
+func (is *InstrumentedStorage) Positions() map[string]int {
+	defer observe("Positions", time.Now())
+	if positioner, ok := is.backend.(parser.Positioner); ok {
+		return positioner.Positions()
+	}
+	return nil
+}
+
+func (is *InstrumentedStorage) Owners(address string) []string {
+	defer observe("Owners", time.Now())
+	return is.backend.Owners(address)
+}
+
+func (is *InstrumentedStorage) AddTransaction(address string, tx parser.Transaction) {
+	defer observe("AddTransaction", time.Now())
+	is.backend.AddTransaction(address, tx)
+}
+
+func (is *InstrumentedStorage) GetTransactions(address string) []parser.Transaction {
+	defer observe("GetTransactions", time.Now())
+	return is.backend.GetTransactions(address)
+}
+
+func (is *InstrumentedStorage) Prune(policy parser.RetentionPolicy, now time.Time) parser.PruneStats {
+	defer observe("Prune", time.Now())
+	return is.backend.Prune(policy, now)
+}
+
+func (is *InstrumentedStorage) CommitBlock(block int, txs map[string][]parser.Transaction) error {
+	defer observe("CommitBlock", time.Now())
+	return is.backend.CommitBlock(block, txs)
+}
+
+func (is *InstrumentedStorage) Checkpoint() int {
+	defer observe("Checkpoint", time.Now())
+	return is.backend.Checkpoint()
+}
+
+func (is *InstrumentedStorage) Backfill(address string, txs []parser.Transaction) error {
+	indexer, err := parser.AsIndexer(is.backend)
+	if err != nil {
+		return err
+	}
+	defer observe("Backfill", time.Now())
+	return indexer.Backfill(address, txs)
+}
+
+func (is *InstrumentedStorage) Rewind(block int) error {
+	indexer, err := parser.AsIndexer(is.backend)
+	if err != nil {
+		return err
+	}
+	defer observe("Rewind", time.Now())
+	return indexer.Rewind(block)
+}
+
+func (is *InstrumentedStorage) Ping(ctx context.Context) error {
+	return parser.Ping(ctx, is.backend)
+}
+
+// observe records the duration of an operation started at start.
+func observe(operation string, start time.Time) {
+	metrics.StorageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
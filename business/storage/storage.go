@@ -10,7 +10,7 @@
 //	storage := NewMemoryStorage()
 //
 //	// Subscribe to an Ethereum address
-//	storage.Subscribe("0x123abc")
+//	storage.Subscribe(parser.DefaultTenant, "0x123abc")
 //
 //	// Add a transaction to the storage
 //	tx := Transaction{From: "0x456def", To: "0x123abc", Value: 1.23}
@@ -22,43 +22,158 @@
 package storage
 
 import (
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 	"trustwallet/business/parser"
 )
 
 // MemoryStorage is a simple in-memory storage for storing subscribed addresses and transactions.
+// All methods are safe for concurrent use and return copies of the stored data.
 type MemoryStorage struct {
 	sync.RWMutex
-	subscriptions map[string]bool
+	subscriptions map[string]map[string]bool // tenants subscribed to each address
+	kept          map[string]map[string]int  // tenants that kept the history of each address, up to a block
+	positions     map[string]int             // last block each consumer of the events handled
 	transactions  map[string][]parser.Transaction
+	checkpoint    int
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		subscriptions: make(map[string]bool),
+		subscriptions: make(map[string]map[string]bool),
+		kept:          make(map[string]map[string]int),
+		positions:     make(map[string]int),
 		transactions:  make(map[string][]parser.Transaction),
 	}
 }
 
-func (ms *MemoryStorage) Subscribe(address string) bool {
+func (ms *MemoryStorage) Subscribe(tenant, address string) bool {
 	ms.Lock()
 	defer ms.Unlock()
-	if _, ok := ms.subscriptions[address]; ok {
+	if ms.subscriptions[address][tenant] {
 		return false
 	}
-	ms.subscriptions[address] = true
+	if ms.subscriptions[address] == nil {
+		ms.subscriptions[address] = make(map[string]bool)
+	}
+	ms.subscriptions[address][tenant] = true
+	ms.unkeep(tenant, address)
 	return true
 }
 
+// Unsubscribe removes the subscription of a tenant. Unless purge is set, the tenant keeps reading the transactions
+// stored up to the checkpoint; purging also drops a history the tenant kept before. The transactions are only
+// deleted once no tenant follows the address nor kept them.
+func (ms *MemoryStorage) Unsubscribe(tenant, address string, purge bool) bool {
+	ms.Lock()
+	defer ms.Unlock()
+	ok := ms.subscriptions[address][tenant]
+	delete(ms.subscriptions[address], tenant)
+	if purge {
+		_, kept := ms.kept[address][tenant]
+		ok = ok || kept
+		ms.unkeep(tenant, address)
+	} else if ok && ms.checkpoint > 0 {
+		ms.keep(tenant, address, ms.checkpoint)
+	}
+	if len(ms.subscriptions[address]) > 0 {
+		// Other tenants still follow the address and read its transactions
+		return ok
+	}
+	delete(ms.subscriptions, address)
+	if purge && len(ms.kept[address]) == 0 {
+		delete(ms.transactions, address)
+	}
+	return ok
+}
+
+// Keep lets a tenant read the transactions of an address up to a block.
+func (ms *MemoryStorage) Keep(tenant, address string, block int) {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.keep(tenant, address, block)
+}
+
+// Kept returns the tenants that kept the history of an address, with the last block each of them may read.
+func (ms *MemoryStorage) Kept(address string) map[string]int {
+	ms.RLock()
+	defer ms.RUnlock()
+	if len(ms.kept[address]) == 0 {
+		return nil
+	}
+	kept := make(map[string]int, len(ms.kept[address]))
+	for tenant, block := range ms.kept[address] {
+		kept[tenant] = block
+	}
+	return kept
+}
+
+func (ms *MemoryStorage) keep(tenant, address string, block int) {
+	if ms.kept[address] == nil {
+		ms.kept[address] = make(map[string]int)
+	}
+	ms.kept[address][tenant] = block
+}
+
+func (ms *MemoryStorage) unkeep(tenant, address string) {
+	delete(ms.kept[address], tenant)
+	if len(ms.kept[address]) == 0 {
+		delete(ms.kept, address)
+	}
+}
+
 func (ms *MemoryStorage) Subscribers() []string {
-	addresses := make([]string, 0)
-	for addr, _ := range ms.subscriptions {
+	ms.RLock()
+	defer ms.RUnlock()
+	addresses := make([]string, 0, len(ms.subscriptions))
+	for addr := range ms.subscriptions {
+		addresses = append(addresses, addr)
+	}
+
+	return addresses
+}
+
+// Addresses returns every address with stored transactions, subscribed or not.
+func (ms *MemoryStorage) Addresses() []string {
+	ms.RLock()
+	defer ms.RUnlock()
+	addresses := make([]string, 0, len(ms.transactions))
+	for addr := range ms.transactions {
 		addresses = append(addresses, addr)
 	}
+	sort.Strings(addresses)
 
 	return addresses
 }
 
+func (ms *MemoryStorage) Subscriptions(tenant string) []string {
+	ms.RLock()
+	defer ms.RUnlock()
+	addresses := make([]string, 0)
+	for addr, tenants := range ms.subscriptions {
+		if tenants[tenant] {
+			addresses = append(addresses, addr)
+		}
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+func (ms *MemoryStorage) Owners(address string) []string {
+	ms.RLock()
+	defer ms.RUnlock()
+	tenants := make([]string, 0, len(ms.subscriptions[address]))
+	for tenant := range ms.subscriptions[address] {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	return tenants
+}
+
 func (ms *MemoryStorage) AddTransaction(address string, tx parser.Transaction) {
 	ms.Lock()
 	defer ms.Unlock()
@@ -68,5 +183,141 @@ func (ms *MemoryStorage) AddTransaction(address string, tx parser.Transaction) {
 func (ms *MemoryStorage) GetTransactions(address string) []parser.Transaction {
 	ms.RLock()
 	defer ms.RUnlock()
-	return ms.transactions[address]
+	if ms.transactions[address] == nil {
+		return nil
+	}
+	return append([]parser.Transaction(nil), ms.transactions[address]...)
+}
+
+// CommitBlock stores the transactions matched in a block and advances the checkpoint under a single lock,
+// so readers either see the whole block or none of it.
+func (ms *MemoryStorage) CommitBlock(block int, txs map[string][]parser.Transaction) error {
+	ms.Lock()
+	defer ms.Unlock()
+	if block <= ms.checkpoint {
+		return fmt.Errorf("block %d, checkpoint %d: %w", block, ms.checkpoint, parser.ErrBlockCommitted)
+	}
+	for address, list := range txs {
+		ms.transactions[address] = append(ms.transactions[address], list...)
+	}
+	ms.checkpoint = block
+	return nil
+}
+
+func (ms *MemoryStorage) Checkpoint() int {
+	ms.RLock()
+	defer ms.RUnlock()
+	return ms.checkpoint
+}
+
+// SetPosition records the last block a consumer of the events handled.
+func (ms *MemoryStorage) SetPosition(name string, block int) {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.positions[name] = block
+}
+
+// Positions returns the last block each consumer of the events handled.
+func (ms *MemoryStorage) Positions() map[string]int {
+	ms.RLock()
+	defer ms.RUnlock()
+	positions := make(map[string]int, len(ms.positions))
+	for name, block := range ms.positions {
+		positions[name] = block
+	}
+	return positions
+}
+
+// Backfill merges transactions of past blocks into those of an address, keeping them ordered by block and
+// skipping the ones already stored.
+func (ms *MemoryStorage) Backfill(address string, txs []parser.Transaction) error {
+	ms.Lock()
+	defer ms.Unlock()
+	stored := make(map[string]bool, len(ms.transactions[address]))
+	for _, tx := range ms.transactions[address] {
+		stored[parser.CursorOf(tx)] = true
+	}
+
+	merged := ms.transactions[address]
+	for _, tx := range txs {
+		if number := blockOf(tx); number > int64(ms.checkpoint) {
+			return fmt.Errorf("block %d is after the checkpoint %d", number, ms.checkpoint)
+		}
+		if !stored[parser.CursorOf(tx)] {
+			stored[parser.CursorOf(tx)] = true
+			merged = append(merged, tx)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return blockOf(merged[i]) < blockOf(merged[j])
+	})
+	ms.transactions[address] = merged
+	return nil
+}
+
+// Rewind drops the transactions of the blocks after block and moves the checkpoint back to it.
+func (ms *MemoryStorage) Rewind(block int) error {
+	ms.Lock()
+	defer ms.Unlock()
+	if block > ms.checkpoint {
+		return fmt.Errorf("block %d is after the checkpoint %d", block, ms.checkpoint)
+	}
+	for address, txs := range ms.transactions {
+		kept := make([]parser.Transaction, 0, len(txs))
+		for _, tx := range txs {
+			if blockOf(tx) <= int64(block) {
+				kept = append(kept, tx)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ms.transactions, address)
+			continue
+		}
+		ms.transactions[address] = kept
+	}
+	ms.checkpoint = block
+	return nil
+}
+
+// Prune drops the transactions outside the retention policy.
+func (ms *MemoryStorage) Prune(policy parser.RetentionPolicy, now time.Time) parser.PruneStats {
+	var stats parser.PruneStats
+	if !policy.Enabled() {
+		return stats
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+	for address, txs := range ms.transactions {
+		kept := make([]parser.Transaction, 0, len(txs))
+		for _, tx := range txs {
+			if !policy.Expired(tx, ms.checkpoint, now) {
+				kept = append(kept, tx)
+			}
+		}
+		if policy.MaxPerAddress > 0 && len(kept) > policy.MaxPerAddress {
+			kept = kept[len(kept)-policy.MaxPerAddress:]
+		}
+
+		removed := len(txs) - len(kept)
+		if removed == 0 {
+			continue
+		}
+		stats.Addresses++
+		stats.Removed += removed
+		if len(kept) == 0 {
+			delete(ms.transactions, address)
+			continue
+		}
+		ms.transactions[address] = kept
+	}
+	return stats
+}
+
+// blockOf returns the number of the block a transaction was mined in, 0 when unknown.
+func blockOf(tx parser.Transaction) int64 {
+	if tx.BlockNumber == nil {
+		return 0
+	}
+	return tx.BlockNumber.Int64()
 }
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"math/big"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 	"trustwallet/business/parser"
 )
 
@@ -63,3 +68,233 @@ func TestGetTransactions(t *testing.T) {
 		t.Errorf("GetTransactions returned %+v, expected %+v", transactions, expectedTransactions)
 	}
 }
+
+// Define a test for the CommitBlock method
+func TestCommitBlock(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	tx := parser.Transaction{Hash: "0xaaa", From: "0x123", To: "0x456", Value: "0x1"}
+	if err := storage.CommitBlock(10, map[string][]parser.Transaction{"0x123": {tx}}); err != nil {
+		t.Fatalf("CommitBlock returned error: %v", err)
+	}
+	if got := storage.Checkpoint(); got != 10 {
+		t.Errorf("Checkpoint returned %d, expected 10", got)
+	}
+
+	// Replaying the same block must not duplicate its transactions
+	err := storage.CommitBlock(10, map[string][]parser.Transaction{"0x123": {tx}})
+	if !errors.Is(err, parser.ErrBlockCommitted) {
+		t.Errorf("CommitBlock returned %v, expected %v", err, parser.ErrBlockCommitted)
+	}
+	if got := storage.GetTransactions("0x123"); !reflect.DeepEqual(got, []parser.Transaction{tx}) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, []parser.Transaction{tx})
+	}
+}
+
+// Define a test for the Prune method
+func TestPrune(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	now := time.Unix(1700000000, 0)
+	txs := make([]parser.Transaction, 0, 5)
+	for i := 1; i <= 5; i++ {
+		txs = append(txs, parser.Transaction{
+			Hash:        fmt.Sprintf("0x%d", i),
+			BlockNumber: big.NewInt(int64(i)),
+			Timestamp:   now.Add(time.Duration(i-5) * time.Hour).Unix(),
+		})
+	}
+	if err := storage.CommitBlock(5, map[string][]parser.Transaction{"0x123": txs}); err != nil {
+		t.Fatalf("CommitBlock returned error: %v", err)
+	}
+
+	// Block 1 is too old by age, then only the last two records of the address survive
+	stats := storage.Prune(parser.RetentionPolicy{MaxAge: 3*time.Hour + time.Minute, MaxPerAddress: 2}, now)
+	if stats.Removed != 3 || stats.Addresses != 1 {
+		t.Errorf("Prune returned %+v, expected 3 removed from 1 address", stats)
+	}
+	if got := storage.GetTransactions("0x123"); !reflect.DeepEqual(got, txs[3:]) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, txs[3:])
+	}
+
+	// Only block 5 is within the last block
+	stats = storage.Prune(parser.RetentionPolicy{MaxBlocks: 1}, now)
+	if stats.Removed != 1 {
+		t.Errorf("Prune removed %d transactions, expected 1", stats.Removed)
+	}
+}
+
+// Define a stress test hammering the storage from concurrent goroutines, meant to run under -race
+func TestConcurrentAccess(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	const workers, blocks = 8, 200
+	var wg sync.WaitGroup
+
+	// Ingest: a single writer commits blocks in order, like the poller
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for block := 1; block <= blocks; block++ {
+			tx := parser.Transaction{Hash: fmt.Sprintf("0x%x", block), BlockNumber: big.NewInt(int64(block))}
+			if err := storage.CommitBlock(block, map[string][]parser.Transaction{"0x123": {tx}}); err != nil {
+				t.Errorf("CommitBlock returned error: %v", err)
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < blocks; i++ {
+				storage.Subscribe(parser.DefaultTenant, fmt.Sprintf("0x%d-%d", w, i))
+				storage.AddTransaction(fmt.Sprintf("0x%d", w), parser.Transaction{Hash: fmt.Sprintf("0x%d", i)})
+
+				// A snapshot of the address never holds more records than the committed blocks
+				checkpoint := storage.Checkpoint()
+				if got := len(storage.GetTransactions("0x123")); got < checkpoint {
+					t.Errorf("GetTransactions returned %d records after checkpoint %d", got, checkpoint)
+				}
+				storage.Subscribers()
+				storage.Prune(parser.RetentionPolicy{MaxPerAddress: blocks}, time.Now())
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	if got := len(storage.GetTransactions("0x123")); got != blocks {
+		t.Errorf("GetTransactions returned %d records, expected %d", got, blocks)
+	}
+	if got := len(storage.Subscribers()); got != workers*blocks {
+		t.Errorf("Subscribers returned %d addresses, expected %d", got, workers*blocks)
+	}
+}
+
+// Define a test for the Unsubscribe method
+func TestUnsubscribe(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.Subscribe(parser.DefaultTenant, "0x123")
+	storage.Subscribe(parser.DefaultTenant, "0x456")
+	storage.AddTransaction("0x123", parser.Transaction{Hash: "0x1"})
+	storage.AddTransaction("0x456", parser.Transaction{Hash: "0x2"})
+
+	if !storage.Unsubscribe(parser.DefaultTenant, "0x123", false) || len(storage.GetTransactions("0x123")) != 1 {
+		t.Errorf("Unsubscribe without purge should drop the subscription and keep the transactions")
+	}
+	if !storage.Unsubscribe(parser.DefaultTenant, "0x456", true) || storage.GetTransactions("0x456") != nil {
+		t.Errorf("Unsubscribe with purge should drop the subscription and the transactions")
+	}
+	if storage.Unsubscribe(parser.DefaultTenant, "0x123", false) {
+		t.Errorf("Unsubscribe returned true for an address that is not subscribed")
+	}
+	if got := storage.Subscribers(); len(got) != 0 {
+		t.Errorf("Subscribers returned %v, expected none", got)
+	}
+}
+
+// Define a test of subscriptions shared by several tenants
+func TestTenantSubscriptions(t *testing.T) {
+	storage := NewMemoryStorage()
+	if !storage.Subscribe("acme", "0x123") || !storage.Subscribe("globex", "0x123") || storage.Subscribe("acme", "0x123") {
+		t.Fatalf("Subscribe should report only the first subscription of each tenant")
+	}
+	storage.Subscribe("acme", "0x456")
+	storage.AddTransaction("0x123", parser.Transaction{Hash: "0x1"})
+
+	if got := storage.Subscriptions("acme"); !reflect.DeepEqual(got, []string{"0x123", "0x456"}) {
+		t.Errorf("Subscriptions returned %v, expected [0x123 0x456]", got)
+	}
+	if got := storage.Owners("0x123"); !reflect.DeepEqual(got, []string{"acme", "globex"}) {
+		t.Errorf("Owners returned %v, expected [acme globex]", got)
+	}
+
+	// The address stays watched, with its transactions, while another tenant follows it
+	if !storage.Unsubscribe("acme", "0x123", true) || len(storage.GetTransactions("0x123")) != 1 {
+		t.Errorf("Unsubscribe purged the transactions another tenant still reads")
+	}
+	if got := storage.Subscriptions("globex"); !reflect.DeepEqual(got, []string{"0x123"}) {
+		t.Errorf("Subscriptions returned %v, expected [0x123]", got)
+	}
+	if !storage.Unsubscribe("globex", "0x123", true) || storage.GetTransactions("0x123") != nil {
+		t.Errorf("Unsubscribe of the last tenant should purge the transactions")
+	}
+	if got := storage.Subscribers(); !reflect.DeepEqual(got, []string{"0x456"}) {
+		t.Errorf("Subscribers returned %v, expected [0x456]", got)
+	}
+}
+
+// Define a test of the history tenants keep when unsubscribing
+func TestKeptHistory(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.Subscribe("acme", "0x123")
+	storage.Subscribe("globex", "0x123")
+	storage.CommitBlock(7, map[string][]parser.Transaction{"0x123": {{Hash: "0x1"}}})
+
+	if !storage.Unsubscribe("acme", "0x123", false) {
+		t.Errorf("Unsubscribe returned false for a subscribed address")
+	}
+	if got := storage.Kept("0x123"); !reflect.DeepEqual(got, map[string]int{"acme": 7}) {
+		t.Errorf("Kept returned %v, expected map[acme:7]", got)
+	}
+
+	// The last subscriber purging leaves the history acme kept
+	storage.CommitBlock(8, map[string][]parser.Transaction{"0x123": {{Hash: "0x2"}}})
+	if !storage.Unsubscribe("globex", "0x123", true) || len(storage.GetTransactions("0x123")) != 2 {
+		t.Errorf("Unsubscribe purged the transactions another tenant kept")
+	}
+	if got := storage.Kept("0x123"); !reflect.DeepEqual(got, map[string]int{"acme": 7}) {
+		t.Errorf("Kept returned %v, expected map[acme:7]", got)
+	}
+
+	// Subscribing again drops the mark, and purging a kept history deletes it once nobody else reads it
+	storage.Subscribe("globex", "0x123")
+	storage.Unsubscribe("globex", "0x123", false)
+	storage.Subscribe("globex", "0x123")
+	if got := storage.Kept("0x123"); !reflect.DeepEqual(got, map[string]int{"acme": 7}) {
+		t.Errorf("Kept returned %v, expected map[acme:7]", got)
+	}
+	storage.Unsubscribe("globex", "0x123", true)
+	if !storage.Unsubscribe("acme", "0x123", true) || storage.GetTransactions("0x123") != nil || storage.Kept("0x123") != nil {
+		t.Errorf("Unsubscribe with purge should drop the kept history and the transactions")
+	}
+}
+
+// Define a test for the Backfill and Rewind methods
+func TestBackfillRewind(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	tx := func(hash string, block int64) parser.Transaction {
+		return parser.Transaction{Hash: hash, From: "0x123", To: "0x456", Value: "0x1", BlockNumber: big.NewInt(block)}
+	}
+	storage.CommitBlock(5, map[string][]parser.Transaction{"0x123": {tx("0xa", 5)}})
+	storage.CommitBlock(9, map[string][]parser.Transaction{"0x123": {tx("0xc", 9)}})
+
+	// Backfilled transactions are merged in block order, once
+	if err := storage.Backfill("0x123", []parser.Transaction{tx("0xb", 7), tx("0xa", 5)}); err != nil {
+		t.Fatalf("Backfill returned error: %v", err)
+	}
+	expected := []parser.Transaction{tx("0xa", 5), tx("0xb", 7), tx("0xc", 9)}
+	if got := storage.GetTransactions("0x123"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, expected)
+	}
+	if err := storage.Backfill("0x123", []parser.Transaction{tx("0xd", 10)}); err == nil {
+		t.Errorf("Backfill accepted a block after the checkpoint")
+	}
+
+	if err := storage.Rewind(6); err != nil {
+		t.Fatalf("Rewind returned error: %v", err)
+	}
+	if got := storage.Checkpoint(); got != 6 {
+		t.Errorf("Checkpoint returned %d, expected 6", got)
+	}
+	expected = []parser.Transaction{tx("0xa", 5)}
+	if got := storage.GetTransactions("0x123"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetTransactions returned %+v, expected %+v", got, expected)
+	}
+	if err := storage.Rewind(8); err == nil {
+		t.Errorf("Rewind accepted a block after the checkpoint")
+	}
+}
@@ -0,0 +1,65 @@
+// Package tracing sets up the OpenTelemetry tracer of the service and provides the helpers the other packages
+// record their spans with.
+//
+// The tracer is the global one, so any package can start spans without threading a handle around. Until Setup
+// is called it discards every span.
+//
+// Example usage:
+//
+//	exporter, err := otlptracehttp.New(ctx)
+//	provider := tracing.Setup(tracing.Config{ServiceName: "eth-parser", SampleRatio: 1}, exporter)
+//	defer provider.Shutdown(ctx)
+//
+//	ctx, span := tracing.Tracer().Start(ctx, "parser.processBlock")
+//	defer span.End()
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer of the service.
+const instrumentation = "trustwallet"
+
+// Config holds the settings of the tracer provider.
+type Config struct {
+	ServiceName string
+
+	// SampleRatio is the share of the traces started by the service that are recorded, between 0 and 1. Traces
+	// started upstream follow the sampling decision of their parent.
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider exporting the spans in batches, along with the W3C trace context
+// propagator. The caller shuts the provider down on exit, which flushes the spans still buffered.
+func Setup(cfg Config, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider
+}
+
+// Tracer returns the tracer of the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// End ends a span, marking it failed when err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
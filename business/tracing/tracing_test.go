@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+	"trustwallet/business/logger"
+)
+
+// Define a test of the spans exported by the provider and of the trace IDs added to the logs
+func TestSetup(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := Setup(Config{ServiceName: "test", SampleRatio: 1}, exporter)
+	defer provider.Shutdown(context.Background())
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	_, child := Tracer().Start(ctx, "child")
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	core, logs := observer.New(zap.InfoLevel)
+	logger.WithTrace(ctx, zap.New(core).Sugar()).Infow("traced")
+	logger.WithTrace(context.Background(), zap.New(core).Sugar()).Infow("untraced")
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush returned error: %v", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, expected 2", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("exported %q under %v, expected child under the parent span", spans[0].Name, spans[0].Parent.SpanID())
+	}
+	if spans[0].Status.Code != codes.Error || len(spans[0].Events) != 1 {
+		t.Errorf("child span has status %v and %d events, expected the recorded error", spans[0].Status.Code, len(spans[0].Events))
+	}
+	if spans[1].Status.Code != codes.Unset {
+		t.Errorf("parent span has status %v, expected it unset", spans[1].Status.Code)
+	}
+
+	entries := logs.All()
+	if got := entries[0].ContextMap()["trace_id"]; got != spans[1].SpanContext.TraceID().String() {
+		t.Errorf("logged trace_id %v, expected %v", got, spans[1].SpanContext.TraceID())
+	}
+	if _, ok := entries[1].ContextMap()["trace_id"]; ok {
+		t.Errorf("logged a trace_id without a span")
+	}
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"encoding/csv"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Media types the API answers with.
+const (
+	MediaJSON = "application/json"
+	MediaCSV  = "text/csv"
+)
+
+// Negotiate returns the offered media type the client prefers according to its Accept header. It falls back on
+// the first offer when the header is absent or accepts none of them, rather than answering 406.
+func Negotiate(r *http.Request, offers ...string) string {
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(r.Header.Values("Accept"), offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the weight the Accept header values give to a media type, taken from the most specific
+// range matching it, 0 when none does.
+func acceptQuality(accept []string, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			accepted, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			s := -1
+			switch {
+			case accepted == mediaType:
+				s = 2
+			case accepted == typ+"/*":
+				s = 1
+			case accepted == "*/*":
+				s = 0
+			}
+			if s <= specificity {
+				continue
+			}
+
+			specificity, q = s, 1
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					q = 0
+				}
+			}
+		}
+	}
+	return q
+}
+
+// RespondCSV writes a header row and the rows of a table as a CSV body.
+func RespondCSV(w http.ResponseWriter, status int, header []string, rows [][]string) error {
+	w.Header().Set("Content-Type", MediaCSV+"; charset=utf-8")
+	w.WriteHeader(status)
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
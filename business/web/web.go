@@ -0,0 +1,132 @@
+// Package web writes the responses of the HTTP API: JSON bodies with their content type, and failures as a
+// single error envelope carrying a stable code clients can branch on and the ID of the request.
+//
+// Handlers return typed errors rather than writing status lines themselves:
+//
+//	if address == "unknown" {
+//		web.RespondError(w, r, web.ErrInvalidAddress)
+//		return
+//	}
+//	web.Respond(w, http.StatusOK, resp)
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Stable codes of the error envelope. Messages may be reworded, codes may not.
+const (
+	CodeInvalidAddress    = "invalid_address"
+	CodeInvalidParameter  = "invalid_parameter"
+	CodeInvalidBody       = "invalid_body"
+	CodeUnauthorized      = "unauthorized"
+	CodeNotFound          = "not_found"
+	CodeNotSubscribed     = "not_subscribed"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeRateLimited       = "rate_limited"
+	CodeSubscriptionLimit = "subscription_limit"
+	CodeWebhookLimit      = "webhook_limit"
+	CodeInternal          = "internal"
+)
+
+// Error is a failure of a request, as reported to the client.
+type Error struct {
+	Status  int    // HTTP status of the response
+	Code    string // one of the Code constants
+	Message string // human readable, safe to show to the client
+	Field   string // the offending parameter or body field, if any
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errors shared by several endpoints.
+var (
+	ErrInvalidAddress    = &Error{Status: http.StatusBadRequest, Code: CodeInvalidAddress, Message: "address is invalid", Field: "address"}
+	ErrNotSubscribed     = &Error{Status: http.StatusNotFound, Code: CodeNotSubscribed, Message: "address is not subscribed"}
+	ErrMethodNotAllowed  = &Error{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Message: "method not allowed"}
+	ErrRateLimited       = &Error{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Message: "rate limit exceeded"}
+	ErrSubscriptionLimit = &Error{Status: http.StatusTooManyRequests, Code: CodeSubscriptionLimit, Message: "subscription limit reached"}
+	ErrWebhookLimit      = &Error{Status: http.StatusTooManyRequests, Code: CodeWebhookLimit, Message: "webhook limit reached"}
+	ErrInternal          = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error"}
+)
+
+// InvalidParameter reports a query or path parameter that could not be parsed.
+func InvalidParameter(name string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidParameter, Message: name + " is invalid", Field: name}
+}
+
+// InvalidBody reports a request body that could not be decoded or was rejected, with the reason as message.
+func InvalidBody(message string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: message}
+}
+
+// Unauthorized reports a request without valid credentials.
+func Unauthorized(message string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+// NotFound reports a resource that does not exist, or that the tenant may not see.
+func NotFound(resource string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: resource + " not found"}
+}
+
+// ErrorResponse is the body of every failed request.
+type ErrorResponse struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Respond writes data as the JSON body of the response. Nothing is written when data cannot be marshalled, so
+// the caller can still answer an error.
+func Respond(w http.ResponseWriter, status int, data any) error {
+	output, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", MediaJSON+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(output)
+	return nil
+}
+
+// RespondError writes the error envelope of err. Errors other than *Error are answered as internal errors, so
+// their message never reaches the client.
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrInternal
+	}
+
+	Respond(w, apiErr.Status, ErrorResponse{
+		Status:    apiErr.Status,
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		Field:     apiErr.Field,
+		RequestID: RequestID(r.Context()),
+	})
+}
+
+// RequestIDHeader carries the ID of a request, both ways.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of its request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, empty outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
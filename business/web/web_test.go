@@ -0,0 +1,65 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Define a test of the error envelope
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorResponse
+	}{
+		{"typed", InvalidParameter("limit"), ErrorResponse{Status: 400, Code: CodeInvalidParameter, Message: "limit is invalid", Field: "limit", RequestID: "req-1"}},
+		{"wrapped", errors.Join(errors.New("context"), ErrNotSubscribed), ErrorResponse{Status: 404, Code: CodeNotSubscribed, Message: "address is not subscribed", RequestID: "req-1"}},
+		{"untyped", errors.New("connection refused to https://node/secret"), ErrorResponse{Status: 500, Code: CodeInternal, Message: "internal error", RequestID: "req-1"}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(WithRequestID(r.Context(), "req-1"))
+		w := httptest.NewRecorder()
+		RespondError(w, r, tt.err)
+
+		var got ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decoding the envelope: %v", tt.name, err)
+		}
+		if got != tt.want || w.Code != tt.want.Status {
+			t.Errorf("%s: RespondError wrote %d %+v, expected %+v", tt.name, w.Code, got, tt.want)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s: RespondError set Content-Type %q, expected application/json", tt.name, ct)
+		}
+	}
+}
+
+// Define a test of the content negotiation
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", MediaJSON},
+		{"*/*", MediaJSON},
+		{"text/csv", MediaCSV},
+		{"text/*", MediaCSV},
+		{"application/json, text/csv", MediaJSON},
+		{"application/json;q=0.5, text/csv", MediaCSV},
+		{"text/csv;q=0, */*", MediaJSON},
+		{"image/png", MediaJSON},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := Negotiate(r, MediaJSON, MediaCSV); got != tt.want {
+			t.Errorf("Negotiate(%q) returned %q, expected %q", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+// Package webhook delivers the activity of subscribed addresses to HTTP endpoints registered by clients.
+//
+// Every delivery is a JSON payload signed with HMAC-SHA256 using the secret of the webhook. Failed deliveries are
+// retried with exponential backoff, and the ones that still fail after the last attempt land in a dead-letter
+// queue. Every attempt is recorded in a bounded delivery log.
+//
+// Receivers check the X-Webhook-Signature header, computed over the X-Webhook-Timestamp header, a dot and the
+// raw body:
+//
+//	ok := webhook.Verify(secret, r.Header.Get("X-Webhook-Timestamp"), body, r.Header.Get("X-Webhook-Signature"))
+//
+// Example usage:
+//
+//	// Create a dispatcher and feed it from the parser
+//	dispatcher := webhook.NewDispatcher(webhook.Config{Workers: 4, Subscriptions: ethereumParser}, log)
+//	go dispatcher.Run(ctx)
+//	ethereumParser.AddPublisher(dispatcher)
+//
+//	// Register a webhook for an address
+//	hook, err := dispatcher.Register("0x123abc", "https://example.com/hooks/eth", "")
+//
+// Webhooks can only reach public addresses: Register rejects URLs whose host resolves to a loopback, private,
+// link-local or carrier-grade NAT address, and the delivery client checks the address again when it dials, so a
+// host cannot be rebound to an internal one after registration.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrInvalidURL is returned by Register for URLs that are not absolute http or https URLs.
+var ErrInvalidURL = errors.New("invalid webhook url")
+
+// ErrPrivateURL is returned by Register, and by deliveries, for URLs whose host resolves to a loopback, private,
+// link-local or carrier-grade NAT address.
+var ErrPrivateURL = errors.New("webhook url resolves to a private address")
+
+// ErrWebhookLimit is returned by Register when a tenant already has as many webhooks as it is allowed to.
+var ErrWebhookLimit = errors.New("webhook limit reached")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which reaches the internal networks of some
+// clouds and ISPs rather than the internet.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// Config tunes a Dispatcher. Zero values take the defaults noted on each field.
+type Config struct {
+	Workers     int           // concurrent deliveries, 4 by default
+	QueueSize   int           // pending deliveries, 1000 by default
+	MaxAttempts int           // attempts before dead-lettering, 5 by default
+	BaseBackoff time.Duration // delay before the first retry, doubled on each one, 1s by default
+	Timeout     time.Duration // timeout of a single attempt, 10s by default
+	LogSize     int           // deliveries remembered per webhook, 100 by default
+	DeadLetters int           // dead letters remembered, 1000 by default
+	MaxWebhooks int           // webhooks a tenant may register, 100 by default
+
+	// LookupIP resolves the host of a webhook at registration, net.DefaultResolver by default
+	LookupIP func(ctx context.Context, host string) ([]net.IPAddr, error)
+	// Subscriptions skips the webhooks of tenants no longer subscribed to the address, every webhook is delivered
+	// when nil
+	Subscriptions parser.Subscriptions
+	// AllowPrivate lets webhooks reach loopback, private and link-local addresses, for tests only
+	AllowPrivate bool
+}
+
+// Webhook is an endpoint receiving the activity of an address.
+type Webhook struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Address   string    `json:"address"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string       `json:"id"`
+	WebhookID string       `json:"webhook_id"`
+	Event     parser.Event `json:"event"`
+}
+
+// Delivery records one attempt at delivering an event to a webhook.
+type Delivery struct {
+	WebhookID  string    `json:"webhook_id"`
+	EventID    string    `json:"event_id"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Succeeded  bool      `json:"succeeded"`
+	At         time.Time `json:"at"`
+}
+
+// DeadLetter is an event that could not be delivered to a webhook.
+type DeadLetter struct {
+	WebhookID string       `json:"webhook_id"`
+	Tenant    string       `json:"tenant"`
+	Address   string       `json:"address"`
+	Event     parser.Event `json:"event"`
+	Attempts  int          `json:"attempts"`
+	Error     string       `json:"error"`
+	At        time.Time    `json:"at"`
+}
+
+// job is a pending delivery.
+type job struct {
+	hook    Webhook
+	event   parser.Event
+	attempt int
+}
+
+// Dispatcher keeps the registered webhooks and delivers the published events to them.
+type Dispatcher struct {
+	cfg    Config
+	client *http.Client
+	queue  chan job
+	Log    *zap.SugaredLogger
+
+	lock       sync.RWMutex
+	hooks      map[string]Webhook
+	deliveries map[string][]Delivery
+	dead       []DeadLetter
+}
+
+// NewDispatcher creates a new Dispatcher instance
+func NewDispatcher(cfg Config, logger *zap.SugaredLogger) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.LogSize <= 0 {
+		cfg.LogSize = 100
+	}
+	if cfg.DeadLetters <= 0 {
+		cfg.DeadLetters = 1000
+	}
+	if cfg.MaxWebhooks <= 0 {
+		cfg.MaxWebhooks = 100
+	}
+	if cfg.LookupIP == nil {
+		cfg.LookupIP = net.DefaultResolver.LookupIPAddr
+	}
+
+	// No proxy, so the dialer sees the address of the receiver itself, redirects included
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = dialControl
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		queue:      make(chan job, cfg.QueueSize),
+		Log:        logger,
+		hooks:      make(map[string]Webhook),
+		deliveries: make(map[string][]Delivery),
+	}
+}
+
+// Register adds a webhook of a tenant for an address. A random secret is generated when none is given. The
+// returned Webhook is the only one carrying the secret. URLs whose host resolves to a loopback, private,
+// link-local or carrier-grade NAT address are rejected with ErrPrivateURL, and tenants with MaxWebhooks webhooks
+// already get ErrWebhookLimit.
+func (d *Dispatcher) Register(tenant, address, rawURL, secret string) (Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, ErrInvalidURL
+	}
+	if err = d.checkHost(u.Hostname()); err != nil {
+		return Webhook{}, err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	hook := Webhook{ID: id, Tenant: tenant, Address: address, URL: u.String(), Secret: secret, CreatedAt: time.Now().UTC()}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	registered := 0
+	for _, h := range d.hooks {
+		if h.Tenant == tenant {
+			registered++
+		}
+	}
+	if registered >= d.cfg.MaxWebhooks {
+		return Webhook{}, ErrWebhookLimit
+	}
+	d.hooks[id] = hook
+
+	return hook, nil
+}
+
+// checkHost rejects hosts that do not resolve, or resolve to any address a webhook must not reach.
+func (d *Dispatcher) checkHost(host string) error {
+	if d.cfg.AllowPrivate {
+		return nil
+	}
+
+	ips := []net.IPAddr{{IP: net.ParseIP(host)}}
+	if ips[0].IP == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+		defer cancel()
+		var err error
+		if ips, err = d.cfg.LookupIP(ctx, host); err != nil || len(ips) == 0 {
+			return fmt.Errorf("%w: %s does not resolve", ErrInvalidURL, host)
+		}
+	}
+
+	for _, ip := range ips {
+		if !public(ip.IP) {
+			return ErrPrivateURL
+		}
+	}
+	return nil
+}
+
+// Remove deletes a webhook a tenant registered for an address, along with its delivery log. It reports whether
+// it existed.
+func (d *Dispatcher) Remove(tenant, address, id string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if hook, ok := d.hooks[id]; !ok || hook.Tenant != tenant || hook.Address != address {
+		return false
+	}
+	delete(d.hooks, id)
+	delete(d.deliveries, id)
+	return true
+}
+
+// Webhooks lists the webhooks a tenant registered for an address, without their secrets.
+func (d *Dispatcher) Webhooks(tenant, address string) []Webhook {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	hooks := make([]Webhook, 0)
+	for _, hook := range d.hooks {
+		if hook.Tenant == tenant && hook.Address == address {
+			hook.Secret = ""
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// Deliveries returns the delivery log of a webhook a tenant registered for an address, oldest first, and whether
+// the webhook exists.
+func (d *Dispatcher) Deliveries(tenant, address, id string) ([]Delivery, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if hook, ok := d.hooks[id]; !ok || hook.Tenant != tenant || hook.Address != address {
+		return nil, false
+	}
+	return append([]Delivery{}, d.deliveries[id]...), true
+}
+
+// DeadLetters returns the events that could not be delivered to the webhooks a tenant registered for an
+// address, oldest first.
+func (d *Dispatcher) DeadLetters(tenant, address string) []DeadLetter {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	dead := make([]DeadLetter, 0)
+	for _, letter := range d.dead {
+		if letter.Tenant == tenant && letter.Address == address {
+			dead = append(dead, letter)
+		}
+	}
+	return dead
+}
+
+// Publish queues the delivery of an event to every webhook of its address whose tenant is still subscribed to
+// it. It never blocks: when the queue is full the delivery goes straight to the dead-letter queue.
+func (d *Dispatcher) Publish(e parser.Event) {
+	if e.Address == "" {
+		return
+	}
+
+	d.lock.RLock()
+	var hooks []Webhook
+	for _, hook := range d.hooks {
+		if hook.Address == e.Address && d.subscribed(hook.Tenant, hook.Address) {
+			hooks = append(hooks, hook)
+		}
+	}
+	d.lock.RUnlock()
+
+	for _, hook := range hooks {
+		d.enqueue(job{hook: hook, event: e, attempt: 1})
+	}
+}
+
+// subscribed reports whether a tenant may still receive the activity of an address.
+func (d *Dispatcher) subscribed(tenant, address string) bool {
+	return d.cfg.Subscriptions == nil || d.cfg.Subscriptions.IsSubscribed(tenant, address)
+}
+
+// Run delivers the queued events with the configured number of workers until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver makes one attempt at a delivery and schedules a retry, or dead-letters it, on failure.
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	status, err := d.post(ctx, j)
+
+	delivery := Delivery{
+		WebhookID:  j.hook.ID,
+		EventID:    j.event.Key(),
+		Attempt:    j.attempt,
+		StatusCode: status,
+		Succeeded:  err == nil,
+		At:         time.Now().UTC(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if !d.record(delivery) || err == nil {
+		return
+	}
+
+	if j.attempt >= d.cfg.MaxAttempts {
+		d.deadLetter(j, err)
+		return
+	}
+
+	backoff := d.cfg.BaseBackoff << (j.attempt - 1)
+	d.Log.Infow("webhook", "status", "retrying", "webhook", j.hook.ID, "event", delivery.EventID, "attempt", j.attempt, "backoff", backoff, "error", err)
+
+	j.attempt++
+	time.AfterFunc(backoff, func() {
+		d.enqueue(j)
+	})
+}
+
+// post sends the signed payload of a job and returns the response status code.
+func (d *Dispatcher) post(ctx context.Context, j job) (int, error) {
+	body, err := json.Marshal(Payload{ID: j.event.Key(), WebhookID: j.hook.ID, Event: j.event})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, j.hook.ID)
+	req.Header.Set(HeaderEventID, j.event.Key())
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(j.hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// enqueue queues a job without blocking, dead-lettering it when the queue is full.
+func (d *Dispatcher) enqueue(j job) {
+	select {
+	case d.queue <- j:
+	default:
+		d.deadLetter(j, errors.New("delivery queue is full"))
+	}
+}
+
+// record appends a delivery to the log of its webhook. It reports false when the webhook was removed meanwhile.
+func (d *Dispatcher) record(delivery Delivery) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.hooks[delivery.WebhookID]; !ok {
+		return false
+	}
+	log := append(d.deliveries[delivery.WebhookID], delivery)
+	if len(log) > d.cfg.LogSize {
+		log = log[len(log)-d.cfg.LogSize:]
+	}
+	d.deliveries[delivery.WebhookID] = log
+	return true
+}
+
+// deadLetter moves a job that cannot be delivered to the dead-letter queue.
+func (d *Dispatcher) deadLetter(j job, err error) {
+	d.Log.Errorw("webhook", "status", "dead letter", "webhook", j.hook.ID, "event", j.event.Key(), "attempts", j.attempt, "error", err)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.dead = append(d.dead, DeadLetter{
+		WebhookID: j.hook.ID,
+		Tenant:    j.hook.Tenant,
+		Address:   j.hook.Address,
+		Event:     j.event,
+		Attempts:  j.attempt,
+		Error:     err.Error(),
+		At:        time.Now().UTC(),
+	})
+	if len(d.dead) > d.cfg.DeadLetters {
+		d.dead = d.dead[len(d.dead)-d.cfg.DeadLetters:]
+	}
+}
+
+// dialControl refuses connections to addresses a webhook must not reach, whatever its host resolved to.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !public(ip) {
+		return ErrPrivateURL
+	}
+	return nil
+}
+
+// public reports whether an address is neither unspecified, loopback, private, link-local, carrier-grade NAT nor
+// multicast. The link-local range holds the metadata endpoint of most clouds, 169.254.169.254.
+func public(ip net.IP) bool {
+	return !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// Sign computes the signature of a delivery body sent at the given unix timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a signature matches a delivery body sent at the given unix timestamp.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// randomHex returns n random bytes hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
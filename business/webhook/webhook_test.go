@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"trustwallet/business/parser"
+)
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Define a test for a signed delivery to a local receiver
+func TestDeliver(t *testing.T) {
+	received := make(chan Payload, 1)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p Payload
+		json.Unmarshal(body, &p)
+		received <- p
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDispatcher(Config{Workers: 1, AllowPrivate: true}, zap.NewNop().Sugar())
+	go d.Run(ctx)
+
+	hook, err := d.Register("acme", "0x123", receiver.URL, "")
+	if err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	secret = hook.Secret
+
+	e := parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 7, Transaction: &parser.Transaction{Hash: "0xaaa"}}
+	d.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x456", Block: 7})
+	d.Publish(e)
+
+	select {
+	case p := <-received:
+		if p.ID != e.Key() || p.WebhookID != hook.ID || p.Event.Transaction.Hash != "0xaaa" {
+			t.Errorf("received %+v, expected the event of 0x123", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the receiver got no delivery")
+	}
+
+	waitFor(t, func() bool {
+		log, _ := d.Deliveries("acme", "0x123", hook.ID)
+		return len(log) == 1 && log[0].Succeeded
+	})
+	if hooks := d.Webhooks("acme", "0x123"); len(hooks) != 1 || hooks[0].Secret != "" {
+		t.Errorf("Webhooks returned %+v, expected one webhook without its secret", hooks)
+	}
+	if hooks := d.Webhooks("globex", "0x123"); len(hooks) != 0 {
+		t.Errorf("Webhooks returned %+v to another tenant, expected none", hooks)
+	}
+
+	if _, err = d.Register("acme", "0x123", "ftp://example.com", ""); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Register returned %v, expected %v", err, ErrInvalidURL)
+	}
+}
+
+// Define a test for the retries and dead-lettering of a failing receiver
+func TestRetryDeadLetter(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDispatcher(Config{Workers: 1, MaxAttempts: 3, BaseBackoff: time.Millisecond, AllowPrivate: true}, zap.NewNop().Sugar())
+	go d.Run(ctx)
+
+	hook, err := d.Register("acme", "0x123", receiver.URL, "secret")
+	if err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	d.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 7})
+
+	waitFor(t, func() bool { return len(d.DeadLetters("acme", "0x123")) == 1 })
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("receiver got %d attempts, expected 3", got)
+	}
+	log, _ := d.Deliveries("acme", "0x123", hook.ID)
+	if len(log) != 3 || log[2].StatusCode != http.StatusServiceUnavailable || log[2].Succeeded {
+		t.Errorf("Deliveries returned %+v, expected 3 failed attempts", log)
+	}
+}
+
+// Define a test for the webhooks pointing at internal addresses, at registration and at delivery
+func TestPrivateURL(t *testing.T) {
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host == "internal.example.com" {
+			return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}, {IP: net.ParseIP("192.168.1.10")}}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	d := NewDispatcher(Config{Workers: 1, MaxAttempts: 1, LookupIP: lookup}, zap.NewNop().Sugar())
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost.:8080/hook",
+		"http://10.1.2.3/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://100.127.255.254/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"https://internal.example.com/hook",
+	} {
+		if _, err := d.Register("acme", "0x123", url, ""); err == nil {
+			t.Errorf("Register accepted %s", url)
+		}
+	}
+	if _, err := d.Register("acme", "0x123", "http://10.1.2.3/hook", ""); !errors.Is(err, ErrPrivateURL) {
+		t.Errorf("Register returned %v, expected %v", err, ErrPrivateURL)
+	}
+	for _, url := range []string{"https://93.184.215.14/hook", "https://100.63.255.255/hook", "https://100.128.0.1/hook"} {
+		if _, err := d.Register("acme", "0x123", url, ""); err != nil {
+			t.Errorf("Register returned error for the public address of %s: %v", url, err)
+		}
+	}
+
+	// A host rebound to a loopback address after registration is refused when dialing
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.lock.Lock()
+	d.hooks["rebound"] = Webhook{ID: "rebound", Tenant: "acme", Address: "0x456", URL: receiver.URL}
+	d.lock.Unlock()
+	d.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x456", Block: 7})
+
+	waitFor(t, func() bool { return len(d.DeadLetters("acme", "0x456")) == 1 })
+	if got := attempts.Load(); got != 0 {
+		t.Errorf("receiver got %d attempts, expected none", got)
+	}
+	if letter := d.DeadLetters("acme", "0x456")[0]; !strings.Contains(letter.Error, ErrPrivateURL.Error()) {
+		t.Errorf("dead letter error is %q, expected %q", letter.Error, ErrPrivateURL)
+	}
+}
+
+// subscriptions is a fixed set of tenant and address pairs
+type subscriptions map[[2]string]bool
+
+func (s subscriptions) IsSubscribed(tenant, address string) bool {
+	return s[[2]string{tenant, address}]
+}
+
+// Define a test for two tenants with webhooks on the same address, one of which unsubscribed
+func TestPublishTenants(t *testing.T) {
+	received := make(chan string, 2)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(HeaderID)
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subs := subscriptions{{"acme", "0x123"}: true}
+	d := NewDispatcher(Config{Workers: 1, AllowPrivate: true, Subscriptions: subs}, zap.NewNop().Sugar())
+	go d.Run(ctx)
+
+	acme, err := d.Register("acme", "0x123", receiver.URL, "")
+	if err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	if _, err = d.Register("globex", "0x123", receiver.URL, ""); err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	d.Publish(parser.Event{Type: parser.EventTransaction, Address: "0x123", Block: 7, Transaction: &parser.Transaction{Hash: "0xaaa"}})
+
+	select {
+	case id := <-received:
+		if id != acme.ID {
+			t.Errorf("delivered to webhook %s, expected the one of acme %s", id, acme.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the receiver got no delivery")
+	}
+	select {
+	case id := <-received:
+		t.Errorf("delivered to webhook %s of globex, which is no longer subscribed", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Define a test of the number of webhooks a tenant may register
+func TestWebhookLimit(t *testing.T) {
+	d := NewDispatcher(Config{AllowPrivate: true, MaxWebhooks: 2}, zap.NewNop().Sugar())
+
+	for i := 0; i < 2; i++ {
+		if _, err := d.Register("acme", "0x123", "http://127.0.0.1/hook", ""); err != nil {
+			t.Fatalf("Register returned error: %v", err)
+		}
+	}
+	if _, err := d.Register("acme", "0x456", "http://127.0.0.1/hook", ""); !errors.Is(err, ErrWebhookLimit) {
+		t.Errorf("Register returned %v, expected %v", err, ErrWebhookLimit)
+	}
+	if _, err := d.Register("globex", "0x123", "http://127.0.0.1/hook", ""); err != nil {
+		t.Errorf("Register returned error for another tenant: %v", err)
+	}
+
+	// Removing a webhook frees room
+	d.Remove("acme", "0x123", d.Webhooks("acme", "0x123")[0].ID)
+	if _, err := d.Register("acme", "0x456", "http://127.0.0.1/hook", ""); err != nil {
+		t.Errorf("Register returned error after a removal: %v", err)
+	}
+}